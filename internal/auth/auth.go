@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
+)
+
+// Scopes that can be granted to a client
+const (
+	ScopeAnalyze = "analyze" // Realtime analysis routes
+	ScopeBatch   = "batch"   // Batch job submission and results
+	ScopeHistory = "history" // Stored analysis records
+	ScopeAdmin   = "admin"   // Status, metrics and other clients' jobs
+)
+
+// Scopes lists every scope
+var Scopes = []string{ScopeAnalyze, ScopeBatch, ScopeHistory, ScopeAdmin}
+
+// Authentication errors
+var (
+	ErrNoCredentials      = errors.New("missing bearer token")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Identity is an authenticated client
+type Identity struct {
+	Client string   `json:"client"`
+	Tenant string   `json:"tenant,omitempty"` // From the API key entry or the JWT tenant claim
+	Scopes []string `json:"scopes"`
+}
+
+// Has reports whether the identity was granted the scope
+func (id *Identity) Has(scope string) bool {
+	return id != nil && slices.Contains(id.Scopes, scope)
+}
+
+// identityKey stores the identity in a context
+type identityKey struct{}
+
+// WithIdentity returns a context carrying the identity
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns the identity from the context, or nil when the request
+// was not authenticated
+func FromContext(ctx context.Context) *Identity {
+	id, _ := ctx.Value(identityKey{}).(*Identity)
+	return id
+}
+
+// Authenticator checks the credentials presented with a request
+type Authenticator struct {
+	keys map[string]*Identity // By key digest
+	jwt  *jwtVerifier         // nil unless auth.jwt is enabled
+}
+
+// New creates an authenticator from the configured keys, key file and JWT
+// settings. It returns nil when authentication is disabled.
+func New(cfg *config.Config) (*Authenticator, error) {
+	if !cfg.Auth.Enabled {
+		return nil, nil
+	}
+
+	keys := cfg.Auth.Keys
+	if cfg.Auth.KeyFile != "" {
+		fileKeys, err := loadKeyFile(cfg.Auth.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(slices.Clip(keys), fileKeys...)
+	}
+
+	a := &Authenticator{keys: make(map[string]*Identity)}
+	for _, key := range keys {
+		digest, ok := strings.CutPrefix(key.Hash, hashPrefix)
+		if !ok || len(digest) != 64 {
+			return nil, fmt.Errorf("API key %q: hash must be %q followed by a hex SHA-256 digest", key.Name, hashPrefix)
+		}
+		for _, scope := range key.Scopes {
+			if !slices.Contains(Scopes, scope) {
+				return nil, fmt.Errorf("API key %q: unknown scope %q", key.Name, scope)
+			}
+		}
+		digest = strings.ToLower(digest)
+		if _, dup := a.keys[digest]; dup {
+			return nil, fmt.Errorf("API key %q: hash is already in use", key.Name)
+		}
+		a.keys[digest] = &Identity{Client: key.Name, Tenant: key.Tenant, Scopes: key.Scopes}
+	}
+
+	if cfg.Auth.JWT.Enabled {
+		verifier, err := newJWTVerifier(cfg)
+		if err != nil {
+			return nil, err
+		}
+		a.jwt = verifier
+	}
+	return a, nil
+}
+
+// Authenticate returns the identity for the request's bearer token, which is
+// either an API key or, when enabled, a JWT
+func (a *Authenticator) Authenticate(r *http.Request) (*Identity, error) {
+	token, ok := BearerToken(r)
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	if a.jwt != nil && looksLikeJWT(token) {
+		return a.jwt.verify(r.Context(), token)
+	}
+	id, ok := a.keys[digest(token)]
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	return id, nil
+}
+
+// BearerToken returns the token from the request's Authorization header
+func BearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
@@ -0,0 +1,289 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Default JWKS settings
+const (
+	defaultJWKSRefresh = time.Hour
+	jwksFetchTimeout   = 10 * time.Second
+	jwksMissInterval   = time.Minute // Least time between refetches for unknown key IDs
+)
+
+// errUnknownKey is returned when no key in the set matches a token
+var errUnknownKey = errors.New("no matching key in JWKS")
+
+// jwk is one entry of a JSON Web Key Set
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey is a parsed verification key
+type publicKey struct {
+	key crypto.PublicKey
+	alg string // Algorithm the key is restricted to, if any
+}
+
+// keySet holds the verification keys from a JWKS file or URL. Keys from a
+// URL are refreshed periodically, and early when a token names an unknown
+// key ID. Fetches run in the background, one at a time and at most once per
+// jwksMissInterval, so a slow endpoint or a flood of unknown key IDs never
+// holds up tokens signed with known keys.
+type keySet struct {
+	file    string
+	url     string
+	refresh time.Duration
+	client  *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]publicKey // By key ID
+	fetched   time.Time
+	attempted time.Time
+	fetching  chan struct{} // Closed when the fetch in progress ends; nil when idle
+}
+
+// newKeySet loads the key set from the file, or fetches it from the URL. A
+// failed fetch is logged and retried on the next token so the server can
+// start while the identity provider is unreachable.
+func newKeySet(file, url string, refresh time.Duration) (*keySet, error) {
+	if refresh <= 0 {
+		refresh = defaultJWKSRefresh
+	}
+	s := &keySet{
+		file:    file,
+		url:     url,
+		refresh: refresh,
+		client:  &http.Client{Timeout: jwksFetchTimeout},
+	}
+
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading JWKS file: %w", err)
+		}
+		keys, err := parseJWKS(data)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing JWKS file %s: %w", file, err)
+		}
+		s.keys = keys
+		return s, nil
+	}
+
+	s.attempted = time.Now()
+	keys, err := s.download(context.Background())
+	if err != nil {
+		slog.Warn("failed to fetch JWKS", "url", url, "error", err.Error())
+	} else {
+		s.keys = keys
+		s.fetched = s.attempted
+	}
+	return s, nil
+}
+
+// key returns the key for a key ID. An empty ID matches a set of one key.
+// A known key is returned at once, refreshing a stale set in the background;
+// an unknown key waits for the fetch in progress, or one it starts, until
+// ctx ends.
+func (s *keySet) key(ctx context.Context, kid string) (publicKey, error) {
+	s.mu.Lock()
+	key, known := s.lookup(kid)
+	var wait chan struct{}
+	if s.url != "" {
+		stale := time.Since(s.fetched) > s.refresh
+		if (stale || !known) && s.fetching == nil && time.Since(s.attempted) > jwksMissInterval {
+			s.attempted = time.Now()
+			s.fetching = make(chan struct{})
+			go s.fetch(s.fetching)
+		}
+		wait = s.fetching
+	}
+	s.mu.Unlock()
+
+	if known {
+		return key, nil
+	}
+	if wait == nil {
+		return publicKey{}, errUnknownKey
+	}
+	select {
+	case <-wait:
+	case <-ctx.Done():
+		return publicKey{}, errUnknownKey
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if key, ok := s.lookup(kid); ok {
+		return key, nil
+	}
+	return publicKey{}, errUnknownKey
+}
+
+// lookup finds a key by ID; the caller holds s.mu
+func (s *keySet) lookup(kid string) (publicKey, bool) {
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+// fetch downloads the key set in the background and replaces the keys on
+// success, then closes done
+func (s *keySet) fetch(done chan struct{}) {
+	keys, err := s.download(context.Background())
+	if err != nil {
+		slog.Warn("failed to refresh JWKS", "url", s.url, "error", err.Error())
+	}
+
+	s.mu.Lock()
+	if err == nil {
+		s.keys = keys
+		s.fetched = time.Now()
+	}
+	s.fetching = nil
+	s.mu.Unlock()
+	close(done)
+}
+
+// download fetches and parses the key set from the URL
+func (s *keySet) download(ctx context.Context) (map[string]publicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS endpoint returned status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	return parseJWKS(data)
+}
+
+// parseJWKS parses the signing keys of a key set, skipping encryption keys
+// and key types that are not supported
+func parseJWKS(data []byte) (map[string]publicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]publicKey)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k.Kid, err)
+		}
+		if key != nil {
+			keys[k.Kid] = publicKey{key: key, alg: k.Alg}
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no usable signing keys")
+	}
+	return keys, nil
+}
+
+// publicKey decodes an RSA, EC or Ed25519 key. It returns nil for other key
+// types.
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, errX := decodeBigInt(k.X)
+		y, errY := decodeBigInt(k.Y)
+		if errX != nil || errY != nil {
+			return nil, errors.New("invalid coordinates")
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		if _, err := key.ECDH(); err != nil {
+			return nil, fmt.Errorf("invalid point: %w", err)
+		}
+		return key, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+
+	default:
+		return nil, nil
+	}
+}
+
+// decodeBigInt decodes a base64url big-endian integer
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,248 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
+)
+
+// Default claim mapping
+const (
+	defaultClientClaim = "sub"
+	defaultScopesClaim = "scope"
+	defaultLeeway      = 30 * time.Second
+)
+
+// jwtHeader is the decoded JOSE header of a token
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// jwtVerifier validates JWTs against a key set and maps their claims to an
+// identity
+type jwtVerifier struct {
+	keys        *keySet
+	issuer      string
+	audience    string
+	leeway      time.Duration
+	clientClaim string
+	tenantClaim string
+	scopesClaim string
+}
+
+// newJWTVerifier creates a verifier from the auth.jwt settings
+func newJWTVerifier(cfg *config.Config) (*jwtVerifier, error) {
+	jc := cfg.Auth.JWT
+	keys, err := newKeySet(jc.JWKSFile, jc.JWKSURL, jc.JWKSRefresh)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &jwtVerifier{
+		keys:        keys,
+		issuer:      jc.Issuer,
+		audience:    jc.Audience,
+		leeway:      jc.Leeway,
+		clientClaim: orDefault(jc.ClientClaim, defaultClientClaim),
+		tenantClaim: jc.TenantClaim,
+		scopesClaim: orDefault(jc.ScopesClaim, defaultScopesClaim),
+	}
+	if v.leeway <= 0 {
+		v.leeway = defaultLeeway
+	}
+	return v, nil
+}
+
+// looksLikeJWT reports whether a bearer token has the three segments of a
+// compact JWT. API keys never contain dots.
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// verify checks the token's signature and registered claims and returns the
+// identity it carries
+func (v *jwtVerifier) verify(ctx context.Context, token string) (*Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidCredentials)
+	}
+
+	// Decode the header and find the key
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: invalid header: %v", ErrInvalidCredentials, err)
+	}
+	key, err := v.keys.key(ctx, header.Kid)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	if key.alg != "" && key.alg != header.Alg {
+		return nil, fmt.Errorf("%w: key %q is for %s, token uses %s", ErrInvalidCredentials, header.Kid, key.alg, header.Alg)
+	}
+
+	// Check the signature
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid signature encoding", ErrInvalidCredentials)
+	}
+	if err := verifySignature(header.Alg, key.key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+
+	// Check the registered claims
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: invalid claims: %v", ErrInvalidCredentials, err)
+	}
+	if err := v.checkClaims(claims, time.Now()); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+
+	// Map the claims to an identity
+	client, _ := claims[v.clientClaim].(string)
+	if client == "" {
+		return nil, fmt.Errorf("%w: missing %s claim", ErrInvalidCredentials, v.clientClaim)
+	}
+	id := &Identity{Client: client, Scopes: stringList(claims[v.scopesClaim])}
+	if v.tenantClaim != "" {
+		id.Tenant, _ = claims[v.tenantClaim].(string)
+	}
+	return id, nil
+}
+
+// checkClaims validates the issuer, audience and validity period
+func (v *jwtVerifier) checkClaims(claims map[string]any, now time.Time) error {
+	if iss, _ := claims["iss"].(string); iss != v.issuer {
+		return fmt.Errorf("unexpected issuer %q", iss)
+	}
+	audience := []string{}
+	switch aud := claims["aud"].(type) {
+	case string:
+		audience = append(audience, aud)
+	case []any:
+		audience = stringList(aud)
+	}
+	if !slices.Contains(audience, v.audience) {
+		return errors.New("token is not for this audience")
+	}
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New("missing exp claim")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(v.leeway)) {
+		return errors.New("token has expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(v.leeway).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New("token is not valid yet")
+	}
+	return nil
+}
+
+// verifySignature checks a signature made with one of the supported
+// algorithms. The key type must match the algorithm.
+func verifySignature(alg string, key crypto.PublicKey, input string, signature []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "PS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "PS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "PS512", "ES512":
+		hash = crypto.SHA512
+	case "EdDSA":
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+
+	var digest []byte
+	if hash != 0 {
+		h := hash.New()
+		h.Write([]byte(input))
+		digest = h.Sum(nil)
+	}
+
+	invalid := errors.New("invalid signature")
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		switch alg[:2] {
+		case "RS":
+			if rsa.VerifyPKCS1v15(k, hash, digest, signature) != nil {
+				return invalid
+			}
+			return nil
+		case "PS":
+			if rsa.VerifyPSS(k, hash, digest, signature, nil) != nil {
+				return invalid
+			}
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if alg[:2] == "ES" && len(signature) == 2*size {
+			r := new(big.Int).SetBytes(signature[:size])
+			s := new(big.Int).SetBytes(signature[size:])
+			if !ecdsa.Verify(k, digest, r, s) {
+				return invalid
+			}
+			return nil
+		}
+	case ed25519.PublicKey:
+		if alg == "EdDSA" {
+			if !ed25519.Verify(k, []byte(input), signature) {
+				return invalid
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("algorithm %s does not match the key type", alg)
+}
+
+// decodeSegment decodes a base64url JSON segment of a token
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// stringList reads a claim that is either a space-delimited string, as with
+// OAuth scopes, or an array of strings
+func stringList(claim any) []string {
+	switch v := claim.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		var list []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	default:
+		return nil
+	}
+}
+
+// orDefault returns value, or fallback when value is empty
+func orDefault(value, fallback string) string {
+	if value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,308 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
+)
+
+const (
+	testIssuer   = "https://issuer.example.com"
+	testAudience = "prompt-analysis"
+	testKid      = "test-key"
+)
+
+// testKey is shared by the tests; generating RSA keys is slow
+var testKey = mustRSAKey()
+
+func mustRSAKey() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// jwksJSON returns a key set holding the public half of key
+func jwksJSON(t *testing.T, kid string, key *rsa.PrivateKey) []byte {
+	t.Helper()
+	set := map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// newTestVerifier creates a verifier reading the test key from a JWKS file
+func newTestVerifier(t *testing.T) *jwtVerifier {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwksJSON(t, testKid, testKey), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg config.Config
+	cfg.Auth.JWT.JWKSFile = path
+	cfg.Auth.JWT.Issuer = testIssuer
+	cfg.Auth.JWT.Audience = testAudience
+	cfg.Auth.JWT.Leeway = 30 * time.Second
+	v, err := newJWTVerifier(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// validClaims returns claims the test verifier accepts
+func validClaims() map[string]any {
+	now := time.Now()
+	return map[string]any{
+		"iss":   testIssuer,
+		"aud":   testAudience,
+		"sub":   "ci-pipeline",
+		"scope": "analyze batch",
+		"exp":   now.Add(time.Hour).Unix(),
+		"nbf":   now.Add(-time.Minute).Unix(),
+	}
+}
+
+// encodeSegment encodes a token header or claims segment
+func encodeSegment(t *testing.T, v any) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// signRS256 returns a token signed with the test key
+func signRS256(t *testing.T, claims map[string]any) string {
+	t.Helper()
+	input := encodeSegment(t, map[string]string{"alg": "RS256", "kid": testKid}) + "." + encodeSegment(t, claims)
+	digest := sha256.Sum256([]byte(input))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, testKey, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestVerifyAcceptsValidToken(t *testing.T) {
+	v := newTestVerifier(t)
+	id, err := v.verify(context.Background(), signRS256(t, validClaims()))
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if id.Client != "ci-pipeline" || !id.Has(ScopeAnalyze) || !id.Has(ScopeBatch) {
+		t.Errorf("identity = %+v", id)
+	}
+}
+
+func TestVerifyRejectsAlgorithmConfusion(t *testing.T) {
+	v := newTestVerifier(t)
+	payload := encodeSegment(t, validClaims())
+
+	// An unsigned token
+	none := encodeSegment(t, map[string]string{"alg": "none", "kid": testKid}) + "." + payload + "."
+
+	// An HMAC token keyed with the public key, which a verifier that trusts
+	// the header's algorithm would accept
+	input := encodeSegment(t, map[string]string{"alg": "HS256", "kid": testKid}) + "." + payload
+	mac := hmac.New(sha256.New, jwksJSON(t, testKid, testKey))
+	mac.Write([]byte(input))
+	hs256 := input + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	// An RSA-PSS algorithm with a PKCS #1 v1.5 signature
+	rs := signRS256(t, validClaims())
+	parts := splitToken(t, rs)
+	ps256 := encodeSegment(t, map[string]string{"alg": "PS256", "kid": testKid}) + "." + parts[1] + "." + parts[2]
+
+	for name, token := range map[string]string{"none": none, "HS256": hs256, "PS256": ps256} {
+		if _, err := v.verify(context.Background(), token); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("%s: err = %v, want ErrInvalidCredentials", name, err)
+		}
+	}
+}
+
+func TestVerifyRejectsTamperedClaims(t *testing.T) {
+	v := newTestVerifier(t)
+	parts := splitToken(t, signRS256(t, validClaims()))
+
+	claims := validClaims()
+	claims["scope"] = "admin"
+	tampered := parts[0] + "." + encodeSegment(t, claims) + "." + parts[2]
+	if _, err := v.verify(context.Background(), tampered); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("err = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestVerifyClockSkew(t *testing.T) {
+	v := newTestVerifier(t)
+	now := time.Now()
+
+	tests := []struct {
+		name  string
+		exp   time.Time
+		nbf   time.Time
+		valid bool
+	}{
+		{"expired within leeway", now.Add(-10 * time.Second), now.Add(-time.Hour), true},
+		{"expired beyond leeway", now.Add(-time.Minute), now.Add(-time.Hour), false},
+		{"not yet valid within leeway", now.Add(time.Hour), now.Add(10 * time.Second), true},
+		{"not yet valid beyond leeway", now.Add(time.Hour), now.Add(time.Minute), false},
+	}
+	for _, tt := range tests {
+		claims := validClaims()
+		claims["exp"] = tt.exp.Unix()
+		claims["nbf"] = tt.nbf.Unix()
+		_, err := v.verify(context.Background(), signRS256(t, claims))
+		if tt.valid && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("%s: err = %v, want ErrInvalidCredentials", tt.name, err)
+		}
+	}
+
+	// A token without exp never expires, so it is rejected
+	claims := validClaims()
+	delete(claims, "exp")
+	if _, err := v.verify(context.Background(), signRS256(t, claims)); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("missing exp: err = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestVerifyRejectsWrongIssuerOrAudience(t *testing.T) {
+	v := newTestVerifier(t)
+
+	tests := map[string]func(map[string]any){
+		"wrong issuer":       func(c map[string]any) { c["iss"] = "https://attacker.example.com" },
+		"missing issuer":     func(c map[string]any) { delete(c, "iss") },
+		"wrong audience":     func(c map[string]any) { c["aud"] = "another-service" },
+		"audience list":      func(c map[string]any) { c["aud"] = []string{"another-service", "third"} },
+		"missing audience":   func(c map[string]any) { delete(c, "aud") },
+		"missing client":     func(c map[string]any) { delete(c, "sub") },
+		"audience substring": func(c map[string]any) { c["aud"] = testAudience + "-staging" },
+	}
+	for name, mutate := range tests {
+		claims := validClaims()
+		mutate(claims)
+		if _, err := v.verify(context.Background(), signRS256(t, claims)); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("%s: err = %v, want ErrInvalidCredentials", name, err)
+		}
+	}
+
+	// The audience may be one of several
+	claims := validClaims()
+	claims["aud"] = []string{"another-service", testAudience}
+	if _, err := v.verify(context.Background(), signRS256(t, claims)); err != nil {
+		t.Errorf("audience list: unexpected error %v", err)
+	}
+}
+
+func TestKeySetFetchDoesNotBlockKnownKeys(t *testing.T) {
+	// Serve the key set once, then hang until the test ends
+	jwks := jwksJSON(t, testKid, testKey)
+	release := make(chan struct{})
+	var served atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if served.Swap(true) {
+			<-release
+			return
+		}
+		w.Write(jwks)
+	}))
+	defer func() {
+		close(release)
+		srv.Close()
+	}()
+
+	s, err := newKeySet("", srv.URL, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Allow an immediate refetch for an unknown key ID, which will hang
+	s.mu.Lock()
+	s.attempted = time.Time{}
+	s.mu.Unlock()
+	unknown := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		_, err := s.key(ctx, "unknown")
+		unknown <- err
+	}()
+
+	// Wait for the refetch to start, then look up the known key
+	deadline := time.Now().Add(time.Second)
+	for {
+		s.mu.Lock()
+		fetching := s.fetching != nil
+		s.mu.Unlock()
+		if fetching || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	start := time.Now()
+	if _, err := s.key(context.Background(), testKid); err != nil {
+		t.Fatalf("known key: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("known key lookup took %v while a fetch was in progress", elapsed)
+	}
+
+	// A second unknown key ID does not start another fetch
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := s.key(ctx, "another"); !errors.Is(err, errUnknownKey) {
+		t.Errorf("err = %v, want errUnknownKey", err)
+	}
+	if err := <-unknown; !errors.Is(err, errUnknownKey) {
+		t.Errorf("err = %v, want errUnknownKey", err)
+	}
+}
+
+// splitToken splits a compact token into its three segments
+func splitToken(t *testing.T, token string) [3]string {
+	t.Helper()
+	var parts [3]string
+	start, n := 0, 0
+	for i := 0; i < len(token); i++ {
+		if token[i] == '.' {
+			parts[n] = token[start:i]
+			n++
+			start = i + 1
+		}
+	}
+	if n != 2 {
+		t.Fatalf("token has %d dots", n)
+	}
+	parts[2] = token[start:]
+	return parts
+}
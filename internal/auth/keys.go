@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
+)
+
+// hashPrefix marks the digest algorithm of a stored key hash
+const hashPrefix = "sha256:"
+
+// keyPrefix makes generated keys easy to spot in secret scanners
+const keyPrefix = "pak_"
+
+// keyFile is the layout of auth.key_file
+type keyFile struct {
+	Keys []config.APIKey `yaml:"keys"`
+}
+
+// GenerateKey returns a new random API key
+func GenerateKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate key: %w", err)
+	}
+	return keyPrefix + hex.EncodeToString(b), nil
+}
+
+// HashKey returns the value to store in config for a key
+func HashKey(key string) string {
+	return hashPrefix + digest(key)
+}
+
+// digest returns the hex SHA-256 digest of a key
+func digest(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// loadKeyFile reads the keys listed in a YAML key file
+func loadKeyFile(path string) ([]config.APIKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading key file: %w", err)
+	}
+	var file keyFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("error parsing key file %s: %w", path, err)
+	}
+	return file.Keys, nil
+}
@@ -0,0 +1,548 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/auth"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/cache"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/llm"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/metrics"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/store"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/tenant"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/usage"
+)
+
+// Job statuses
+const (
+	StatusQueued  = "queued"
+	StatusRunning = "running"
+	StatusDone    = "done"
+)
+
+// Job errors
+var (
+	ErrJobNotFound   = errors.New("batch job not found")
+	ErrTooManyItems  = errors.New("too many prompts in batch")
+	ErrNoItems       = errors.New("batch contains no prompts")
+	ErrQueueFull     = errors.New("batch queue is full")
+	ErrManagerClosed = errors.New("batch manager is shut down")
+	ErrNotResumable  = errors.New("batch jobs need the encrypted retention mode to resume after a restart")
+)
+
+// Default limits used when the configuration leaves them unset
+const (
+	defaultMaxItems            = 5000
+	defaultWorkers             = 8
+	defaultProviderConcurrency = 4
+	defaultQueueSize           = 100
+)
+
+// JobStatus is a point-in-time view of a job's progress
+type JobStatus struct {
+	ID         string     `json:"id"`
+	Provider   string     `json:"provider"`
+	Client     string     `json:"client,omitempty"` // Authenticated API client that submitted the job
+	Tenant     string     `json:"tenant,omitempty"`
+	Status     string     `json:"status"`
+	Total      int        `json:"total"`
+	Completed  int        `json:"completed"` // Items analyzed successfully
+	Failed     int        `json:"failed"`    // Items that produced an error
+	CreatedAt  time.Time  `json:"createdAt"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// job is a submitted batch and its results
+type job struct {
+	JobStatus
+	Items       []Item   `json:"-"`                     // Prompts are never written in plaintext
+	SealedItems []byte   `json:"sealedItems,omitempty"` // Items encrypted under the tenant's retention key
+	results     []Result // guarded by Manager.mu
+	pending     []Item   // items still to analyze; set before dispatch
+}
+
+// task is a single item of a job handed to a worker
+type task struct {
+	job  *job
+	item Item
+}
+
+// providerPool runs the jobs of one provider
+type providerPool struct {
+	name     string
+	provider llm.LLM
+	queue    chan *job
+	tasks    chan task
+}
+
+// Manager runs batch jobs on a bounded worker pool. Each provider has its own
+// queue and concurrency limit, and a shared limit caps total parallelism.
+type Manager struct {
+	mu       sync.Mutex
+	jobs     map[string]*job
+	pools    map[string]*providerPool
+	slots    chan struct{}
+	persist  *jobStore
+	ledger   *usage.Ledger
+	tenants  *tenant.Registry
+	cache    *cache.Cache
+	maxItems int
+	jobTTL   time.Duration
+
+	ctx    context.Context // Cancels in-flight analyses
+	cancel context.CancelFunc
+	stop   context.Context // Stops dispatching new items; ends with ctx
+	halt   context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewManager creates a batch manager for the given providers, keyed by the
+// identifiers accepted by llm.NewProvider, and starts its workers. When the
+// file storage backend is configured, unfinished jobs from a previous run are
+// reloaded and resumed. Token usage and cost are added to the ledger, jobs
+// run with their tenant's model and system prompt, and duplicate prompts are
+// answered from the cache; any of these may be nil.
+func NewManager(cfg *config.Config, providers map[string]llm.LLM, ledger *usage.Ledger, tenants *tenant.Registry, c *cache.Cache) (*Manager, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stop, halt := context.WithCancel(ctx)
+	m := &Manager{
+		jobs:     make(map[string]*job),
+		pools:    make(map[string]*providerPool),
+		slots:    make(chan struct{}, withDefault(cfg.Batch.Workers, defaultWorkers)),
+		ledger:   ledger,
+		tenants:  tenants,
+		cache:    c,
+		maxItems: withDefault(cfg.Batch.MaxItems, defaultMaxItems),
+		jobTTL:   cfg.Batch.JobTTL,
+		ctx:      ctx,
+		cancel:   cancel,
+		stop:     stop,
+		halt:     halt,
+	}
+
+	// Persist jobs next to the record store when it lives on disk
+	if cfg.Storage.Backend == "file" {
+		m.persist = newJobStore(cfg.Storage.Path)
+		if tenants != nil {
+			m.persist.retention = func(name string) *store.Retention { return tenants.For(name).Retention }
+		}
+
+		// Jobs only resume when their prompts can be sealed on disk, so the
+		// other tenants' submissions are refused
+		names := []string{""}
+		for _, t := range cfg.Tenants {
+			names = append(names, t.Name)
+		}
+		for _, name := range names {
+			if !m.persist.resumable(name) {
+				slog.Warn("batch jobs will be refused: retention is not encrypted", "tenant", name)
+			}
+		}
+	}
+
+	// Start one pool per provider
+	for name, provider := range providers {
+		pool := &providerPool{
+			name:     name,
+			provider: provider,
+			queue:    make(chan *job, withDefault(cfg.Batch.QueueSize, defaultQueueSize)),
+			tasks:    make(chan task),
+		}
+		m.pools[name] = pool
+
+		m.wg.Add(1)
+		go m.dispatch(pool)
+		for i := 0; i < withDefault(cfg.Batch.ProviderConcurrency[name], defaultProviderConcurrency); i++ {
+			m.wg.Add(1)
+			go m.work(pool)
+		}
+	}
+
+	// Reload jobs left over from a previous run
+	if m.persist != nil {
+		if err := m.restore(); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+
+	// Discard expired jobs in the background
+	if m.jobTTL > 0 {
+		m.wg.Add(1)
+		go m.expire()
+	}
+
+	return m, nil
+}
+
+// Submit queues a new job and returns its initial status. The job is owned by
+// the client authenticated in ctx, if any. With the file storage backend, jobs
+// are refused unless the tenant's prompts can be kept on disk to resume them.
+func (m *Manager) Submit(ctx context.Context, providerName string, items []Item) (JobStatus, error) {
+	pool, ok := m.pools[providerName]
+	if !ok {
+		return JobStatus{}, fmt.Errorf("%w: %s", llm.ErrUnknownProvider, providerName)
+	}
+	if len(items) == 0 {
+		return JobStatus{}, ErrNoItems
+	}
+	if len(items) > m.maxItems {
+		return JobStatus{}, fmt.Errorf("%w: %d exceeds the limit of %d", ErrTooManyItems, len(items), m.maxItems)
+	}
+	var client, tenantName string
+	if id := auth.FromContext(ctx); id != nil {
+		client, tenantName = id.Client, id.Tenant
+	}
+	if m.persist != nil && !m.persist.resumable(tenantName) {
+		return JobStatus{}, ErrNotResumable
+	}
+
+	// Number the items so results can be matched back
+	for i := range items {
+		items[i].Line = i + 1
+	}
+
+	j := &job{
+		JobStatus: JobStatus{
+			ID:        store.NewID(),
+			Provider:  providerName,
+			Status:    StatusQueued,
+			Client:    client,
+			Tenant:    tenantName,
+			Total:     len(items),
+			CreatedAt: time.Now().UTC(),
+		},
+		Items:   items,
+		pending: items,
+	}
+
+	// Save the job before queueing so it survives a restart
+	if m.persist != nil {
+		if err := m.persist.create(j); err != nil {
+			return JobStatus{}, err
+		}
+	}
+
+	m.mu.Lock()
+	m.jobs[j.ID] = j
+	status := j.JobStatus
+	m.mu.Unlock()
+
+	// Queue the job without blocking the caller
+	if m.stop.Err() != nil {
+		m.discard(j.ID)
+		return JobStatus{}, ErrManagerClosed
+	}
+	select {
+	case pool.queue <- j:
+		return status, nil
+	default:
+		m.discard(j.ID)
+		return JobStatus{}, ErrQueueFull
+	}
+}
+
+// Status returns the current progress of a job
+func (m *Manager) Status(id string) (JobStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j, ok := m.jobs[id]
+	if !ok {
+		return JobStatus{}, ErrJobNotFound
+	}
+	return j.JobStatus, nil
+}
+
+// Results returns the status of a job and a copy of the results recorded so
+// far, in completion order
+func (m *Manager) Results(id string) (JobStatus, []Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j, ok := m.jobs[id]
+	if !ok {
+		return JobStatus{}, nil, ErrJobNotFound
+	}
+	results := make([]Result, len(j.results))
+	copy(results, j.results)
+	return j.JobStatus, results, nil
+}
+
+// Close stops the workers. Items in flight are abandoned; persisted jobs
+// resume on the next start.
+func (m *Manager) Close() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+// Shutdown stops starting new items and waits for in-flight analyses to
+// finish. If ctx ends first, the remaining analyses are cancelled. Queued
+// items are left unfinished; with file persistence they resume on the next
+// start.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.halt()
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		m.cancel()
+		return nil
+	case <-ctx.Done():
+		m.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// dispatch feeds the items of queued jobs to the provider's workers in order
+func (m *Manager) dispatch(pool *providerPool) {
+	defer m.wg.Done()
+	defer close(pool.tasks)
+
+	for {
+		select {
+		case <-m.stop.Done():
+			return
+		case j := <-pool.queue:
+			m.mu.Lock()
+			if j.Status == StatusQueued {
+				now := time.Now().UTC()
+				j.Status = StatusRunning
+				j.StartedAt = &now
+			}
+			pending := j.pending
+			m.mu.Unlock()
+
+			for _, item := range pending {
+				select {
+				case <-m.stop.Done():
+					return
+				case pool.tasks <- task{job: j, item: item}:
+				}
+			}
+		}
+	}
+}
+
+// work analyzes tasks, holding a shared slot for the duration of each call.
+// Once the job's owner reaches a hard budget, its remaining items fail
+// without calling the provider.
+func (m *Manager) work(pool *providerPool) {
+	defer m.wg.Done()
+
+	for t := range pool.tasks {
+		if m.ledger != nil {
+			if breach, ok := m.ledger.HardBreach(t.job.Client, t.job.Tenant); ok {
+				metrics.BudgetBreaches.WithLabelValues(t.job.Client, t.job.Tenant, breach.Period, "hard").Inc()
+				m.record(t.job, Result{
+					Line:     t.item.Line,
+					ID:       t.item.ID,
+					Provider: pool.provider.Name(),
+					Error:    fmt.Sprintf("budget exceeded: %s", breach),
+				})
+				continue
+			}
+		}
+
+		select {
+		case <-m.ctx.Done():
+			return
+		case m.slots <- struct{}{}:
+		}
+
+		// Batch items queue for provider quota rather than being shed
+		ctx := llm.WaitForQuota(m.ctx)
+		if m.tenants != nil {
+			ctx = llm.WithOverrides(ctx, m.tenants.Overrides(t.job.Tenant))
+		}
+		result, ok := analyzeItem(ctx, pool.provider, m.cache, t.item)
+		<-m.slots
+		if !ok {
+			continue
+		}
+
+		// Charge the usage to the job's owner
+		if m.ledger != nil && result.Usage != nil {
+			if cost, priced := m.ledger.Record(t.job.Client, t.job.Tenant, pool.name, llm.ModelFor(ctx, pool.provider), *result.Usage); priced {
+				result.CostUSD = &cost
+			}
+		}
+		m.record(t.job, result)
+	}
+}
+
+// record stores a result against its job and marks the job done once every
+// item has a result
+func (m *Manager) record(j *job, result Result) {
+	if m.persist != nil {
+		if err := m.persist.appendResult(j.ID, result); err != nil {
+			slog.Error("failed to persist batch result", "job_id", j.ID, "error", err.Error())
+		}
+	}
+
+	m.mu.Lock()
+	j.results = append(j.results, result)
+	if result.Error != "" {
+		j.Failed++
+	} else {
+		j.Completed++
+	}
+	finished := j.Completed+j.Failed == j.Total
+	if finished {
+		now := time.Now().UTC()
+		j.Status = StatusDone
+		j.FinishedAt = &now
+		j.Items = nil
+		j.SealedItems = nil
+		j.pending = nil
+	}
+	snapshot := *j
+	m.mu.Unlock()
+
+	// Rewrite the job without its prompts once it is finished
+	if finished && m.persist != nil {
+		if err := m.persist.finish(&snapshot); err != nil {
+			slog.Error("failed to persist batch job", "job_id", j.ID, "error", err.Error())
+		}
+	}
+}
+
+// restore reloads persisted jobs and requeues the unfinished ones. Jobs that
+// cannot resume are failed rather than left queued.
+func (m *Manager) restore() error {
+	jobs, err := m.persist.load()
+	if err != nil {
+		return err
+	}
+
+	for _, j := range jobs {
+		m.jobs[j.ID] = j
+		if j.Status == StatusDone {
+			continue
+		}
+
+		// Finish jobs whose last result was written just before shutdown
+		if j.Completed+j.Failed >= j.Total {
+			now := time.Now().UTC()
+			j.Status = StatusDone
+			j.FinishedAt = &now
+			j.Items = nil
+			j.SealedItems = nil
+			if err := m.persist.finish(j); err != nil {
+				return err
+			}
+			continue
+		}
+
+		pool, ok := m.pools[j.Provider]
+		switch {
+		case len(j.pending) == 0:
+			slog.Warn("failing batch job: prompts were not kept across the restart", "job_id", j.ID, "provider", j.Provider)
+			m.abandon(j, "batch job interrupted by a restart; prompts are only kept on disk with encrypted retention")
+		case !ok:
+			slog.Warn("failing batch job: provider is not configured", "job_id", j.ID, "provider", j.Provider)
+			m.abandon(j, fmt.Sprintf("provider %s is not configured", j.Provider))
+		default:
+			slog.Info("resuming batch job", "job_id", j.ID, "provider", j.Provider, "remaining", len(j.pending), "total", j.Total)
+			m.requeue(pool, j)
+		}
+	}
+
+	return nil
+}
+
+// requeue queues a restored job, waiting in the background for room when the
+// provider's queue is full
+func (m *Manager) requeue(pool *providerPool, j *job) {
+	select {
+	case pool.queue <- j:
+		return
+	default:
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		select {
+		case pool.queue <- j:
+		case <-m.stop.Done():
+		}
+	}()
+}
+
+// abandon fails every item of a job that has no result yet, so the job
+// finishes instead of staying queued
+func (m *Manager) abandon(j *job, reason string) {
+	done := make(map[int]bool, len(j.results))
+	for _, result := range j.results {
+		done[result.Line] = true
+	}
+	for line := 1; line <= j.Total; line++ {
+		if !done[line] {
+			m.record(j, Result{Line: line, Provider: j.Provider, Error: reason})
+		}
+	}
+}
+
+// expire periodically removes finished jobs older than the job TTL
+func (m *Manager) expire() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop.Done():
+			return
+		case <-ticker.C:
+		}
+
+		cutoff := time.Now().Add(-m.jobTTL)
+		var expired []string
+		m.mu.Lock()
+		for id, j := range m.jobs {
+			if j.FinishedAt != nil && j.FinishedAt.Before(cutoff) {
+				expired = append(expired, id)
+			}
+		}
+		m.mu.Unlock()
+
+		for _, id := range expired {
+			m.discard(id)
+		}
+	}
+}
+
+// discard forgets a job and deletes its persisted state
+func (m *Manager) discard(id string) {
+	m.mu.Lock()
+	delete(m.jobs, id)
+	m.mu.Unlock()
+
+	if m.persist != nil {
+		if err := m.persist.remove(id); err != nil {
+			slog.Error("failed to remove batch job", "job_id", id, "error", err.Error())
+		}
+	}
+}
+
+// withDefault returns value, or fallback when value is not positive
+func withDefault(value, fallback int) int {
+	if value > 0 {
+		return value
+	}
+	return fallback
+}
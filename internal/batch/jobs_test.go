@@ -0,0 +1,156 @@
+package batch
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/auth"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/llm"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/tenant"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/usage"
+)
+
+// waitForJob polls a job until it is done
+func waitForJob(t *testing.T, m *Manager, id string) JobStatus {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		status, err := m.Status(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Status == StatusDone {
+			return status
+		}
+	}
+	t.Fatalf("job %s did not finish", id)
+	return JobStatus{}
+}
+
+func TestJobStopsAtHardBudget(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Mock.Enabled = true
+	cfg.Mock.ModelID = "mock-1"
+	cfg.Batch.Workers = 1
+	cfg.Batch.ProviderConcurrency = map[string]int{"mock": 1}
+	// A dollar per input token puts the owner over budget after one item
+	cfg.Pricing = []config.ModelPrice{{Model: "mock-1", Input: 1e6}}
+	cfg.Budgets = []config.Budget{{Client: "alice", Daily: config.BudgetLimit{Hard: 1}}}
+
+	mock, err := llm.NewMock(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ledger, err := usage.NewLedger(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewManager(cfg, map[string]llm.LLM{"mock": mock}, ledger, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	ctx := auth.WithIdentity(context.Background(), &auth.Identity{Client: "alice"})
+	items := []Item{{Prompt: "first prompt"}, {Prompt: "second prompt"}, {Prompt: "third prompt"}}
+	status, err := m.Submit(ctx, "mock", items)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status = waitForJob(t, m, status.ID)
+	if status.Completed != 1 || status.Failed != 2 {
+		t.Errorf("status = %+v, want 1 completed and 2 failed", status)
+	}
+	_, results, err := m.Results(status.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if result.Line > 1 && !strings.Contains(result.Error, "budget exceeded") {
+			t.Errorf("line %d error = %q, want a budget error", result.Line, result.Error)
+		}
+	}
+	if entries := ledger.Entries(time.Now(), time.Now()); len(entries) != 1 || entries[0].Requests != 1 {
+		t.Errorf("ledger = %+v, want one charged call", entries)
+	}
+}
+
+// fileConfig returns a config that persists jobs under a temporary directory
+// with the given retention mode
+func fileConfig(t *testing.T, mode string) *config.Config {
+	cfg := &config.Config{}
+	cfg.Mock.Enabled = true
+	cfg.Mock.ModelID = "mock-1"
+	cfg.Batch.Workers = 1
+	cfg.Batch.ProviderConcurrency = map[string]int{"mock": 1}
+	cfg.Storage.Backend = "file"
+	cfg.Storage.Path = filepath.Join(t.TempDir(), "records.json")
+	cfg.Retention.Mode = mode
+	return cfg
+}
+
+// newFileManager starts a manager for the mock provider with cfg
+func newFileManager(t *testing.T, cfg *config.Config) *Manager {
+	t.Helper()
+	mock, err := llm.NewMock(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenants, err := tenant.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewManager(cfg, map[string]llm.LLM{"mock": mock}, nil, tenants, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestSubmitRefusedWhenJobCannotResume(t *testing.T) {
+	m := newFileManager(t, fileConfig(t, "hash"))
+	defer m.Close()
+
+	_, err := m.Submit(context.Background(), "mock", []Item{{Prompt: "a prompt"}})
+	if !errors.Is(err, ErrNotResumable) {
+		t.Errorf("err = %v, want ErrNotResumable", err)
+	}
+}
+
+func TestJobResumesAfterRestart(t *testing.T) {
+	t.Setenv("STORAGE_ENCRYPTION_KEY", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	cfg := fileConfig(t, "encrypted")
+	cfg.Mock.Latency = 50 * time.Millisecond
+
+	m := newFileManager(t, cfg)
+	items := []Item{{Prompt: "first prompt"}, {Prompt: "second prompt"}, {Prompt: "third prompt"}}
+	status, err := m.Submit(context.Background(), "mock", items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Stop before the job can finish
+	m.Close()
+
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(cfg.Storage.Path), "jobs", status.ID, "job.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "first prompt") {
+		t.Errorf("job.json holds a plaintext prompt: %s", data)
+	}
+
+	cfg.Mock.Latency = 0
+	restarted := newFileManager(t, cfg)
+	defer restarted.Close()
+	final := waitForJob(t, restarted, status.ID)
+	if final.Completed+final.Failed != 3 || final.Completed == 0 {
+		t.Errorf("status = %+v, want every item finished", final)
+	}
+}
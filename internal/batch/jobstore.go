@@ -0,0 +1,205 @@
+package batch
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/store"
+)
+
+// jobStore persists batch jobs on disk. Each job has a directory holding
+// job.json (status and, until the job finishes, its prompts sealed with the
+// tenant's retention key) and results.jsonl (one result appended per
+// analyzed item).
+type jobStore struct {
+	dir string
+	mu  sync.Mutex
+
+	// retention returns a tenant's retention policy, which decides whether
+	// pending prompts may be written; nil refuses every job
+	retention func(tenant string) *store.Retention
+}
+
+// newJobStore keeps jobs in a "jobs" directory beside the record store file
+func newJobStore(storagePath string) *jobStore {
+	return &jobStore{dir: filepath.Join(filepath.Dir(storagePath), "jobs")}
+}
+
+// resumable reports whether a tenant's jobs can be resumed after a restart,
+// which needs their prompts sealed on disk in the encrypted retention mode
+func (s *jobStore) resumable(tenant string) bool {
+	return s.retention != nil && s.retention(tenant).Mode == store.ModeEncrypted
+}
+
+// create writes a new job's status and its prompts, sealed with the record
+// key. The tenant's jobs must be resumable.
+func (s *jobStore) create(j *job) error {
+	if s.retention == nil {
+		return ErrNotResumable
+	}
+	data, err := json.Marshal(j.Items)
+	if err != nil {
+		return fmt.Errorf("failed to encode job items: %w", err)
+	}
+	sealed, ok, err := s.retention(j.Tenant).Seal(j.ID, data)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt job items: %w", err)
+	}
+	if !ok {
+		return ErrNotResumable
+	}
+	j.SealedItems = sealed
+
+	if err := os.MkdirAll(filepath.Join(s.dir, j.ID), 0o700); err != nil {
+		return fmt.Errorf("failed to create job directory: %w", err)
+	}
+	return s.writeJob(j)
+}
+
+// finish rewrites a finished job, which no longer carries its prompts
+func (s *jobStore) finish(j *job) error {
+	return s.writeJob(j)
+}
+
+// appendResult adds one result to the job's results file
+func (s *jobStore) appendResult(id string, result Result) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.OpenFile(filepath.Join(s.dir, id, "results.jsonl"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open results: %w", err)
+	}
+	defer file.Close()
+
+	return json.NewEncoder(file).Encode(result)
+}
+
+// remove deletes a job and its results
+func (s *jobStore) remove(id string) error {
+	return os.RemoveAll(filepath.Join(s.dir, id))
+}
+
+// load reads every persisted job, rebuilding its results and the items that
+// still need to be analyzed
+func (s *jobStore) load() ([]*job, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job directory: %w", err)
+	}
+
+	var jobs []*job
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		j, err := s.loadJob(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+
+	return jobs, nil
+}
+
+// loadJob reads one job directory
+func (s *jobStore) loadJob(id string) (*job, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, id, "job.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job %s: %w", id, err)
+	}
+	var j job
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, fmt.Errorf("failed to parse job %s: %w", id, err)
+	}
+
+	// Unseal the pending prompts; a job whose prompts cannot be read is
+	// failed by the manager
+	if len(j.SealedItems) > 0 && s.retention != nil {
+		plain, err := s.retention(j.Tenant).Open(j.ID, j.SealedItems)
+		if err == nil {
+			err = json.Unmarshal(plain, &j.Items)
+		}
+		if err != nil {
+			slog.Warn("cannot read batch job prompts", "job_id", j.ID, "error", err.Error())
+			j.Items = nil
+		}
+	}
+
+	// Drop any partial result line, then read the results back
+	resultsPath := filepath.Join(s.dir, id, "results.jsonl")
+	completed, err := LoadCompleted(resultsPath)
+	if err != nil {
+		return nil, err
+	}
+	j.results, err = readResults(resultsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Recount progress from the results, which are authoritative
+	j.Completed, j.Failed = 0, 0
+	for _, result := range j.results {
+		if result.Error != "" {
+			j.Failed++
+		} else {
+			j.Completed++
+		}
+	}
+	for _, item := range j.Items {
+		if !completed[item.Line] {
+			j.pending = append(j.pending, item)
+		}
+	}
+
+	return &j, nil
+}
+
+// writeJob atomically replaces a job's job.json
+func (s *jobStore) writeJob(j *job) error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return fmt.Errorf("failed to encode job: %w", err)
+	}
+
+	path := filepath.Join(s.dir, j.ID, "job.json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write job: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write job: %w", err)
+	}
+	return nil
+}
+
+// readResults reads every result from a results file
+func readResults(path string) ([]Result, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open results: %w", err)
+	}
+	defer file.Close()
+
+	var results []Result
+	decoder := json.NewDecoder(file)
+	for decoder.More() {
+		var result Result
+		if err := decoder.Decode(&result); err != nil {
+			return nil, fmt.Errorf("failed to parse results: %w", err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,182 @@
+package batch
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Input formats
+const (
+	FormatJSONL = "jsonl"
+	FormatCSV   = "csv"
+)
+
+// Common errors
+var (
+	ErrUnknownFormat = errors.New("unknown input format")
+	ErrMissingColumn = errors.New("prompt column not found in CSV header")
+)
+
+// Item is a single prompt read from the input
+type Item struct {
+	Line   int    `json:"line"`         // 1-based position of the prompt in the input
+	ID     string `json:"id,omitempty"` // Caller-supplied identifier, if any
+	Prompt string `json:"prompt"`
+}
+
+// Reader yields prompts from a JSONL or CSV stream
+type Reader interface {
+	// Next returns the next item, or io.EOF when the input is exhausted.
+	// Malformed lines are returned as an item with a non-nil error so the
+	// caller can record them without stopping the run.
+	Next() (Item, error)
+}
+
+// NewReader creates a reader for the given format. promptField and idField
+// name the JSON key or CSV column holding the prompt and optional ID.
+func NewReader(r io.Reader, format, promptField, idField string) (Reader, error) {
+	switch format {
+	case FormatJSONL:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		return &jsonlReader{scanner: scanner, promptField: promptField, idField: idField}, nil
+	case FormatCSV:
+		return newCSVReader(r, promptField, idField)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+}
+
+// jsonlReader reads one JSON object per line
+type jsonlReader struct {
+	scanner     *bufio.Scanner
+	line        int
+	promptField string
+	idField     string
+}
+
+// Next returns the next non-blank line as an item
+func (r *jsonlReader) Next() (Item, error) {
+	for r.scanner.Scan() {
+		r.line++
+		text := r.scanner.Bytes()
+		if len(text) == 0 {
+			continue
+		}
+
+		item := Item{Line: r.line}
+		var fields map[string]any
+		if err := json.Unmarshal(text, &fields); err != nil {
+			return item, fmt.Errorf("invalid JSON: %w", err)
+		}
+		item.ID = stringField(fields[r.idField])
+		item.Prompt = stringField(fields[r.promptField])
+		return item, nil
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return Item{}, err
+	}
+	return Item{}, io.EOF
+}
+
+// csvReader reads prompts from a CSV file with a header row
+type csvReader struct {
+	reader    *csv.Reader
+	line      int
+	promptCol int
+	idCol     int
+}
+
+// newCSVReader reads the header row and locates the prompt and ID columns
+func newCSVReader(r io.Reader, promptField, idField string) (*csvReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV header: %w", err)
+	}
+
+	c := &csvReader{reader: reader, promptCol: -1, idCol: -1}
+	for i, name := range header {
+		switch name {
+		case promptField:
+			c.promptCol = i
+		case idField:
+			c.idCol = i
+		}
+	}
+	if c.promptCol < 0 {
+		return nil, fmt.Errorf("%w: %s", ErrMissingColumn, promptField)
+	}
+
+	return c, nil
+}
+
+// Next returns the next CSV row as an item
+func (r *csvReader) Next() (Item, error) {
+	record, err := r.reader.Read()
+	if err == io.EOF {
+		return Item{}, io.EOF
+	}
+	r.line++
+	item := Item{Line: r.line}
+	if err != nil {
+		return item, fmt.Errorf("invalid CSV row: %w", err)
+	}
+
+	if r.promptCol < len(record) {
+		item.Prompt = record[r.promptCol]
+	}
+	if r.idCol >= 0 && r.idCol < len(record) {
+		item.ID = record[r.idCol]
+	}
+	return item, nil
+}
+
+// stringField converts a decoded JSON value to a string
+func stringField(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// sliceReader yields items from memory
+type sliceReader struct {
+	items []Item
+	next  int
+}
+
+// NewSliceReader creates a reader over in-memory items, numbering them by
+// position when they have no line set
+func NewSliceReader(items []Item) Reader {
+	for i := range items {
+		if items[i].Line == 0 {
+			items[i].Line = i + 1
+		}
+	}
+	return &sliceReader{items: items}
+}
+
+// Next returns the next item
+func (r *sliceReader) Next() (Item, error) {
+	if r.next >= len(r.items) {
+		return Item{}, io.EOF
+	}
+	item := r.items[r.next]
+	r.next++
+	return item, nil
+}
@@ -0,0 +1,53 @@
+package batch
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// LoadCompleted reads the results already written to an output file and
+// returns the set of completed input lines. A trailing partial line left by an
+// interrupted write is truncated so appended results start on a clean line.
+// A missing file yields an empty set.
+func LoadCompleted(path string) (map[int]bool, error) {
+	completed := make(map[int]bool)
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return completed, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening output: %w", err)
+	}
+	defer file.Close()
+
+	// Scan complete result lines, tracking the end of the last good one
+	reader := bufio.NewReader(file)
+	var goodEnd int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading output: %w", err)
+		}
+
+		var result Result
+		if err := json.Unmarshal(line, &result); err != nil || result.Line == 0 {
+			break
+		}
+		completed[result.Line] = true
+		goodEnd += int64(len(line))
+	}
+
+	// Drop anything after the last complete result
+	if err := file.Truncate(goodEnd); err != nil {
+		return nil, fmt.Errorf("error truncating output: %w", err)
+	}
+
+	return completed, nil
+}
@@ -0,0 +1,188 @@
+package batch
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/cache"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/llm"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/prompt"
+)
+
+// Result is the outcome of analyzing one item
+type Result struct {
+	Line       int                 `json:"line"`
+	ID         string              `json:"id,omitempty"`
+	Provider   string              `json:"provider"`
+	Analysis   *llm.PromptAnalysis `json:"analysis,omitempty"`
+	Latency    int64               `json:"latency"`              // Response latency in milliseconds
+	Usage      *llm.Usage          `json:"usage,omitempty"`      // Tokens reported by the provider
+	CostUSD    *float64            `json:"costUsd,omitempty"`    // Priced from the pricing table, for server jobs
+	Cached     bool                `json:"cached,omitempty"`     // The analysis was reused from the cache
+	Similarity *float64            `json:"similarity,omitempty"` // Similarity of the near-duplicate the analysis was reused from
+	Error      string              `json:"error,omitempty"`
+}
+
+// Stats summarises a batch run
+type Stats struct {
+	Processed int `json:"processed"` // Items analyzed successfully
+	Failed    int `json:"failed"`    // Items that produced a per-line error
+	Skipped   int `json:"skipped"`   // Items already completed in a previous run
+}
+
+// Options controls a batch run
+type Options struct {
+	Concurrency int          // Number of prompts analyzed in parallel
+	Completed   map[int]bool // Lines finished by a previous run, which are skipped
+	Cache       *cache.Cache // Reuses analyses of duplicate prompts; may be nil
+}
+
+// Run analyzes every item from the reader with the provider and passes each
+// result to write, in completion order. When the context is cancelled, no new
+// items are started and in-flight items are dropped rather than recorded as
+// failures, so a resumed run picks them up again.
+func Run(ctx context.Context, provider llm.LLM, reader Reader, opts Options, write func(Result) error) (Stats, error) {
+	var stats Stats
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	items := make(chan Item)
+	results := make(chan Result)
+
+	// Feed items to the workers, skipping completed lines
+	var readErr error
+	go func() {
+		defer close(items)
+		for {
+			item, err := reader.Next()
+			if err == io.EOF {
+				return
+			}
+			if err != nil && item.Line == 0 {
+				readErr = err
+				cancel()
+				return
+			}
+			if opts.Completed[item.Line] {
+				stats.Skipped++
+				continue
+			}
+			if err != nil {
+				// Record malformed lines without calling the provider
+				select {
+				case results <- Result{Line: item.Line, ID: item.ID, Provider: provider.Name(), Error: err.Error()}:
+				case <-ctx.Done():
+					return
+				}
+				continue
+			}
+			select {
+			case items <- item:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// Analyze items in parallel
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range items {
+				result, ok := analyzeItem(ctx, provider, opts.Cache, item)
+				if !ok {
+					continue
+				}
+				select {
+				case results <- result:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	// Close the results channel once the feeder and all workers are done
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Write results from a single goroutine
+	var writeErr error
+	for result := range results {
+		if writeErr != nil {
+			continue
+		}
+		if err := write(result); err != nil {
+			writeErr = err
+			cancel()
+			continue
+		}
+		if result.Error != "" {
+			stats.Failed++
+		} else {
+			stats.Processed++
+		}
+	}
+
+	switch {
+	case writeErr != nil:
+		return stats, writeErr
+	case readErr != nil:
+		return stats, readErr
+	default:
+		return stats, ctx.Err()
+	}
+}
+
+// analyzeItem analyzes a single item, reusing a cached analysis when there
+// is one. It reports false when the analysis was interrupted by cancellation
+// and should not be recorded.
+func analyzeItem(ctx context.Context, provider llm.LLM, c *cache.Cache, item Item) (Result, bool) {
+	result := Result{
+		Line:     item.Line,
+		ID:       item.ID,
+		Provider: provider.Name(),
+	}
+
+	// Validate input
+	req := prompt.Request{Prompt: item.Prompt}
+	if err := req.Validate(); err != nil {
+		result.Error = err.Error()
+		return result, true
+	}
+
+	// Analyze the prompt
+	ctx, usage := llm.WithUsage(ctx)
+	startTime := time.Now()
+	analysis, hit, err := c.Analyze(ctx, provider, item.Prompt)
+	result.Latency = time.Since(startTime).Milliseconds()
+	if hit != nil {
+		result.Cached = true
+		if !hit.Exact {
+			result.Similarity = &hit.Similarity
+		}
+	}
+	if usage.Total() > 0 {
+		result.Usage = usage
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return result, false
+		}
+		result.Error = err.Error()
+		return result, true
+	}
+
+	result.Analysis = analysis
+	return result, true
+}
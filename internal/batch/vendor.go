@@ -0,0 +1,250 @@
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/llm"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/prompt"
+)
+
+// defaultVendorChunk is the number of prompts sent per vendor batch when unset
+const defaultVendorChunk = 10000
+
+// VendorOptions controls a vendor batch run
+type VendorOptions struct {
+	ChunkSize    int           // Prompts per vendor batch
+	PollInterval time.Duration // Time between status checks of a vendor batch
+	StatePath    string        // File recording the vendor batch in progress; empty disables resuming it
+}
+
+// vendorState records a submitted vendor batch until its results are written,
+// so an interrupted run polls it again instead of paying for a new one. It
+// holds input line numbers and IDs only, never prompts.
+type vendorState struct {
+	Provider string       `json:"provider"`
+	BatchID  string       `json:"batchId"`
+	Items    []vendorItem `json:"items"`
+}
+
+// vendorItem is an input line submitted in a vendor batch
+type vendorItem struct {
+	Line int    `json:"line"`
+	ID   string `json:"id,omitempty"`
+}
+
+// RunVendor analyzes every item through the provider's discounted vendor
+// batch API instead of realtime calls. Items are submitted ChunkSize at a
+// time, and each chunk's results are written once the vendor batch ends.
+// With a StatePath, a vendor batch left running by an interrupted run is
+// polled and its results written before any new batch is submitted.
+// Latency is not recorded for vendor batches.
+func RunVendor(ctx context.Context, provider llm.BatchLLM, reader Reader, opts Options, vopts VendorOptions, write func(Result) error) (Stats, error) {
+	var stats Stats
+	if vopts.ChunkSize < 1 {
+		vopts.ChunkSize = defaultVendorChunk
+	}
+
+	// writeResult writes a result and updates the counters
+	written := make(map[int]bool)
+	writeResult := func(result Result) error {
+		if err := write(result); err != nil {
+			return err
+		}
+		written[result.Line] = true
+		if result.Error != "" {
+			stats.Failed++
+		} else {
+			stats.Processed++
+		}
+		return nil
+	}
+
+	// Finish the vendor batch a previous run left behind
+	state, err := loadVendorState(vopts.StatePath)
+	if err != nil {
+		return stats, err
+	}
+	if state != nil {
+		if state.Provider != provider.Name() {
+			return stats, fmt.Errorf("a %s vendor batch is still in progress for this output; rerun with that provider", state.Provider)
+		}
+		if err := awaitChunk(ctx, provider, state, vopts, opts.Completed, writeResult); err != nil {
+			return stats, err
+		}
+	}
+
+	chunk := make([]Item, 0, vopts.ChunkSize)
+	for {
+		item, err := reader.Next()
+		eof := err == io.EOF
+		switch {
+		case eof:
+		case err != nil && item.Line == 0:
+			return stats, err
+		case written[item.Line]:
+			continue
+		case opts.Completed[item.Line]:
+			stats.Skipped++
+			continue
+		case err != nil:
+			// Record malformed lines without sending them to the vendor
+			if err := writeResult(Result{Line: item.Line, ID: item.ID, Provider: provider.Name(), Error: err.Error()}); err != nil {
+				return stats, err
+			}
+			continue
+		default:
+			// Record empty prompts without sending them to the vendor
+			req := prompt.Request{Prompt: item.Prompt}
+			if err := req.Validate(); err != nil {
+				if err := writeResult(Result{Line: item.Line, ID: item.ID, Provider: provider.Name(), Error: err.Error()}); err != nil {
+					return stats, err
+				}
+				continue
+			}
+			chunk = append(chunk, item)
+		}
+
+		// Submit a full chunk, or whatever is left at the end of the input
+		if len(chunk) == vopts.ChunkSize || (eof && len(chunk) > 0) {
+			state, err := submitChunk(ctx, provider, chunk, vopts.StatePath)
+			if err != nil {
+				return stats, err
+			}
+			if err := awaitChunk(ctx, provider, state, vopts, nil, writeResult); err != nil {
+				return stats, err
+			}
+			chunk = chunk[:0]
+		}
+
+		if eof {
+			return stats, nil
+		}
+	}
+}
+
+// submitChunk submits one vendor batch and records it in the state file
+func submitChunk(ctx context.Context, provider llm.BatchLLM, chunk []Item, statePath string) (*vendorState, error) {
+	// Use the input line as the vendor's custom ID
+	state := &vendorState{Provider: provider.Name(), Items: make([]vendorItem, len(chunk))}
+	prompts := make([]llm.BatchPrompt, len(chunk))
+	for i, item := range chunk {
+		state.Items[i] = vendorItem{Line: item.Line, ID: item.ID}
+		prompts[i] = llm.BatchPrompt{CustomID: customID(item.Line), Prompt: item.Prompt}
+	}
+
+	batchID, err := provider.SubmitBatch(ctx, prompts)
+	if err != nil {
+		return nil, err
+	}
+	state.BatchID = batchID
+
+	if err := saveVendorState(statePath, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// awaitChunk polls a vendor batch until it ends, writes a result for every
+// item not already completed, then clears the state file. A batch the vendor
+// reports as failed is cleared too, so the next run submits its items again.
+func awaitChunk(ctx context.Context, provider llm.BatchLLM, state *vendorState, vopts VendorOptions, completed map[int]bool, writeResult func(Result) error) error {
+	customIDs := make([]string, len(state.Items))
+	for i, item := range state.Items {
+		customIDs[i] = customID(item.Line)
+	}
+
+	batchResults, err := llm.AwaitBatch(ctx, provider, state.BatchID, customIDs, vopts.PollInterval)
+	if err != nil {
+		if errors.Is(err, llm.ErrBatchFailed) {
+			removeVendorState(vopts.StatePath)
+		}
+		return err
+	}
+
+	for _, item := range state.Items {
+		if completed[item.Line] {
+			continue
+		}
+		batchResult := batchResults[customID(item.Line)]
+		result := Result{
+			Line:     item.Line,
+			ID:       item.ID,
+			Provider: provider.Name(),
+			Analysis: batchResult.Analysis,
+		}
+		if batchResult.Usage.Total() > 0 {
+			result.Usage = &batchResult.Usage
+		}
+		if batchResult.Err != nil {
+			result.Analysis = nil
+			result.Error = batchResult.Err.Error()
+		}
+		if err := writeResult(result); err != nil {
+			return err
+		}
+	}
+
+	return removeVendorState(vopts.StatePath)
+}
+
+// loadVendorState reads the state file; a missing file yields nil
+func loadVendorState(path string) (*vendorState, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading vendor batch state: %w", err)
+	}
+
+	var state vendorState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("error parsing vendor batch state %s: %w", path, err)
+	}
+	return &state, nil
+}
+
+// saveVendorState atomically replaces the state file
+func saveVendorState(path string, state *vendorState) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("error encoding vendor batch state: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("error writing vendor batch state: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("error writing vendor batch state: %w", err)
+	}
+	return nil
+}
+
+// removeVendorState deletes the state file once its batch is finished
+func removeVendorState(path string) error {
+	if path == "" {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing vendor batch state: %w", err)
+	}
+	return nil
+}
+
+// customID builds the vendor custom ID for an input line
+func customID(line int) string {
+	return fmt.Sprintf("line-%d", line)
+}
@@ -0,0 +1,141 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/llm"
+)
+
+// fakeBatchLLM is a vendor batch provider whose batches end when ended is set
+type fakeBatchLLM struct {
+	mu        sync.Mutex
+	submitted [][]llm.BatchPrompt
+	ended     bool
+}
+
+func (f *fakeBatchLLM) Name() string      { return "Fake" }
+func (f *fakeBatchLLM) Model() string     { return "fake-1" }
+func (f *fakeBatchLLM) IsAvailable() bool { return true }
+
+func (f *fakeBatchLLM) AnalyzePrompt(ctx context.Context, promptText string) (*llm.PromptAnalysis, error) {
+	return nil, errors.New("realtime calls are not supported")
+}
+
+func (f *fakeBatchLLM) SubmitBatch(ctx context.Context, prompts []llm.BatchPrompt) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.submitted = append(f.submitted, prompts)
+	return "batch-1", nil
+}
+
+func (f *fakeBatchLLM) BatchResults(ctx context.Context, batchID string) (map[string]llm.BatchResult, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.ended {
+		return nil, false, nil
+	}
+	results := make(map[string]llm.BatchResult)
+	for _, p := range f.submitted[len(f.submitted)-1] {
+		results[p.CustomID] = llm.BatchResult{
+			Analysis: &llm.PromptAnalysis{PromptType: "content", RiskScore: 1},
+			Usage:    llm.Usage{InputTokens: 10, OutputTokens: 5},
+		}
+	}
+	return results, true, nil
+}
+
+const vendorInput = `{"id":"a","prompt":"first prompt"}
+{"id":"b","prompt":"second prompt"}
+{"id":"c","prompt":""}
+`
+
+func TestRunVendorResumesSubmittedBatch(t *testing.T) {
+	provider := &fakeBatchLLM{}
+	statePath := filepath.Join(t.TempDir(), "out.jsonl.vendor.json")
+	vopts := VendorOptions{ChunkSize: 10, PollInterval: time.Millisecond, StatePath: statePath}
+
+	var results []Result
+	write := func(result Result) error {
+		results = append(results, result)
+		return nil
+	}
+
+	// The first run is interrupted while the vendor batch is running
+	reader, err := NewReader(strings.NewReader(vendorInput), FormatJSONL, "prompt", "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := RunVendor(ctx, provider, reader, Options{}, vopts, write); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if _, err := os.Stat(statePath); err != nil {
+		t.Fatalf("state file not kept: %v", err)
+	}
+
+	// The empty prompt was recorded without being submitted
+	completed := make(map[int]bool)
+	for _, result := range results {
+		completed[result.Line] = true
+	}
+	if len(results) != 1 || results[0].ID != "c" || results[0].Error == "" {
+		t.Fatalf("first run results = %+v", results)
+	}
+
+	// The resumed run polls the same batch instead of submitting a new one
+	provider.ended = true
+	results = nil
+	reader, err = NewReader(strings.NewReader(vendorInput), FormatJSONL, "prompt", "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := RunVendor(context.Background(), provider, reader, Options{Completed: completed}, vopts, write)
+	if err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	if len(provider.submitted) != 1 {
+		t.Errorf("submitted %d batches, want 1", len(provider.submitted))
+	}
+	if stats.Processed != 2 || stats.Failed != 0 || stats.Skipped != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+	if len(results) != 2 || results[0].ID != "a" || results[1].ID != "b" {
+		t.Fatalf("resumed results = %+v", results)
+	}
+	for _, result := range results {
+		if result.Usage == nil || result.Usage.Total() != 15 {
+			t.Errorf("line %d usage = %+v, want 15 tokens", result.Line, result.Usage)
+		}
+	}
+	if _, err := os.Stat(statePath); !os.IsNotExist(err) {
+		t.Errorf("state file not removed: %v", err)
+	}
+}
+
+func TestRunVendorRejectsOtherProviderBatch(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "out.jsonl.vendor.json")
+	if err := saveVendorState(statePath, &vendorState{Provider: "Claude", BatchID: "msgbatch_1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := NewReader(strings.NewReader(vendorInput), FormatJSONL, "prompt", "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &fakeBatchLLM{}
+	vopts := VendorOptions{StatePath: statePath}
+	if _, err := RunVendor(context.Background(), provider, reader, Options{}, vopts, func(Result) error { return nil }); err == nil {
+		t.Fatal("expected an error for another provider's batch")
+	}
+	if len(provider.submitted) != 0 {
+		t.Errorf("submitted %d batches, want 0", len(provider.submitted))
+	}
+}
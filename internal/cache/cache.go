@@ -0,0 +1,206 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/llm"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/metrics"
+)
+
+// keyVersion is mixed into every key so a change to the key layout or the
+// stored analysis does not reuse old entries
+const keyVersion = "v2"
+
+// defaultMaxEntries is used when cache.max_entries is unset
+const defaultMaxEntries = 10000
+
+// Entry is a cached analysis
+type Entry struct {
+	Analysis  llm.PromptAnalysis `json:"analysis"`
+	ExpiresAt time.Time          `json:"expiresAt,omitzero"` // Zero never expires
+}
+
+// expired reports whether the entry has outlived its TTL
+func (e *Entry) expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && now.After(e.ExpiresAt)
+}
+
+// Backend stores cache entries by key
+type Backend interface {
+	// Get returns the entry for the key, if it is present and unexpired
+	Get(key string) (*Entry, bool)
+
+	// Put inserts or replaces the entry for the key
+	Put(key string, e *Entry)
+
+	// Delete removes the entry for the key, if any
+	Delete(key string)
+}
+
+// Hit describes an analysis served from the cache
+type Hit struct {
+	Exact      bool    // The prompt itself was cached, not a near-duplicate
+	Similarity float64 // Cosine similarity to the cached prompt, 1 when exact
+}
+
+// Cache reuses analyses of prompts already analyzed for the same tenant with
+// the same provider, model and system prompt, and optionally of
+// near-duplicate prompts. A nil *Cache is valid and caches nothing.
+type Cache struct {
+	backend      Backend
+	similar      *similarIndex // Nil unless near-duplicate matching is enabled
+	ttl          time.Duration
+	systemPrompt string // Configured system prompt; tenants may override it
+}
+
+// New creates the configured cache. It returns nil when caching is disabled.
+func New(cfg *config.Config) (*Cache, error) {
+	if !cfg.Cache.Enabled {
+		return nil, nil
+	}
+
+	c := &Cache{ttl: cfg.Cache.TTL, systemPrompt: cfg.Analysis.SystemPrompt}
+	switch cfg.Cache.Backend {
+	case "", "memory":
+		size := cfg.Cache.MaxEntries
+		if size <= 0 {
+			size = defaultMaxEntries
+		}
+		c.backend = NewMemory(size)
+	case "file":
+		backend, err := NewFile(cfg.Cache.Path)
+		if err != nil {
+			return nil, err
+		}
+		c.backend = backend
+	default:
+		return nil, fmt.Errorf("unknown cache backend: %s", cfg.Cache.Backend)
+	}
+
+	if sim := cfg.Cache.Similarity; sim.Enabled {
+		index, err := newSimilarIndex(sim.Threshold, sim.MaxEntries)
+		if err != nil {
+			return nil, err
+		}
+		c.similar = index
+	}
+	return c, nil
+}
+
+// bypassKey marks a context whose analyses skip the cache lookup
+type bypassKey struct{}
+
+// WithBypass returns a context whose analyses skip the cache lookup. Fresh
+// results still replace the cached entry.
+func WithBypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassKey{}, true)
+}
+
+// scopeKey identifies the tenant an analysis was made for and the provider,
+// model and system prompt it was made with; only analyses in the same scope
+// are reused
+func scopeKey(tenant, provider, model, systemPrompt string) string {
+	return hashParts(keyVersion, tenant, provider, model, systemPrompt)
+}
+
+// entryKey returns the cache key for a prompt in a scope. Runs of whitespace
+// in the prompt are collapsed and its ends trimmed, so reformatted copies
+// share an entry.
+func entryKey(scope, promptText string) string {
+	return hashParts(scope, Normalize(promptText))
+}
+
+// hashParts returns the hex SHA-256 digest of the parts, each terminated by
+// a zero byte
+func hashParts(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Normalize trims the prompt and collapses each run of whitespace to a
+// single space
+func Normalize(promptText string) string {
+	return strings.Join(strings.Fields(promptText), " ")
+}
+
+// Analyze returns the cached analysis of the prompt or of a near-duplicate,
+// or analyzes it with the provider and caches the result. The hit is nil
+// when the provider was called. Failed analyses are not cached.
+func (c *Cache) Analyze(ctx context.Context, provider llm.LLM, promptText string) (*llm.PromptAnalysis, *Hit, error) {
+	if c == nil {
+		analysis, err := provider.AnalyzePrompt(ctx, promptText)
+		return analysis, nil, err
+	}
+
+	providerID := llm.ProviderID(provider)
+	scope, key := c.keys(ctx, provider, promptText)
+	var vec vector
+	var f flags
+	if c.similar != nil {
+		vec, f = c.similar.probe(ctx, promptText)
+	}
+
+	// Look the prompt up unless the caller asked for a fresh analysis
+	if bypass, _ := ctx.Value(bypassKey{}).(bool); bypass {
+		metrics.CacheLookups.WithLabelValues(providerID, "bypass").Inc()
+	} else if e, ok := c.backend.Get(key); ok {
+		metrics.CacheLookups.WithLabelValues(providerID, "hit").Inc()
+		analysis := e.Analysis
+		return &analysis, &Hit{Exact: true, Similarity: 1}, nil
+	} else if e, score, ok := c.similar.find(scope, vec, f); ok {
+		metrics.CacheLookups.WithLabelValues(providerID, "similar").Inc()
+		analysis := e.Analysis
+		return &analysis, &Hit{Similarity: score}, nil
+	} else {
+		metrics.CacheLookups.WithLabelValues(providerID, "miss").Inc()
+	}
+
+	analysis, err := provider.AnalyzePrompt(ctx, promptText)
+	if err != nil {
+		return nil, nil, err
+	}
+	e := &Entry{Analysis: *analysis}
+	if c.ttl > 0 {
+		e.ExpiresAt = time.Now().Add(c.ttl)
+	}
+	c.backend.Put(key, e)
+	c.similar.add(scope, key, vec, f, e)
+	return analysis, nil, nil
+}
+
+// keys returns the scope and entry key of a prompt analyzed for the
+// context's tenant with its model and system prompt
+func (c *Cache) keys(ctx context.Context, provider llm.LLM, promptText string) (string, string) {
+	scope := scopeKey(llm.TenantFor(ctx), llm.ProviderID(provider), llm.ModelFor(ctx, provider), llm.SystemPromptFor(ctx, c.systemPrompt))
+	return scope, entryKey(scope, promptText)
+}
+
+// Key returns the key Analyze caches the prompt's analysis under, so it can
+// be forgotten when the analysis is deleted. A nil *Cache returns "".
+func (c *Cache) Key(ctx context.Context, provider llm.LLM, promptText string) string {
+	if c == nil {
+		return ""
+	}
+	_, key := c.keys(ctx, provider, promptText)
+	return key
+}
+
+// Forget removes the entry for a key returned by Key, and the prompt's
+// near-duplicate index entry. A nil *Cache or an empty key is ignored.
+func (c *Cache) Forget(key string) {
+	if c == nil || key == "" {
+		return
+	}
+	c.backend.Delete(key)
+	c.similar.remove(key)
+}
@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/llm"
+)
+
+// countingLLM answers every prompt and counts the calls that reach it
+type countingLLM struct {
+	calls atomic.Int32
+}
+
+func (p *countingLLM) Name() string      { return "Counting" }
+func (p *countingLLM) Model() string     { return "counting-1" }
+func (p *countingLLM) IsAvailable() bool { return true }
+func (p *countingLLM) AnalyzePrompt(ctx context.Context, promptText string) (*llm.PromptAnalysis, error) {
+	p.calls.Add(1)
+	return &llm.PromptAnalysis{TokenCount: len(promptText), PromptType: "coding", RiskScore: 1}, nil
+}
+
+func TestMemoryEvictsLeastRecentlyUsed(t *testing.T) {
+	m := NewMemory(2)
+	m.Put("a", &Entry{})
+	m.Put("b", &Entry{})
+
+	// Reading a makes b the least recently used
+	if _, ok := m.Get("a"); !ok {
+		t.Fatal("a missing")
+	}
+	m.Put("c", &Entry{})
+
+	if _, ok := m.Get("b"); ok {
+		t.Error("b was not evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := m.Get(key); !ok {
+			t.Errorf("%s was evicted", key)
+		}
+	}
+}
+
+func TestFileBackendSurvivesReopen(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Cache.Enabled = true
+	cfg.Cache.Backend = "file"
+	cfg.Cache.Path = t.TempDir()
+	provider := &countingLLM{}
+
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, hit, err := c.Analyze(context.Background(), provider, "Write a sort function"); err != nil || hit != nil {
+		t.Fatalf("first analysis: hit %v, err %v", hit, err)
+	}
+
+	// A new cache over the same directory, as after a restart
+	reopened, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	analysis, hit, err := reopened.Analyze(context.Background(), provider, "  Write a   sort function ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hit == nil || !hit.Exact || analysis.PromptType != "coding" {
+		t.Errorf("after reopening: analysis %+v, hit %+v, want an exact hit", analysis, hit)
+	}
+	if calls := provider.calls.Load(); calls != 1 {
+		t.Errorf("provider called %d times, want 1", calls)
+	}
+}
+
+func TestCacheKeysSeparateTenants(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Cache.Enabled = true
+	cfg.Cache.Similarity.Enabled = true
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &countingLLM{}
+	acme := llm.WithOverrides(context.Background(), &llm.Overrides{Tenant: "acme"})
+	globex := llm.WithOverrides(context.Background(), &llm.Overrides{Tenant: "globex"})
+	const promptText = "Summarize the quarterly report for the board"
+
+	if c.Key(acme, provider, promptText) == c.Key(globex, provider, promptText) {
+		t.Fatal("tenants share a cache key")
+	}
+
+	// Neither an exact nor a near-duplicate match crosses tenants
+	for _, ctx := range []context.Context{acme, globex, context.Background()} {
+		if _, hit, err := c.Analyze(ctx, provider, promptText); err != nil || hit != nil {
+			t.Errorf("first analysis for a tenant: hit %+v, err %v", hit, err)
+		}
+	}
+	if _, hit, _ := c.Analyze(acme, provider, promptText+"!"); hit == nil {
+		t.Error("near-duplicate within a tenant was not reused")
+	}
+	if calls := provider.calls.Load(); calls != 3 {
+		t.Errorf("provider called %d times, want 3", calls)
+	}
+}
@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// File is an on-disk backend storing one JSON file per entry, so cached
+// analyses survive restarts and can be shared by CLI runs. Entries are
+// spread over subdirectories named by the first two characters of the key.
+type File struct {
+	dir string
+}
+
+// NewFile opens the cache directory, creating it if needed, and removes
+// expired entries left by earlier runs
+func NewFile(dir string) (*File, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("cache path not set")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	f := &File{dir: dir}
+	f.sweep()
+	return f, nil
+}
+
+// Get reads the entry for the key, deleting it if it has expired
+func (f *File) Get(key string) (*Entry, bool) {
+	path := f.path(key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	var e Entry
+	if err := json.Unmarshal(data, &e); err != nil || e.expired(time.Now()) {
+		os.Remove(path)
+		return nil, false
+	}
+	return &e, true
+}
+
+// Put atomically writes the entry for the key. Failures are logged; the
+// analysis is simply not cached.
+func (f *File) Put(key string, e *Entry) {
+	if err := f.write(key, e); err != nil {
+		slog.Error("failed to write cache entry", "error", err.Error())
+	}
+}
+
+// Delete removes the entry's file. Failures are logged.
+func (f *File) Delete(key string) {
+	if err := os.Remove(f.path(key)); err != nil && !os.IsNotExist(err) {
+		slog.Error("failed to delete cache entry", "error", err.Error())
+	}
+}
+
+// write saves the entry to a temporary file and renames it into place
+func (f *File) write(key string, e *Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache entry: %w", err)
+	}
+	path := f.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	return nil
+}
+
+// path returns the file holding the entry for the key
+func (f *File) path(key string) string {
+	return filepath.Join(f.dir, key[:2], key+".json")
+}
+
+// sweep removes expired and unreadable entries
+func (f *File) sweep() {
+	now := time.Now()
+	removed := 0
+	filepath.WalkDir(f.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".json") {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		var e Entry
+		if json.Unmarshal(data, &e) != nil || e.expired(now) {
+			if os.Remove(path) == nil {
+				removed++
+			}
+		}
+		return nil
+	})
+	if removed > 0 {
+		slog.Info("removed expired cache entries", "removed", removed)
+	}
+}
@@ -0,0 +1,200 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/detect"
+)
+
+// defaultThreshold is used when cache.similarity.threshold is unset
+const defaultThreshold = 0.9
+
+// vector is a sparse, L2-normalized embedding, sorted by index
+type vector struct {
+	idx []uint32
+	val []float32
+}
+
+// embed computes a local embedding of the prompt: a hashing vectorizer over
+// character trigrams of the lowercased prompt, with whitespace collapsed and
+// every run of digits replaced by a single 0. Prompts that differ only in
+// numbers or spacing embed identically, and ones that differ in a name or a
+// few words stay close.
+func embed(promptText string) vector {
+	var b strings.Builder
+	b.WriteByte(' ')
+	inDigits := false
+	for _, r := range strings.ToLower(Normalize(promptText)) {
+		if unicode.IsDigit(r) {
+			if !inDigits {
+				b.WriteByte('0')
+			}
+			inDigits = true
+			continue
+		}
+		inDigits = false
+		b.WriteRune(r)
+	}
+	b.WriteByte(' ')
+	runes := []rune(b.String())
+
+	counts := make(map[uint32]float32)
+	for i := 0; i+3 <= len(runes); i++ {
+		h := fnv.New32a()
+		h.Write([]byte(string(runes[i : i+3])))
+		counts[h.Sum32()]++
+	}
+
+	v := vector{idx: make([]uint32, 0, len(counts)), val: make([]float32, len(counts))}
+	for i := range counts {
+		v.idx = append(v.idx, i)
+	}
+	sort.Slice(v.idx, func(i, j int) bool { return v.idx[i] < v.idx[j] })
+	var norm float64
+	for _, c := range counts {
+		norm += float64(c * c)
+	}
+	norm = math.Sqrt(norm)
+	for n, i := range v.idx {
+		v.val[n] = float32(float64(counts[i]) / norm)
+	}
+	return v
+}
+
+// cosine returns the cosine similarity of two normalized vectors
+func cosine(a, b vector) float64 {
+	var dot float64
+	for i, j := 0, 0; i < len(a.idx) && j < len(b.idx); {
+		switch {
+		case a.idx[i] < b.idx[j]:
+			i++
+		case a.idx[i] > b.idx[j]:
+			j++
+		default:
+			dot += float64(a.val[i] * b.val[j])
+			i++
+			j++
+		}
+	}
+	return dot
+}
+
+// flags are the local detector results a near-duplicate must share
+type flags struct {
+	pii, suspicious bool
+}
+
+// similarItem is one analyzed prompt in the similarity index
+type similarItem struct {
+	scope string // Tenant, provider, model and system prompt, as in the cache key
+	key   string // Exact cache key of the prompt
+	vec   vector
+	flags flags
+	entry *Entry
+}
+
+// similarIndex finds the closest previously analyzed prompt. It is a linear
+// scan over at most size prompts, evicting the oldest, and is held in memory
+// only.
+type similarIndex struct {
+	threshold float64
+	size      int
+	detectors []detect.Detector
+
+	mu    sync.Mutex
+	items *list.List // Newest at the front
+}
+
+// newSimilarIndex creates an index matching prompts at or above threshold
+func newSimilarIndex(threshold float64, size int) (*similarIndex, error) {
+	detectors, err := detect.Load(nil)
+	if err != nil {
+		return nil, err
+	}
+	if threshold <= 0 {
+		threshold = defaultThreshold
+	}
+	if size <= 0 {
+		size = defaultMaxEntries
+	}
+	return &similarIndex{threshold: threshold, size: size, detectors: detectors, items: list.New()}, nil
+}
+
+// probe embeds the prompt and runs the local detectors over it
+func (s *similarIndex) probe(ctx context.Context, promptText string) (vector, flags) {
+	report := detect.Run(ctx, s.detectors, promptText)
+	return embed(promptText), flags{report.ContainsPII, report.IsSuspicious}
+}
+
+// find returns the most similar unexpired entry in the scope with the same
+// detector flags, and its similarity, if it reaches the threshold. A nil
+// index finds nothing.
+func (s *similarIndex) find(scope string, vec vector, f flags) (*Entry, float64, bool) {
+	if s == nil {
+		return nil, 0, false
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var best *Entry
+	bestScore := 0.0
+	for el := s.items.Front(); el != nil; {
+		next := el.Next()
+		item := el.Value.(*similarItem)
+		switch {
+		case item.entry.expired(now):
+			s.items.Remove(el)
+		case item.scope == scope && item.flags == f:
+			if score := cosine(vec, item.vec); score > bestScore {
+				best, bestScore = item.entry, score
+			}
+		}
+		el = next
+	}
+	if best == nil || bestScore < s.threshold {
+		return nil, 0, false
+	}
+	return best, min(bestScore, 1), true
+}
+
+// add indexes an analyzed prompt, evicting the oldest when the index is
+// full. A nil index ignores it.
+func (s *similarIndex) add(scope, key string, vec vector, f flags, e *Entry) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.items.PushFront(&similarItem{scope: scope, key: key, vec: vec, flags: f, entry: e})
+	if s.items.Len() > s.size {
+		s.items.Remove(s.items.Back())
+	}
+}
+
+// remove drops the prompts indexed under the exact cache key. A nil index
+// ignores it.
+func (s *similarIndex) remove(key string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for el := s.items.Front(); el != nil; {
+		next := el.Next()
+		if el.Value.(*similarItem).key == key {
+			s.items.Remove(el)
+		}
+		el = next
+	}
+}
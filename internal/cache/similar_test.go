@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSimilarThresholdBoundary(t *testing.T) {
+	cached := embed("Write a Python function that reverses a string")
+	probe := embed("Write a Python function that reverses a list")
+	score := cosine(cached, probe)
+	if score <= 0 || score >= 1 {
+		t.Fatalf("similarity = %v, want a near-duplicate below 1", score)
+	}
+
+	tests := []struct {
+		name      string
+		threshold float64
+		want      bool
+	}{
+		{"below the score", score - 0.01, true},
+		{"equal to the score", score, true},
+		{"just above the score", math.Nextafter(score, 1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index, err := newSimilarIndex(tt.threshold, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			entry := &Entry{}
+			index.add("scope", "key", cached, flags{}, entry)
+
+			got, similarity, ok := index.find("scope", probe, flags{})
+			if ok != tt.want {
+				t.Fatalf("found = %v at threshold %v (score %v), want %v", ok, tt.threshold, score, tt.want)
+			}
+			if ok && (got != entry || similarity != score) {
+				t.Errorf("find = %p, %v, want %p, %v", got, similarity, entry, score)
+			}
+		})
+	}
+}
+
+func TestSimilarRequiresScopeAndFlags(t *testing.T) {
+	index, err := newSimilarIndex(0.5, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vec := embed("Summarize the quarterly report for the board")
+	index.add("acme", "key", vec, flags{}, &Entry{})
+
+	if _, _, ok := index.find("globex", vec, flags{}); ok {
+		t.Error("matched a prompt from another scope")
+	}
+	if _, _, ok := index.find("acme", vec, flags{pii: true}); ok {
+		t.Error("matched a prompt with different detector flags")
+	}
+	if _, _, ok := index.find("acme", vec, flags{}); !ok {
+		t.Error("identical prompt in the same scope not matched")
+	}
+}
@@ -0,0 +1,131 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/handler"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/llm"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/prompt"
+)
+
+// Output formats
+const (
+	OutputJSON  = "json"
+	OutputTable = "table"
+)
+
+// Analyze runs the analyze subcommand: it analyzes one prompt taken from the
+// arguments, a file, or stdin, and prints the result
+func Analyze(args []string) error {
+	fs := flag.NewFlagSet("analyze", flag.ContinueOnError)
+	providerName := fs.String("provider", "claude", "LLM provider to use ("+strings.Join(llm.ProviderNames, ", ")+")")
+	file := fs.String("file", "", "read the prompt from a file, or - for stdin")
+	output := fs.String("output", OutputTable, "output format (json or table)")
+	maxRisk := fs.Int("max-risk", 0, "exit with an error if the risk score is above this value (0 disables)")
+	if ok, err := parseFlags(fs, args); !ok {
+		return err
+	}
+	if *output != OutputJSON && *output != OutputTable {
+		return fmt.Errorf("%w: unknown output format %q", ErrUsage, *output)
+	}
+
+	// Read the prompt
+	promptText, err := readPrompt(*file, fs.Args())
+	if err != nil {
+		return err
+	}
+	req := prompt.Request{Prompt: promptText}
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	// Load configuration and create the provider
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	provider, err := llm.NewProvider(*providerName, cfg)
+	if err != nil {
+		return err
+	}
+	if !provider.IsAvailable() {
+		return fmt.Errorf("%s API key not set", provider.Name())
+	}
+
+	// Analyze the prompt
+	startTime := time.Now()
+	analysis, err := provider.AnalyzePrompt(context.Background(), promptText)
+	if err != nil {
+		return fmt.Errorf("error analyzing prompt: %w", err)
+	}
+	response := handler.AnalysisResponse{
+		PromptAnalysis: *analysis,
+		Latency:        time.Since(startTime).Milliseconds(),
+	}
+
+	// Print the result
+	if *output == OutputJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(response); err != nil {
+			return err
+		}
+	} else {
+		printAnalysisTable(os.Stdout, provider, &response)
+	}
+
+	// Fail when the risk threshold is exceeded, e.g. in a git hook
+	if *maxRisk > 0 && analysis.RiskScore > *maxRisk {
+		return fmt.Errorf("risk score %d exceeds the maximum of %d", analysis.RiskScore, *maxRisk)
+	}
+	return nil
+}
+
+// readPrompt returns the prompt from a file, the joined arguments, or stdin
+func readPrompt(file string, args []string) (string, error) {
+	switch {
+	case file == "-" || (file == "" && len(args) == 0):
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", fmt.Errorf("error reading stdin: %w", err)
+		}
+		return string(data), nil
+	case file != "":
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("error reading prompt file: %w", err)
+		}
+		return string(data), nil
+	default:
+		return strings.Join(args, " "), nil
+	}
+}
+
+// printAnalysisTable prints an analysis as aligned label/value rows
+func printAnalysisTable(w io.Writer, provider llm.LLM, response *handler.AnalysisResponse) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Provider\t%s (%s)\n", provider.Name(), provider.Model())
+	fmt.Fprintf(tw, "Token Count\t%d\n", response.TokenCount)
+	fmt.Fprintf(tw, "Prompt Type\t%s\n", response.PromptType)
+	fmt.Fprintf(tw, "Contains PII\t%s\n", yesNo(response.ContainsPII))
+	fmt.Fprintf(tw, "Suspicious\t%s\n", yesNo(response.IsSuspicious))
+	fmt.Fprintf(tw, "Risk Score\t%d/10\n", response.RiskScore)
+	fmt.Fprintf(tw, "Latency\t%dms\n", response.Latency)
+	tw.Flush()
+}
+
+// yesNo formats a boolean for table output
+func yesNo(b bool) string {
+	if b {
+		return "Yes"
+	}
+	return "No"
+}
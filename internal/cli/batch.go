@@ -0,0 +1,190 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/batch"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/cache"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/llm"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/usage"
+)
+
+// progressEvery is how many results are written between progress log lines
+const progressEvery = 1000
+
+// Batch runs the batch subcommand: it analyzes every prompt in a JSONL or CSV
+// input and writes one JSONL result per prompt
+func Batch(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("batch", flag.ContinueOnError)
+	providerName := fs.String("provider", "claude", "LLM provider to use ("+strings.Join(llm.ProviderNames, ", ")+")")
+	inPath := fs.String("in", "-", "input file, or - for stdin")
+	outPath := fs.String("out", "-", "output JSONL file, or - for stdout")
+	format := fs.String("format", "", "input format (jsonl or csv); detected from the file extension when empty")
+	promptField := fs.String("field", "prompt", "JSON key or CSV column holding the prompt")
+	idField := fs.String("id-field", "id", "JSON key or CSV column holding an optional prompt ID")
+	concurrency := fs.Int("concurrency", 4, "number of prompts analyzed in parallel")
+	resume := fs.Bool("resume", true, "skip prompts already present in the output file")
+	vendor := fs.Bool("vendor", false, "use the provider's discounted asynchronous batch API instead of realtime calls")
+	vendorChunk := fs.Int("vendor-chunk", 10000, "prompts per vendor batch when -vendor is set")
+	noCache := fs.Bool("no-cache", false, "analyze every prompt even when the cache holds a result")
+	if ok, err := parseFlags(fs, args); !ok {
+		return err
+	}
+
+	// Create the provider, held to the provider quotas and sharing identical
+	// calls as it is in the server
+	base, err := llm.NewProvider(*providerName, cfg)
+	if err != nil {
+		return err
+	}
+	provider := llm.Instrument(base, cfg)
+	if !provider.IsAvailable() {
+		return fmt.Errorf("%s API key not set", provider.Name())
+	}
+
+	// Open the analysis cache (nil when caching is disabled)
+	analysisCache, err := cache.New(cfg)
+	if err != nil {
+		return err
+	}
+
+	// Open the input
+	var in io.Reader = os.Stdin
+	if *inPath != "-" {
+		file, err := os.Open(*inPath)
+		if err != nil {
+			return fmt.Errorf("error opening input: %w", err)
+		}
+		defer file.Close()
+		in = file
+	}
+	if *format == "" {
+		*format = detectFormat(*inPath)
+	}
+	reader, err := batch.NewReader(in, *format, *promptField, *idField)
+	if err != nil {
+		return err
+	}
+
+	// Record token usage and cost in the ledger the usage command reports
+	ledger, err := usage.NewLedger(cfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := ledger.Close(); err != nil {
+			log.Printf("Error saving usage: %v", err)
+		}
+	}()
+
+	// Open the output, picking up where a previous run stopped. A vendor
+	// batch in progress is recorded beside the output so it is not paid for
+	// twice.
+	var out io.Writer = os.Stdout
+	completed := map[int]bool{}
+	statePath := ""
+	if *outPath != "-" {
+		statePath = *outPath + ".vendor.json"
+		if *resume {
+			if completed, err = batch.LoadCompleted(*outPath); err != nil {
+				return err
+			}
+		} else if err := os.Remove(statePath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing vendor batch state: %w", err)
+		}
+		flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		if !*resume {
+			flags = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		}
+		file, err := os.OpenFile(*outPath, flags, 0o644)
+		if err != nil {
+			return fmt.Errorf("error opening output: %w", err)
+		}
+		defer file.Close()
+		out = file
+	}
+	if len(completed) > 0 {
+		log.Printf("Resuming: %d prompts already completed", len(completed))
+	}
+
+	// Stop starting new prompts on interrupt
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *noCache {
+		ctx = cache.WithBypass(ctx)
+	}
+
+	// Write each result as a JSON line, flushing so an interrupt loses nothing
+	writer := bufio.NewWriter(out)
+	encoder := json.NewEncoder(writer)
+	written := 0
+	record := ledger.Record
+	if *vendor {
+		record = ledger.RecordBatch
+	}
+	write := func(result batch.Result) error {
+		if result.Usage != nil {
+			if cost, priced := record("", "", *providerName, provider.Model(), *result.Usage); priced {
+				result.CostUSD = &cost
+			}
+		}
+		if err := encoder.Encode(result); err != nil {
+			return fmt.Errorf("error writing result: %w", err)
+		}
+		if err := writer.Flush(); err != nil {
+			return fmt.Errorf("error writing result: %w", err)
+		}
+		written++
+		if written%progressEvery == 0 {
+			log.Printf("Progress: %d prompts written", written)
+		}
+		return nil
+	}
+
+	// Run the batch
+	opts := batch.Options{
+		Concurrency: *concurrency,
+		Completed:   completed,
+		Cache:       analysisCache,
+	}
+	var stats batch.Stats
+	if *vendor {
+		batchProvider, ok := base.(llm.BatchLLM)
+		if !ok {
+			return fmt.Errorf("%s does not support vendor batches", provider.Name())
+		}
+		vopts := batch.VendorOptions{
+			ChunkSize:    *vendorChunk,
+			PollInterval: cfg.Batch.PollInterval,
+			StatePath:    statePath,
+		}
+		stats, err = batch.RunVendor(ctx, batchProvider, reader, opts, vopts, write)
+	} else {
+		stats, err = batch.Run(ctx, provider, reader, opts, write)
+	}
+	log.Printf("Batch finished: %d processed, %d failed, %d skipped", stats.Processed, stats.Failed, stats.Skipped)
+	if ctx.Err() != nil {
+		return fmt.Errorf("batch interrupted; rerun with the same output to resume")
+	}
+	return err
+}
+
+// detectFormat picks the input format from the file extension
+func detectFormat(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return batch.FormatCSV
+	}
+	return batch.FormatJSONL
+}
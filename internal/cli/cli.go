@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
+)
+
+// ErrUsage is returned when a command is invoked incorrectly
+var ErrUsage = errors.New("invalid usage")
+
+// usageText describes the available commands
+const usageText = `Usage: ai-prompt-analysis <command> [flags]
+
+Commands:
+  serve              Start the HTTP server (default when no command is given)
+  analyze            Analyze a prompt from arguments, a file or stdin
+  batch              Analyze a JSONL or CSV file of prompts
+  scan [dir]         Check prompts in a directory tree against the policy
+  eval               Score providers against a labeled dataset
+  config validate    Check config.yaml (or the given file) for errors
+  providers list     Show each provider's availability and model
+  keys generate      Create a client API key and its config entry
+  usage report       Print requests, tokens and cost by tenant and period
+
+Run "ai-prompt-analysis <command> -h" for command flags.
+`
+
+// Run dispatches the command line to a subcommand
+func Run(args []string) error {
+	if len(args) == 0 {
+		return Serve(nil)
+	}
+
+	switch args[0] {
+	case "serve":
+		return Serve(args[1:])
+	case "analyze":
+		return Analyze(args[1:])
+	case "batch":
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		return Batch(cfg, args[1:])
+	case "scan":
+		return Scan(args[1:])
+	case "eval":
+		return Eval(args[1:])
+	case "config":
+		if len(args) < 2 || args[1] != "validate" {
+			return usageError("config requires the validate subcommand")
+		}
+		return ValidateConfig(args[2:])
+	case "providers":
+		if len(args) < 2 || args[1] != "list" {
+			return usageError("providers requires the list subcommand")
+		}
+		return ListProviders(args[2:])
+	case "keys":
+		if len(args) < 2 || args[1] != "generate" {
+			return usageError("keys requires the generate subcommand")
+		}
+		return GenerateKey(args[2:])
+	case "usage":
+		if len(args) < 2 || args[1] != "report" {
+			return usageError("usage requires the report subcommand")
+		}
+		return UsageReport(args[2:])
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(os.Stdout, usageText)
+		return nil
+	default:
+		return usageError(fmt.Sprintf("unknown command %q", args[0]))
+	}
+}
+
+// loadConfig loads config.yaml from the default search paths
+func loadConfig() (*config.Config, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if err := checkConfig(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// usageError prints the usage text and returns an ErrUsage-wrapped error
+func usageError(msg string) error {
+	fmt.Fprint(os.Stderr, usageText)
+	return fmt.Errorf("%w: %s", ErrUsage, msg)
+}
+
+// parseFlags parses a subcommand's flags, treating -h as success
+func parseFlags(fs *flag.FlagSet, args []string) (bool, error) {
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return false, nil
+	}
+	return err == nil, err
+}
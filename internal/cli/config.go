@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/detect"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/tenant"
+)
+
+// ValidateConfig runs the config validate subcommand: it loads config.yaml,
+// or the file given as an argument, and reports every problem found
+func ValidateConfig(args []string) error {
+	fs := flag.NewFlagSet("config validate", flag.ContinueOnError)
+	if ok, err := parseFlags(fs, args); !ok {
+		return err
+	}
+
+	// Load the configuration
+	var cfg *config.Config
+	var err error
+	if fs.NArg() > 0 {
+		cfg, err = config.LoadFile(fs.Arg(0))
+	} else {
+		cfg, err = config.Load()
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := checkConfig(cfg); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stdout, "Configuration is valid")
+	return nil
+}
+
+// checkConfig validates the configuration values, then the settings that
+// depend on the environment. Every subcommand that loads the configuration
+// runs it, so nothing starts with a configuration the validator rejects.
+func checkConfig(cfg *config.Config) error {
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("configuration is invalid:\n%w", err)
+	}
+	if _, err := tenant.New(cfg); err != nil {
+		return fmt.Errorf("configuration is invalid:\n%w", err)
+	}
+	if _, err := detect.Load(cfg.Detectors); err != nil {
+		return fmt.Errorf("configuration is invalid:\n%w", err)
+	}
+	return nil
+}
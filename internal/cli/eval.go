@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/eval"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/llm"
+)
+
+// ErrRegression is returned when an evaluation regresses against its baseline
+var ErrRegression = errors.New("evaluation regressed against baseline")
+
+// Eval runs the eval subcommand: it scores providers against a labeled
+// dataset and optionally compares the result with a previous report
+func Eval(args []string) error {
+	fs := flag.NewFlagSet("eval", flag.ContinueOnError)
+	dataset := fs.String("dataset", "", "labeled JSONL dataset (required)")
+	providers := fs.String("providers", "claude", "comma-separated providers to evaluate ("+strings.Join(llm.ProviderNames, ", ")+")")
+	concurrency := fs.Int("concurrency", 4, "number of prompts analyzed in parallel per provider")
+	outPath := fs.String("out", "", "write the JSON report to this file for later comparison")
+	baseline := fs.String("baseline", "", "compare against a JSON report from a previous run")
+	tolerance := fs.Float64("tolerance", 0.02, "allowed drop in F1, accuracy and in-range rate before flagging a regression")
+	maeTolerance := fs.Float64("mae-tolerance", 0.25, "allowed rise in risk score MAE before flagging a regression")
+	if ok, err := parseFlags(fs, args); !ok {
+		return err
+	}
+	if *dataset == "" {
+		return fmt.Errorf("%w: -dataset is required", ErrUsage)
+	}
+
+	// Load configuration, dataset and providers
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	cases, err := eval.LoadDataset(*dataset)
+	if err != nil {
+		return err
+	}
+	var selected []llm.LLM
+	for _, name := range strings.Split(*providers, ",") {
+		provider, err := llm.NewProvider(strings.TrimSpace(name), cfg)
+		if err != nil {
+			return err
+		}
+		if !provider.IsAvailable() {
+			return fmt.Errorf("%s API key not set", provider.Name())
+		}
+		selected = append(selected, provider)
+	}
+
+	// Run the evaluation
+	report, err := eval.Run(context.Background(), cfg, *dataset, cases, selected, *concurrency)
+	if err != nil {
+		return err
+	}
+	eval.WriteText(os.Stdout, report)
+
+	// Save the report
+	if *outPath != "" {
+		file, err := os.Create(*outPath)
+		if err != nil {
+			return fmt.Errorf("error creating report: %w", err)
+		}
+		defer file.Close()
+		if err := eval.WriteJSON(file, report); err != nil {
+			return fmt.Errorf("error writing report: %w", err)
+		}
+	}
+
+	// Compare with the baseline
+	if *baseline != "" {
+		previous, err := eval.LoadReport(*baseline)
+		if err != nil {
+			return err
+		}
+		changes := eval.Compare(previous, report, *tolerance, *maeTolerance)
+		fmt.Fprintln(os.Stdout, "\nComparison with baseline:")
+		eval.WriteComparison(os.Stdout, changes)
+		for _, c := range changes {
+			if c.Regression {
+				return ErrRegression
+			}
+		}
+	}
+
+	return nil
+}
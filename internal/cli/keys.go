@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/auth"
+)
+
+// GenerateKey runs the keys generate subcommand: it prints a new client API
+// key and the config entry holding its hash
+func GenerateKey(args []string) error {
+	fs := flag.NewFlagSet("keys generate", flag.ContinueOnError)
+	name := fs.String("name", "", "client name recorded in logs and stored results (required)")
+	tenant := fs.String("tenant", "", "team the client's usage is charged to (optional)")
+	scopes := fs.String("scopes", auth.ScopeAnalyze, "comma-separated scopes: "+strings.Join(auth.Scopes, ", "))
+	if ok, err := parseFlags(fs, args); !ok {
+		return err
+	}
+	if *name == "" {
+		return fmt.Errorf("%w: -name is required", ErrUsage)
+	}
+
+	var granted []string
+	for _, scope := range strings.Split(*scopes, ",") {
+		scope = strings.TrimSpace(scope)
+		if !slices.Contains(auth.Scopes, scope) {
+			return fmt.Errorf("%w: unknown scope %q", ErrUsage, scope)
+		}
+		granted = append(granted, fmt.Sprintf("%q", scope))
+	}
+
+	key, err := auth.GenerateKey()
+	if err != nil {
+		return err
+	}
+
+	// The key goes to stderr so the config entry can be redirected on its own
+	fmt.Fprintf(os.Stderr, "API key (shown once; give it to the client): %s\n", key)
+	fmt.Fprintf(os.Stdout, "- name: %q\n", *name)
+	if *tenant != "" {
+		fmt.Fprintf(os.Stdout, "  tenant: %q\n", *tenant)
+	}
+	fmt.Fprintf(os.Stdout, "  hash: %q\n  scopes: [%s]\n", auth.HashKey(key), strings.Join(granted, ", "))
+	return nil
+}
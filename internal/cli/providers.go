@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/llm"
+)
+
+// ListProviders runs the providers list subcommand: it prints each
+// provider's availability and configured model
+func ListProviders(args []string) error {
+	fs := flag.NewFlagSet("providers list", flag.ContinueOnError)
+	if ok, err := parseFlags(fs, args); !ok {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROVIDER\tNAME\tAVAILABLE\tMODEL")
+	for _, name := range llm.ProviderNames {
+		provider, err := llm.NewProvider(name, cfg)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", name, provider.Name(), yesNo(provider.IsAvailable()), provider.Model())
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/llm"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/scan"
+)
+
+// ErrViolations is returned when a scan finds policy violations
+var ErrViolations = errors.New("policy violations found")
+
+// Scan runs the scan subcommand: it checks the prompts in a directory tree
+// against the policy and fails if any violate it
+func Scan(args []string) error {
+	fs := flag.NewFlagSet("scan", flag.ContinueOnError)
+	providerName := fs.String("provider", "", "also analyze prompts with this LLM provider ("+strings.Join(llm.ProviderNames, ", ")+"); local detectors only when empty")
+	format := fs.String("format", "text", "output format (text or sarif)")
+	outPath := fs.String("out", "-", "output file, or - for stdout")
+	if ok, err := parseFlags(fs, args); !ok {
+		return err
+	}
+	if *format != "text" && *format != "sarif" {
+		return fmt.Errorf("%w: unknown output format %q", ErrUsage, *format)
+	}
+	root := "."
+	if fs.NArg() > 0 {
+		root = fs.Arg(0)
+	}
+
+	// Load configuration and the optional provider
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	var provider llm.LLM
+	if *providerName != "" {
+		if provider, err = llm.NewProvider(*providerName, cfg); err != nil {
+			return err
+		}
+		if !provider.IsAvailable() {
+			return fmt.Errorf("%s API key not set", provider.Name())
+		}
+	}
+
+	// Scan the tree
+	scanner, err := scan.New(cfg, provider)
+	if err != nil {
+		return err
+	}
+	issues, checked, err := scanner.Scan(context.Background(), root)
+	if err != nil {
+		return err
+	}
+
+	// Write the report
+	var out io.Writer = os.Stdout
+	if *outPath != "-" {
+		file, err := os.Create(*outPath)
+		if err != nil {
+			return fmt.Errorf("error creating output: %w", err)
+		}
+		defer file.Close()
+		out = file
+	}
+	if *format == "sarif" {
+		if err := scan.WriteSARIF(out, issues); err != nil {
+			return err
+		}
+	} else {
+		for _, issue := range issues {
+			fmt.Fprintf(out, "%s:%d: [%s] %s in %s\n", issue.File, issue.Line, issue.Rule, issue.Message, issue.Source)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Scanned %d prompts, found %d violations\n", checked, len(issues))
+	if len(issues) > 0 {
+		return fmt.Errorf("%w: %d", ErrViolations, len(issues))
+	}
+	return nil
+}
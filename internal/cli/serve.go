@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/handler"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/logging"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/store"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/tenant"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/tracing"
+)
+
+// Serve runs the serve subcommand: it starts the HTTP server and blocks
+// until it stops
+func Serve(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	port := fs.String("port", "", "port to listen on, overriding server.port")
+	if ok, err := parseFlags(fs, args); !ok {
+		return err
+	}
+
+	// Load configuration
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if *port != "" {
+		cfg.Server.Port = *port
+	}
+
+	// Stop on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Switch to structured logging
+	if err := logging.Setup(cfg); err != nil {
+		return err
+	}
+
+	// Export traces when tracing is enabled
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg)
+	if err != nil {
+		return fmt.Errorf("failed to set up tracing: %w", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	// Open the record store (nil when persistence is disabled)
+	st, err := store.Open(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to open store: %w", err)
+	}
+
+	// Load the global and per-tenant policy, retention and provider settings
+	tenants, err := tenant.New(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to load tenant settings: %w", err)
+	}
+
+	// Create handler with LLM providers
+	h, err := handler.NewHandler(cfg, st, tenants)
+	if err != nil {
+		return fmt.Errorf("failed to create handler: %w", err)
+	}
+
+	// Purge expired records, and their cached analyses, in the background
+	if st != nil && tenants.Expires() {
+		go store.RunPurger(ctx, st, tenants.TTL, cfg.Retention.PurgeInterval, h.ForgetCached)
+	}
+
+	// Register routes
+	h.RegisterRoutes()
+
+	// Start the server and drain it on SIGINT or SIGTERM
+	if err := h.StartServer(ctx); err != nil {
+		return fmt.Errorf("server failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/usage"
+)
+
+// UsageReport runs the usage report subcommand: it prints requests, tokens
+// and cost by tenant and period from the persisted usage ledger
+func UsageReport(args []string) error {
+	fs := flag.NewFlagSet("usage report", flag.ContinueOnError)
+	from := fs.String("from", "", "first day of the report, YYYY-MM-DD (default the first of this month)")
+	to := fs.String("to", "", "last day of the report, YYYY-MM-DD (default today)")
+	period := fs.String("period", usage.PeriodMonth, "total by day or month")
+	byClient := fs.Bool("by-client", false, "break each tenant down by client")
+	format := fs.String("format", "csv", "output format: csv or json")
+	if ok, err := parseFlags(fs, args); !ok {
+		return err
+	}
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("%w: -format must be csv or json", ErrUsage)
+	}
+	start, end, err := usage.ParseRange(*from, *to)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUsage, err)
+	}
+
+	// Usage is only on disk with the file backend
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if cfg.Storage.Backend != "file" {
+		return fmt.Errorf("usage is only persisted with the file storage backend; query GET /usage on the server instead")
+	}
+	ledger, err := usage.NewLedger(cfg)
+	if err != nil {
+		return err
+	}
+	defer ledger.Close()
+
+	report, err := ledger.NewReport(start, end, *period, *byClient)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUsage, err)
+	}
+	if *format == "json" {
+		return report.WriteJSON(os.Stdout)
+	}
+	return report.WriteCSV(os.Stdout)
+}
@@ -3,35 +3,264 @@ package config
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
+// ModelPrice is the price of a model in USD per million tokens
+type ModelPrice struct {
+	Model         string  `mapstructure:"model"`
+	Input         float64 `mapstructure:"input"`
+	Output        float64 `mapstructure:"output"`
+	BatchDiscount float64 `mapstructure:"batch_discount"` // Fraction taken off both prices for vendor batch API calls
+}
+
+// Cassette configures recording or replay of a provider's HTTP traffic
+type Cassette struct {
+	Mode string `mapstructure:"mode"` // "" (off), "record" or "replay"
+	Dir  string `mapstructure:"dir"`
+}
+
+// MockTypeRule assigns a prompt type to prompts containing any of the keywords
+type MockTypeRule struct {
+	Type     string   `mapstructure:"type"`
+	Keywords []string `mapstructure:"keywords"`
+}
+
+// APIKey is a client API key. Only the key's SHA-256 hash is stored.
+type APIKey struct {
+	Name   string   `mapstructure:"name" yaml:"name"`     // Client name used in logs and records
+	Tenant string   `mapstructure:"tenant" yaml:"tenant"` // Optional team the client's usage is charged to
+	Hash   string   `mapstructure:"hash" yaml:"hash"`     // "sha256:" followed by the hex digest
+	Scopes []string `mapstructure:"scopes" yaml:"scopes"` // analyze, batch, history or admin
+}
+
+// RateLimit caps a client's request rate and concurrent requests. A zero
+// value disables that limit.
+type RateLimit struct {
+	RequestsPerMinute float64 `mapstructure:"requests_per_minute"`
+	Burst             int     `mapstructure:"burst"` // Requests that may be made at once; defaults to 1
+	MaxInFlight       int     `mapstructure:"max_in_flight"`
+}
+
+// RateLimitOverride replaces the default limits for one client or tenant
+type RateLimitOverride struct {
+	Client    string `mapstructure:"client"`
+	Tenant    string `mapstructure:"tenant"`
+	RateLimit `mapstructure:",squash"`
+}
+
+// ProviderQuota is a vendor rate limit the server keeps its calls within. A
+// zero value disables that limit.
+type ProviderQuota struct {
+	RequestsPerMinute int           `mapstructure:"requests_per_minute"`
+	TokensPerMinute   int           `mapstructure:"tokens_per_minute"`
+	MaxWait           time.Duration `mapstructure:"max_wait"` // Longest a call queues before it is shed
+}
+
+// BudgetLimit is a pair of spending thresholds in USD. A zero value disables
+// that threshold.
+type BudgetLimit struct {
+	Soft float64 `mapstructure:"soft"` // Responses carry a warning header from here on
+	Hard float64 `mapstructure:"hard"` // Analyses are rejected from here on
+}
+
+// Budget caps the spending of one client or tenant per UTC day and calendar
+// month
+type Budget struct {
+	Client  string      `mapstructure:"client"`
+	Tenant  string      `mapstructure:"tenant"`
+	Daily   BudgetLimit `mapstructure:"daily"`
+	Monthly BudgetLimit `mapstructure:"monthly"`
+}
+
+// Retention controls which form of each prompt is stored, and for how long
+type Retention struct {
+	Mode          string        `mapstructure:"mode"` // none, hash, redacted or encrypted
+	TTL           time.Duration `mapstructure:"ttl"`
+	PurgeInterval time.Duration `mapstructure:"purge_interval"`
+}
+
+// Policy decides which analyzed prompts are blocked
+type Policy struct {
+	MaxRiskScore    int      `mapstructure:"max_risk_score"` // 0 disables the risk check
+	BlockPII        bool     `mapstructure:"block_pii"`
+	BlockSuspicious bool     `mapstructure:"block_suspicious"`
+	BlockedTypes    []string `mapstructure:"blocked_types"`
+}
+
+// Tenant overrides settings for the clients of one tenant. Empty fields keep
+// the global setting; a policy or retention section replaces the global one
+// as a whole.
+type Tenant struct {
+	Name         string            `mapstructure:"name"`
+	Providers    []string          `mapstructure:"providers"` // Providers the tenant may use; empty allows all
+	Models       map[string]string `mapstructure:"models"`    // Model ID by provider (claude or chatgpt)
+	SystemPrompt string            `mapstructure:"system_prompt"`
+	Detectors    []string          `mapstructure:"detectors"`
+	Policy       *Policy           `mapstructure:"policy"`
+	Retention    *Retention        `mapstructure:"retention"` // purge_interval is global
+}
+
 // Config holds application configuration
 type Config struct {
 	Server struct {
-		Port   string `mapstructure:"port"`
-		DemoUI bool   `mapstructure:"demoui"`
+		Port    string `mapstructure:"port"`
+		DemoUI  bool   `mapstructure:"demoui"`
+		Metrics bool   `mapstructure:"metrics"` // Serve Prometheus metrics at /metrics
+
+		ReadTimeout       time.Duration `mapstructure:"read_timeout"`
+		ReadHeaderTimeout time.Duration `mapstructure:"read_header_timeout"`
+		WriteTimeout      time.Duration `mapstructure:"write_timeout"`
+		IdleTimeout       time.Duration `mapstructure:"idle_timeout"`
+		MaxHeaderBytes    int           `mapstructure:"max_header_bytes"`
+		MaxBodyBytes      int64         `mapstructure:"max_body_bytes"` // Largest analysis request body
+		ShutdownGrace     time.Duration `mapstructure:"shutdown_grace"` // Time allowed to drain on SIGTERM
 	} `mapstructure:"server"`
 
 	Claude struct {
-		APIURL      string  `mapstructure:"api_url"`
-		ModelID     string  `mapstructure:"model_id"`
-		MaxTokens   int     `mapstructure:"max_tokens"`
-		Temperature float64 `mapstructure:"temperature"`
-		Version     string  `mapstructure:"version"`
+		APIURL      string   `mapstructure:"api_url"`
+		ModelID     string   `mapstructure:"model_id"`
+		MaxTokens   int      `mapstructure:"max_tokens"`
+		Temperature float64  `mapstructure:"temperature"`
+		Version     string   `mapstructure:"version"`
+		BatchAPIURL string   `mapstructure:"batch_api_url"`
+		ModelsURL   string   `mapstructure:"models_url"` // Used by readiness checks
+		Cassette    Cassette `mapstructure:"cassette"`
 	} `mapstructure:"claude"`
 
 	ChatGPT struct {
-		APIURL      string  `mapstructure:"api_url"`
-		ModelID     string  `mapstructure:"model_id"`
-		MaxTokens   int     `mapstructure:"max_tokens"`
-		Temperature float64 `mapstructure:"temperature"`
+		APIURL      string   `mapstructure:"api_url"`
+		ModelID     string   `mapstructure:"model_id"`
+		MaxTokens   int      `mapstructure:"max_tokens"`
+		Temperature float64  `mapstructure:"temperature"`
+		BatchAPIURL string   `mapstructure:"batch_api_url"`
+		FilesAPIURL string   `mapstructure:"files_api_url"`
+		ModelsURL   string   `mapstructure:"models_url"` // Used by readiness checks
+		Cassette    Cassette `mapstructure:"cassette"`
 	} `mapstructure:"chatgpt"`
 
+	Health struct {
+		RequiredProviders []string      `mapstructure:"required_providers"` // Must be reachable for /readyz
+		CheckInterval     time.Duration `mapstructure:"check_interval"`     // How long a readiness result is reused
+		CheckTimeout      time.Duration `mapstructure:"check_timeout"`
+	} `mapstructure:"health"`
+
+	Logging struct {
+		Level      string `mapstructure:"level"`       // debug, info, warn or error
+		Format     string `mapstructure:"format"`      // json or text
+		LogPrompts bool   `mapstructure:"log_prompts"` // Include prompt text in logs
+	} `mapstructure:"logging"`
+
+	Tracing struct {
+		Enabled     bool    `mapstructure:"enabled"`
+		Endpoint    string  `mapstructure:"endpoint"` // OTLP/HTTP collector, host:port
+		Insecure    bool    `mapstructure:"insecure"` // Send over plain HTTP
+		SampleRatio float64 `mapstructure:"sample_ratio"`
+		ServiceName string  `mapstructure:"service_name"`
+	} `mapstructure:"tracing"`
+
+	Retry struct {
+		MaxAttempts int           `mapstructure:"max_attempts"` // Including the first request; 0 or 1 disables retries
+		Backoff     time.Duration `mapstructure:"backoff"`      // Doubled after each attempt
+		MaxBackoff  time.Duration `mapstructure:"max_backoff"`
+	} `mapstructure:"retry"`
+
+	Mock struct {
+		Enabled      bool           `mapstructure:"enabled"`
+		ModelID      string         `mapstructure:"model_id"`
+		Fixtures     string         `mapstructure:"fixtures"` // JSONL of prompt/analysis pairs returned on exact match
+		Latency      time.Duration  `mapstructure:"latency"`
+		Jitter       time.Duration  `mapstructure:"jitter"`
+		ErrorRate    float64        `mapstructure:"error_rate"`    // Fraction of requests that fail, 0-1
+		ErrorKeyword string         `mapstructure:"error_keyword"` // Prompts containing this always fail
+		Seed         uint64         `mapstructure:"seed"`
+		DefaultType  string         `mapstructure:"default_type"`
+		TypeRules    []MockTypeRule `mapstructure:"type_rules"`
+		PIIPatterns  []string       `mapstructure:"pii_patterns"` // Extra regexes on top of the built-in PII detector
+	} `mapstructure:"mock"`
+
+	Auth struct {
+		Enabled bool     `mapstructure:"enabled"`
+		Keys    []APIKey `mapstructure:"keys"`
+		KeyFile string   `mapstructure:"key_file"` // YAML file with a keys list, read at startup
+
+		JWT struct {
+			Enabled     bool          `mapstructure:"enabled"`
+			JWKSFile    string        `mapstructure:"jwks_file"`    // Local key set; takes precedence over the URL
+			JWKSURL     string        `mapstructure:"jwks_url"`     // Fetched at startup and cached
+			JWKSRefresh time.Duration `mapstructure:"jwks_refresh"` // How long fetched keys are cached
+			Issuer      string        `mapstructure:"issuer"`
+			Audience    string        `mapstructure:"audience"`
+			Leeway      time.Duration `mapstructure:"leeway"` // Allowed clock skew for exp and nbf
+			ClientClaim string        `mapstructure:"client_claim"`
+			TenantClaim string        `mapstructure:"tenant_claim"`
+			ScopesClaim string        `mapstructure:"scopes_claim"`
+		} `mapstructure:"jwt"`
+	} `mapstructure:"auth"`
+
+	RateLimits struct {
+		Enabled           bool                `mapstructure:"enabled"`
+		Default           RateLimit           `mapstructure:"default"`
+		PerIP             RateLimit           `mapstructure:"per_ip"` // Applied by address before authentication; off when unset
+		Overrides         []RateLimitOverride `mapstructure:"overrides"`
+		TrustForwardedFor bool                `mapstructure:"trust_forwarded_for"` // Key anonymous callers by X-Forwarded-For
+	} `mapstructure:"rate_limits"`
+
+	Quotas map[string]ProviderQuota `mapstructure:"quotas"` // By provider identifier
+
 	Analysis struct {
 		SystemPrompt string `mapstructure:"system_prompt"`
 	} `mapstructure:"analysis"`
+
+	Storage struct {
+		Backend string `mapstructure:"backend"` // "" (disabled), "memory" or "file"
+		Path    string `mapstructure:"path"`
+	} `mapstructure:"storage"`
+
+	Retention Retention `mapstructure:"retention"`
+
+	Detectors []string `mapstructure:"detectors"` // Local detectors to run; empty means all
+
+	Policy Policy `mapstructure:"policy"`
+
+	Tenants []Tenant `mapstructure:"tenants"`
+
+	Scan struct {
+		Include       []string `mapstructure:"include"`
+		Exclude       []string `mapstructure:"exclude"`
+		YAMLKeys      []string `mapstructure:"yaml_keys"`
+		GoIdentifiers string   `mapstructure:"go_identifiers"`
+		MaxFileSize   int64    `mapstructure:"max_file_size"`
+	} `mapstructure:"scan"`
+
+	Pricing []ModelPrice `mapstructure:"pricing"`
+	Budgets []Budget     `mapstructure:"budgets"`
+
+	Cache struct {
+		Enabled    bool          `mapstructure:"enabled"`
+		Backend    string        `mapstructure:"backend"`     // "memory" (default) or "file"
+		Path       string        `mapstructure:"path"`        // Directory for the file backend
+		MaxEntries int           `mapstructure:"max_entries"` // Memory backend size; least recently used entries are evicted
+		TTL        time.Duration `mapstructure:"ttl"`         // 0 keeps entries until evicted
+
+		Similarity struct {
+			Enabled    bool    `mapstructure:"enabled"`
+			Threshold  float64 `mapstructure:"threshold"`   // Cosine similarity, 0-1, a near-duplicate must reach
+			MaxEntries int     `mapstructure:"max_entries"` // Prompts compared against; the oldest are dropped
+		} `mapstructure:"similarity"`
+	} `mapstructure:"cache"`
+
+	Batch struct {
+		MaxItems            int            `mapstructure:"max_items"`
+		Workers             int            `mapstructure:"workers"`
+		ProviderConcurrency map[string]int `mapstructure:"provider_concurrency"`
+		QueueSize           int            `mapstructure:"queue_size"`
+		JobTTL              time.Duration  `mapstructure:"job_ttl"`
+		PollInterval        time.Duration  `mapstructure:"poll_interval"`
+		MaxBodyBytes        int64          `mapstructure:"max_body_bytes"` // Largest job submission body
+	} `mapstructure:"batch"`
 }
 
 // Load loads configuration from config.yaml
@@ -41,6 +270,19 @@ func Load() (*Config, error) {
 	viper.AddConfigPath(".")
 	viper.AddConfigPath("./config")
 
+	return read()
+}
+
+// LoadFile loads configuration from the given YAML file
+func LoadFile(path string) (*Config, error) {
+	viper.SetConfigFile(path)
+	viper.SetConfigType("yaml")
+
+	return read()
+}
+
+// read reads and unmarshals the configuration file selected in viper
+func read() (*Config, error) {
 	if err := viper.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
@@ -53,6 +295,52 @@ func Load() (*Config, error) {
 	return &config, nil
 }
 
+// Price returns the configured price for a model
+func (c *Config) Price(model string) (ModelPrice, bool) {
+	for _, p := range c.Pricing {
+		if p.Model == model {
+			return p, true
+		}
+	}
+	return ModelPrice{}, false
+}
+
+// Tenant returns the overrides for the named tenant, if there are any
+func (c *Config) Tenant(name string) (Tenant, bool) {
+	for _, t := range c.Tenants {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return Tenant{}, false
+}
+
+// ForTenant returns a copy of the configuration with the tenant's overrides
+// applied. Settings the tenant does not override are shared with c.
+func (c *Config) ForTenant(t Tenant) *Config {
+	merged := *c
+	if t.Models["claude"] != "" {
+		merged.Claude.ModelID = t.Models["claude"]
+	}
+	if t.Models["chatgpt"] != "" {
+		merged.ChatGPT.ModelID = t.Models["chatgpt"]
+	}
+	if t.SystemPrompt != "" {
+		merged.Analysis.SystemPrompt = t.SystemPrompt
+	}
+	if len(t.Detectors) > 0 {
+		merged.Detectors = t.Detectors
+	}
+	if t.Policy != nil {
+		merged.Policy = *t.Policy
+	}
+	if t.Retention != nil {
+		merged.Retention.Mode = t.Retention.Mode
+		merged.Retention.TTL = t.Retention.TTL
+	}
+	return &merged
+}
+
 // LoadEnv loads environment variables from .env file
 func LoadEnv() error {
 	// Load .env file if it exists
@@ -65,4 +353,4 @@ func LoadEnv() error {
 // GetEnv gets an environment variable
 func GetEnv(key string) string {
 	return os.Getenv(key)
-}
\ No newline at end of file
+}
@@ -0,0 +1,334 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+// keyHash matches a stored API key hash
+var keyHash = regexp.MustCompile(`^sha256:[0-9a-fA-F]{64}$`)
+
+// Validate checks the configuration for missing or out-of-range values and
+// returns every problem found
+func (c *Config) Validate() error {
+	var errs []error
+	add := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	// Server
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port < 1 || port > 65535 {
+		add("server.port must be a number between 1 and 65535, got %q", c.Server.Port)
+	}
+
+	if c.Server.ReadTimeout < 0 || c.Server.ReadHeaderTimeout < 0 || c.Server.WriteTimeout < 0 ||
+		c.Server.IdleTimeout < 0 || c.Server.ShutdownGrace < 0 || c.Server.MaxHeaderBytes < 0 || c.Server.MaxBodyBytes < 0 {
+		add("server timeouts and limits must not be negative")
+	}
+
+	// Providers
+	checkURL := func(key, value string) {
+		u, err := url.Parse(value)
+		if value == "" || err != nil || u.Scheme == "" || u.Host == "" {
+			add("%s must be an absolute URL, got %q", key, value)
+		}
+	}
+	checkURL("claude.api_url", c.Claude.APIURL)
+	checkURL("chatgpt.api_url", c.ChatGPT.APIURL)
+	if c.Claude.ModelID == "" {
+		add("claude.model_id is required")
+	}
+	if c.ChatGPT.ModelID == "" {
+		add("chatgpt.model_id is required")
+	}
+	if c.Claude.MaxTokens < 1 {
+		add("claude.max_tokens must be positive")
+	}
+	if c.ChatGPT.MaxTokens < 1 {
+		add("chatgpt.max_tokens must be positive")
+	}
+	if c.Claude.Temperature < 0 || c.Claude.Temperature > 1 {
+		add("claude.temperature must be between 0 and 1")
+	}
+	if c.ChatGPT.Temperature < 0 || c.ChatGPT.Temperature > 2 {
+		add("chatgpt.temperature must be between 0 and 2")
+	}
+	if c.Claude.Version == "" {
+		add("claude.version is required")
+	}
+	checkCassette := func(key string, cassette Cassette) {
+		switch cassette.Mode {
+		case "":
+		case "record", "replay":
+			if cassette.Dir == "" {
+				add("%s.dir is required when recording or replaying", key)
+			}
+		default:
+			add("%s.mode must be empty, \"record\" or \"replay\", got %q", key, cassette.Mode)
+		}
+	}
+	checkCassette("claude.cassette", c.Claude.Cassette)
+	checkCassette("chatgpt.cassette", c.ChatGPT.Cassette)
+
+	var level slog.Level
+	if c.Logging.Level != "" && level.UnmarshalText([]byte(c.Logging.Level)) != nil {
+		add("logging.level must be debug, info, warn or error, got %q", c.Logging.Level)
+	}
+	switch c.Logging.Format {
+	case "", "json", "text":
+	default:
+		add("logging.format must be json or text, got %q", c.Logging.Format)
+	}
+	if c.Tracing.Enabled && c.Tracing.Endpoint == "" {
+		add("tracing.endpoint is required when tracing is enabled")
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		add("tracing.sample_ratio must be between 0 and 1")
+	}
+	if c.Retry.MaxAttempts < 0 || c.Retry.Backoff < 0 || c.Retry.MaxBackoff < 0 {
+		add("retry settings must not be negative")
+	}
+
+	// Health checks
+	for _, name := range c.Health.RequiredProviders {
+		switch name {
+		case "claude", "chatgpt":
+		case "mock":
+			if !c.Mock.Enabled {
+				add("health.required_providers includes mock, but mock.enabled is false")
+			}
+		default:
+			add("health.required_providers: unknown provider %q", name)
+		}
+	}
+	for _, p := range []struct{ key, name, url string }{
+		{"claude.models_url", "claude", c.Claude.ModelsURL},
+		{"chatgpt.models_url", "chatgpt", c.ChatGPT.ModelsURL},
+	} {
+		if slices.Contains(c.Health.RequiredProviders, p.name) {
+			checkURL(p.key, p.url)
+		}
+	}
+
+	// Mock provider
+	if c.Mock.ErrorRate < 0 || c.Mock.ErrorRate > 1 {
+		add("mock.error_rate must be between 0 and 1")
+	}
+	if c.Mock.Latency < 0 || c.Mock.Jitter < 0 {
+		add("mock.latency and mock.jitter must not be negative")
+	}
+	for _, pattern := range c.Mock.PIIPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			add("mock.pii_patterns: invalid pattern %q: %v", pattern, err)
+		}
+	}
+
+	// Authentication
+	if c.Auth.Enabled {
+		if len(c.Auth.Keys) == 0 && c.Auth.KeyFile == "" && !c.Auth.JWT.Enabled {
+			add("auth.keys, auth.key_file or auth.jwt is required when auth is enabled")
+		}
+		if c.Server.DemoUI {
+			add("server.demoui cannot be used with auth: the demo form does not send credentials")
+		}
+	}
+	if c.Auth.JWT.Enabled {
+		if !c.Auth.Enabled {
+			add("auth.jwt.enabled requires auth.enabled")
+		}
+		if c.Auth.JWT.JWKSFile == "" && c.Auth.JWT.JWKSURL == "" {
+			add("auth.jwt.jwks_file or auth.jwt.jwks_url is required when JWT auth is enabled")
+		}
+		if c.Auth.JWT.JWKSFile == "" && c.Auth.JWT.JWKSURL != "" {
+			checkURL("auth.jwt.jwks_url", c.Auth.JWT.JWKSURL)
+		}
+		if c.Auth.JWT.Issuer == "" || c.Auth.JWT.Audience == "" {
+			add("auth.jwt.issuer and auth.jwt.audience are required when JWT auth is enabled")
+		}
+		if c.Auth.JWT.Leeway < 0 || c.Auth.JWT.JWKSRefresh < 0 {
+			add("auth.jwt.leeway and auth.jwt.jwks_refresh must not be negative")
+		}
+	}
+	names := make(map[string]bool)
+	for i, key := range c.Auth.Keys {
+		if key.Name == "" {
+			add("auth.keys[%d].name is required", i)
+		} else if names[key.Name] {
+			add("auth.keys: duplicate name %q", key.Name)
+		}
+		names[key.Name] = true
+		if !keyHash.MatchString(key.Hash) {
+			add("auth.keys[%d].hash must be \"sha256:\" followed by 64 hex digits", i)
+		}
+		for _, scope := range key.Scopes {
+			switch scope {
+			case "analyze", "batch", "history", "admin":
+			default:
+				add("auth.keys[%d].scopes: unknown scope %q", i, scope)
+			}
+		}
+	}
+
+	// Rate limits
+	checkRateLimit := func(key string, limit RateLimit) {
+		if limit.RequestsPerMinute < 0 || limit.Burst < 0 || limit.MaxInFlight < 0 {
+			add("%s limits must not be negative", key)
+		}
+	}
+	checkRateLimit("rate_limits.default", c.RateLimits.Default)
+	checkRateLimit("rate_limits.per_ip", c.RateLimits.PerIP)
+	for i, o := range c.RateLimits.Overrides {
+		if (o.Client == "") == (o.Tenant == "") {
+			add("rate_limits.overrides[%d] must set exactly one of client or tenant", i)
+		}
+		checkRateLimit(fmt.Sprintf("rate_limits.overrides[%d]", i), o.RateLimit)
+	}
+
+	// Provider quotas
+	for name, quota := range c.Quotas {
+		switch name {
+		case "claude", "chatgpt", "mock":
+		default:
+			add("quotas: unknown provider %q", name)
+		}
+		if quota.RequestsPerMinute < 0 || quota.TokensPerMinute < 0 || quota.MaxWait < 0 {
+			add("quotas.%s limits must not be negative", name)
+		}
+	}
+
+	// Pricing
+	for i, p := range c.Pricing {
+		if p.Input < 0 || p.Output < 0 {
+			add("pricing[%d] prices must not be negative", i)
+		}
+		if p.BatchDiscount < 0 || p.BatchDiscount >= 1 {
+			add("pricing[%d].batch_discount must be at least 0 and less than 1", i)
+		}
+	}
+
+	// Budgets
+	if len(c.Budgets) > 0 && !c.Auth.Enabled {
+		add("budgets require auth.enabled: spending is charged to authenticated clients")
+	}
+	for i, b := range c.Budgets {
+		if (b.Client == "") == (b.Tenant == "") {
+			add("budgets[%d] must set exactly one of client or tenant", i)
+		}
+		for _, p := range []struct {
+			period string
+			limit  BudgetLimit
+		}{{"daily", b.Daily}, {"monthly", b.Monthly}} {
+			if p.limit.Soft < 0 || p.limit.Hard < 0 {
+				add("budgets[%d].%s limits must not be negative", i, p.period)
+			}
+			if p.limit.Soft > 0 && p.limit.Hard > 0 && p.limit.Soft > p.limit.Hard {
+				add("budgets[%d].%s.soft must not exceed hard", i, p.period)
+			}
+		}
+	}
+
+	// Analysis
+	if c.Analysis.SystemPrompt == "" {
+		add("analysis.system_prompt is required")
+	}
+
+	// Storage and retention
+	switch c.Storage.Backend {
+	case "", "memory":
+	case "file":
+		if c.Storage.Path == "" {
+			add("storage.path is required for the file backend")
+		}
+	default:
+		add("storage.backend must be empty, \"memory\" or \"file\", got %q", c.Storage.Backend)
+	}
+	checkRetention := func(key string, r Retention) {
+		switch r.Mode {
+		case "", "none", "hash", "redacted", "encrypted":
+		default:
+			add("%s.mode must be none, hash, redacted or encrypted, got %q", key, r.Mode)
+		}
+		if r.TTL < 0 {
+			add("%s.ttl must not be negative", key)
+		}
+	}
+	checkRetention("retention", c.Retention)
+
+	// Policy
+	checkPolicy := func(key string, p Policy) {
+		if p.MaxRiskScore < 0 || p.MaxRiskScore > 10 {
+			add("%s.max_risk_score must be between 0 and 10", key)
+		}
+	}
+	checkPolicy("policy", c.Policy)
+
+	// Tenants
+	if len(c.Tenants) > 0 && !c.Auth.Enabled {
+		add("tenants require auth.enabled: tenants are resolved from authenticated clients")
+	}
+	tenants := make(map[string]bool)
+	for i, t := range c.Tenants {
+		key := fmt.Sprintf("tenants[%d]", i)
+		if t.Name == "" {
+			add("%s.name is required", key)
+		} else if tenants[t.Name] {
+			add("tenants: duplicate name %q", t.Name)
+		}
+		tenants[t.Name] = true
+		for _, name := range t.Providers {
+			switch name {
+			case "claude", "chatgpt", "mock":
+			default:
+				add("%s.providers: unknown provider %q", key, name)
+			}
+		}
+		for name := range t.Models {
+			switch name {
+			case "claude", "chatgpt":
+			default:
+				add("%s.models: unknown provider %q", key, name)
+			}
+		}
+		if t.Policy != nil {
+			checkPolicy(key+".policy", *t.Policy)
+		}
+		if t.Retention != nil {
+			checkRetention(key+".retention", *t.Retention)
+		}
+	}
+
+	// Cache
+	switch c.Cache.Backend {
+	case "", "memory":
+	case "file":
+		if c.Cache.Enabled && c.Cache.Path == "" {
+			add("cache.path is required for the file backend")
+		}
+	default:
+		add("cache.backend must be \"memory\" or \"file\", got %q", c.Cache.Backend)
+	}
+	if c.Cache.MaxEntries < 0 || c.Cache.TTL < 0 {
+		add("cache.max_entries and cache.ttl must not be negative")
+	}
+	if c.Cache.Similarity.Enabled && !c.Cache.Enabled {
+		add("cache.similarity.enabled requires cache.enabled")
+	}
+	if c.Cache.Similarity.Threshold < 0 || c.Cache.Similarity.Threshold > 1 {
+		add("cache.similarity.threshold must be between 0 and 1")
+	}
+	if c.Cache.Similarity.MaxEntries < 0 {
+		add("cache.similarity.max_entries must not be negative")
+	}
+
+	// Batch
+	if c.Batch.MaxItems < 0 || c.Batch.Workers < 0 || c.Batch.QueueSize < 0 || c.Batch.MaxBodyBytes < 0 {
+		add("batch limits must not be negative")
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,116 @@
+package detect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// tracer records a span for each detector run
+var tracer = otel.Tracer("github.com/rlnorthcutt/ai-prompt-analysis/internal/detect")
+
+// ErrUnknownDetector is returned when a configured detector does not exist
+var ErrUnknownDetector = errors.New("unknown detector")
+
+// Finding is a single issue reported by a detector
+type Finding struct {
+	Detector string `json:"detector"`
+	Kind     string `json:"kind"`   // Category within the detector, e.g. EMAIL
+	Offset   int    `json:"offset"` // Byte offset of the match in the prompt
+}
+
+// Detector inspects a prompt locally, without calling an LLM
+type Detector interface {
+	// Name returns the identifier used in configuration and findings
+	Name() string
+
+	// Detect returns the findings for a prompt
+	Detect(text string) []Finding
+}
+
+// Report is the combined result of running detectors over a prompt
+type Report struct {
+	Findings     []Finding `json:"findings,omitempty"`
+	TokenCount   int       `json:"tokenCount"` // Rough estimate, about four characters per token
+	ContainsPII  bool      `json:"containsPII"`
+	IsSuspicious bool      `json:"isSuspicious"`
+	RiskScore    int       `json:"riskScore"` // Heuristic score from 1-10
+}
+
+// Names lists the available detectors
+var Names = []string{"pii", "jailbreak"}
+
+// New creates the detector with the given name
+func New(name string) (Detector, error) {
+	switch name {
+	case "pii":
+		return PII{}, nil
+	case "jailbreak":
+		return Jailbreak{}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDetector, name)
+	}
+}
+
+// Load creates the named detectors, or every detector when names is empty
+func Load(names []string) ([]Detector, error) {
+	if len(names) == 0 {
+		names = Names
+	}
+
+	detectors := make([]Detector, 0, len(names))
+	for _, name := range names {
+		d, err := New(name)
+		if err != nil {
+			return nil, err
+		}
+		detectors = append(detectors, d)
+	}
+	return detectors, nil
+}
+
+// Run runs every detector over the prompt and summarises the findings
+func Run(ctx context.Context, detectors []Detector, text string) Report {
+	report := Report{
+		TokenCount: EstimateTokens(text),
+		RiskScore:  1,
+	}
+
+	for _, d := range detectors {
+		_, span := tracer.Start(ctx, "detect."+d.Name())
+		findings := d.Detect(text)
+		span.SetAttributes(attribute.Int("detect.findings", len(findings)))
+		span.End()
+		report.Findings = append(report.Findings, findings...)
+	}
+
+	// Derive the flags and a heuristic risk score from the findings
+	for _, f := range report.Findings {
+		switch f.Detector {
+		case "pii":
+			report.ContainsPII = true
+		case "jailbreak":
+			report.IsSuspicious = true
+		}
+	}
+	if report.ContainsPII {
+		report.RiskScore += 3
+	}
+	if report.IsSuspicious {
+		report.RiskScore += 6
+	}
+	if report.RiskScore > 10 {
+		report.RiskScore = 10
+	}
+
+	return report
+}
+
+// EstimateTokens approximates the token count of a prompt
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
@@ -0,0 +1,40 @@
+package detect
+
+import (
+	"regexp"
+)
+
+// jailbreakPattern pairs a jailbreak technique with the phrasing that signals it
+type jailbreakPattern struct {
+	Kind    string
+	Pattern *regexp.Regexp
+}
+
+// jailbreakPatterns lists common jailbreak and prompt injection phrasings
+var jailbreakPatterns = []jailbreakPattern{
+	{Kind: "IGNORE_INSTRUCTIONS", Pattern: regexp.MustCompile(`(?i)\b(ignore|disregard|forget)\s+(all\s+)?(the\s+|your\s+|any\s+)?(previous|prior|above|earlier|system)\s+(instructions|prompts?|rules|messages)`)},
+	{Kind: "ROLE_OVERRIDE", Pattern: regexp.MustCompile(`(?i)\byou\s+are\s+(now\s+)?(DAN|in\s+developer\s+mode|an?\s+unrestricted|jailbroken)\b`)},
+	{Kind: "DEVELOPER_MODE", Pattern: regexp.MustCompile(`(?i)\b(enable|activate|enter)\s+(developer|god|debug)\s+mode\b`)},
+	{Kind: "NO_RESTRICTIONS", Pattern: regexp.MustCompile(`(?i)\b(without|no|free\s+of)\s+(any\s+)?(restrictions|filters|guidelines|limitations|censorship)\b`)},
+	{Kind: "PRETEND", Pattern: regexp.MustCompile(`(?i)\bpretend\s+(that\s+)?you\s+(are|have)\s+(no|not|an?\s+AI\s+without)\b`)},
+	{Kind: "PROMPT_LEAK", Pattern: regexp.MustCompile(`(?i)\b(reveal|print|repeat|show)\s+(me\s+)?(your|the)\s+(system\s+prompt|hidden\s+instructions|initial\s+instructions)\b`)},
+}
+
+// Jailbreak detects phrasing commonly used to override a model's instructions
+type Jailbreak struct{}
+
+// Name returns the detector identifier
+func (Jailbreak) Name() string {
+	return "jailbreak"
+}
+
+// Detect returns one finding per matched jailbreak phrase
+func (Jailbreak) Detect(text string) []Finding {
+	var findings []Finding
+	for _, p := range jailbreakPatterns {
+		for _, loc := range p.Pattern.FindAllStringIndex(text, -1) {
+			findings = append(findings, Finding{Detector: "jailbreak", Kind: p.Kind, Offset: loc[0]})
+		}
+	}
+	return findings
+}
@@ -0,0 +1,22 @@
+package detect
+
+import (
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/prompt"
+)
+
+// PII detects emails, phone numbers, card numbers and similar personal data
+type PII struct{}
+
+// Name returns the detector identifier
+func (PII) Name() string {
+	return "pii"
+}
+
+// Detect returns one finding per recognised piece of PII
+func (PII) Detect(text string) []Finding {
+	var findings []Finding
+	for _, m := range prompt.FindPII(text) {
+		findings = append(findings, Finding{Detector: "pii", Kind: m.Kind, Offset: m.Start})
+	}
+	return findings
+}
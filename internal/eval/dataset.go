@@ -0,0 +1,60 @@
+package eval
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Expected holds the labels for a case. Nil fields are not scored.
+type Expected struct {
+	PromptType   *string `json:"promptType,omitempty"`
+	ContainsPII  *bool   `json:"containsPII,omitempty"`
+	IsSuspicious *bool   `json:"isSuspicious,omitempty"`
+	RiskMin      *int    `json:"riskMin,omitempty"`
+	RiskMax      *int    `json:"riskMax,omitempty"`
+}
+
+// Case is one labeled prompt in a dataset
+type Case struct {
+	ID       string   `json:"id"`
+	Prompt   string   `json:"prompt"`
+	Expected Expected `json:"expected"`
+}
+
+// LoadDataset reads a JSONL dataset with one case per line
+func LoadDataset(path string) ([]Case, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening dataset: %w", err)
+	}
+	defer file.Close()
+
+	var cases []Case
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var c Case
+		if err := json.Unmarshal([]byte(text), &c); err != nil {
+			return nil, fmt.Errorf("dataset line %d: %w", line, err)
+		}
+		if c.ID == "" {
+			c.ID = fmt.Sprintf("line-%d", line)
+		}
+		cases = append(cases, c)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading dataset: %w", err)
+	}
+
+	return cases, nil
+}
@@ -0,0 +1,138 @@
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/batch"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/detect"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/llm"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/usage"
+)
+
+// Report is the result of evaluating one or more providers on a dataset
+type Report struct {
+	Dataset   string           `json:"dataset"`
+	Cases     int              `json:"cases"`
+	Providers []ProviderReport `json:"providers"`
+}
+
+// ProviderReport holds the metrics for one provider
+type ProviderReport struct {
+	Provider     string         `json:"provider"`
+	Model        string         `json:"model"`
+	Errors       int            `json:"errors"` // Cases the provider failed to analyze; excluded from scoring
+	ContainsPII  BinaryMetrics  `json:"containsPII"`
+	IsSuspicious BinaryMetrics  `json:"isSuspicious"`
+	PromptType   TypeMetrics    `json:"promptType"`
+	Risk         RiskMetrics    `json:"riskScore"`
+	Latency      LatencyMetrics `json:"latency"`
+	Cost         CostMetrics    `json:"cost"`
+}
+
+// Run analyzes every case with each provider and scores the results
+func Run(ctx context.Context, cfg *config.Config, datasetName string, cases []Case, providers []llm.LLM, concurrency int) (*Report, error) {
+	report := &Report{Dataset: datasetName, Cases: len(cases)}
+
+	for _, provider := range providers {
+		pr, err := runProvider(ctx, cfg, cases, provider, concurrency)
+		if err != nil {
+			return nil, err
+		}
+		report.Providers = append(report.Providers, *pr)
+	}
+
+	return report, nil
+}
+
+// runProvider evaluates a single provider
+func runProvider(ctx context.Context, cfg *config.Config, cases []Case, provider llm.LLM, concurrency int) (*ProviderReport, error) {
+	pr := &ProviderReport{
+		Provider: provider.Name(),
+		Model:    provider.Model(),
+	}
+
+	// Analyze the cases, reusing the batch runner for concurrency
+	items := make([]batch.Item, len(cases))
+	for i, c := range cases {
+		items[i] = batch.Item{Line: i + 1, ID: c.ID, Prompt: c.Prompt}
+	}
+	var latencies []int64
+	_, err := batch.Run(ctx, provider, batch.NewSliceReader(items), batch.Options{Concurrency: concurrency}, func(result batch.Result) error {
+		c := cases[result.Line-1]
+		pr.addCost(cfg, c.Prompt, result)
+		if result.Error != "" || result.Analysis == nil {
+			pr.Errors++
+			return nil
+		}
+		pr.score(c.Expected, result.Analysis)
+		latencies = append(latencies, result.Latency)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error evaluating %s: %w", provider.Name(), err)
+	}
+
+	// Compute the summary metrics
+	pr.ContainsPII.finish()
+	pr.IsSuspicious.finish()
+	pr.PromptType.finish()
+	pr.Risk.finish()
+	pr.Latency = newLatencyMetrics(latencies)
+	// Price the tokens as the usage ledger does
+	used := llm.Usage{InputTokens: pr.Cost.InputTokens, OutputTokens: pr.Cost.OutputTokens}
+	if cost, ok := usage.Cost(cfg, pr.Model, used); ok {
+		pr.Cost.Priced = true
+		pr.Cost.USD = round(cost)
+	}
+
+	return pr, nil
+}
+
+// score adds one analysis to the metrics for every labeled field
+func (pr *ProviderReport) score(expected Expected, analysis *llm.PromptAnalysis) {
+	if expected.ContainsPII != nil {
+		pr.ContainsPII.add(*expected.ContainsPII, analysis.ContainsPII)
+	}
+	if expected.IsSuspicious != nil {
+		pr.IsSuspicious.add(*expected.IsSuspicious, analysis.IsSuspicious)
+	}
+	if expected.PromptType != nil {
+		pr.PromptType.add(strings.ToLower(*expected.PromptType), strings.ToLower(analysis.PromptType))
+	}
+	if expected.RiskMin != nil || expected.RiskMax != nil {
+		minScore, maxScore := 1, 10
+		if expected.RiskMin != nil {
+			minScore = *expected.RiskMin
+		}
+		if expected.RiskMax != nil {
+			maxScore = *expected.RiskMax
+		}
+		pr.Risk.add(minScore, maxScore, analysis.RiskScore)
+	}
+}
+
+// addCost adds the tokens one case used, as reported by the provider. Failed
+// calls are counted too, since they were still billed. When the provider
+// reported no usage, the tokens are estimated from the request and response
+// text; a failed call has no response, so its output tokens are unknown and
+// it is counted as unmetered.
+func (pr *ProviderReport) addCost(cfg *config.Config, promptText string, result batch.Result) {
+	if result.Usage != nil {
+		pr.Cost.InputTokens += result.Usage.InputTokens
+		pr.Cost.OutputTokens += result.Usage.OutputTokens
+		return
+	}
+
+	pr.Cost.Estimated = true
+	pr.Cost.InputTokens += detect.EstimateTokens(cfg.Analysis.SystemPrompt) + detect.EstimateTokens("Analyze this prompt: "+promptText)
+	if result.Analysis == nil {
+		pr.Cost.Unmetered++
+		return
+	}
+	output, _ := json.Marshal(result.Analysis)
+	pr.Cost.OutputTokens += detect.EstimateTokens(string(output))
+}
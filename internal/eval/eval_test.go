@@ -0,0 +1,39 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/batch"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/llm"
+)
+
+func TestAddCost(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Analysis.SystemPrompt = "Analyze the prompt"
+
+	tests := []struct {
+		name          string
+		result        batch.Result
+		wantEstimated bool
+		wantUnmetered int
+		wantOutput    bool // Output tokens are counted
+	}{
+		{"reported usage", batch.Result{Usage: &llm.Usage{InputTokens: 10, OutputTokens: 5}}, false, 0, true},
+		{"failed call with usage", batch.Result{Error: "parse error", Usage: &llm.Usage{InputTokens: 10, OutputTokens: 5}}, false, 0, true},
+		{"analysis without usage", batch.Result{Analysis: &llm.PromptAnalysis{PromptType: "coding"}}, true, 0, true},
+		{"failed call without usage", batch.Result{Error: "timeout"}, true, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pr ProviderReport
+			pr.addCost(cfg, "Write a sort function", tt.result)
+			if pr.Cost.Estimated != tt.wantEstimated || pr.Cost.Unmetered != tt.wantUnmetered {
+				t.Errorf("cost = %+v, want estimated %v, unmetered %d", pr.Cost, tt.wantEstimated, tt.wantUnmetered)
+			}
+			if pr.Cost.InputTokens == 0 || (pr.Cost.OutputTokens > 0) != tt.wantOutput {
+				t.Errorf("tokens = %d input, %d output", pr.Cost.InputTokens, pr.Cost.OutputTokens)
+			}
+		})
+	}
+}
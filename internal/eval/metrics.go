@@ -0,0 +1,199 @@
+package eval
+
+import (
+	"math"
+	"sort"
+)
+
+// BinaryMetrics scores a true/false field
+type BinaryMetrics struct {
+	TruePositives  int     `json:"truePositives"`
+	FalsePositives int     `json:"falsePositives"`
+	FalseNegatives int     `json:"falseNegatives"`
+	TrueNegatives  int     `json:"trueNegatives"`
+	Precision      float64 `json:"precision"`
+	Recall         float64 `json:"recall"`
+	F1             float64 `json:"f1"`
+}
+
+// add records one labeled prediction
+func (m *BinaryMetrics) add(expected, actual bool) {
+	switch {
+	case expected && actual:
+		m.TruePositives++
+	case !expected && actual:
+		m.FalsePositives++
+	case expected && !actual:
+		m.FalseNegatives++
+	default:
+		m.TrueNegatives++
+	}
+}
+
+// finish computes the ratios from the counts
+func (m *BinaryMetrics) finish() {
+	m.Precision, m.Recall, m.F1 = prf(m.TruePositives, m.FalsePositives, m.FalseNegatives)
+}
+
+// ClassMetrics scores one prompt type
+type ClassMetrics struct {
+	Support   int     `json:"support"` // Cases labeled with this type
+	Precision float64 `json:"precision"`
+	Recall    float64 `json:"recall"`
+	F1        float64 `json:"f1"`
+}
+
+// TypeMetrics scores the prompt type classification
+type TypeMetrics struct {
+	Accuracy float64                   `json:"accuracy"`
+	Classes  map[string]ClassMetrics   `json:"classes"`
+	Matrix   map[string]map[string]int `json:"confusionMatrix"` // expected -> predicted -> count
+}
+
+// add records one labeled prediction
+func (m *TypeMetrics) add(expected, actual string) {
+	if m.Matrix == nil {
+		m.Matrix = make(map[string]map[string]int)
+	}
+	if m.Matrix[expected] == nil {
+		m.Matrix[expected] = make(map[string]int)
+	}
+	m.Matrix[expected][actual]++
+}
+
+// finish computes accuracy and per-class scores from the confusion matrix
+func (m *TypeMetrics) finish() {
+	m.Classes = make(map[string]ClassMetrics)
+	total, correct := 0, 0
+	for _, class := range m.Labels() {
+		tp := m.Matrix[class][class]
+		fp, fn, support := 0, 0, 0
+		for expected, row := range m.Matrix {
+			for predicted, count := range row {
+				if expected == class {
+					support += count
+					if predicted != class {
+						fn += count
+					}
+				} else if predicted == class {
+					fp += count
+				}
+			}
+		}
+		p, r, f := prf(tp, fp, fn)
+		m.Classes[class] = ClassMetrics{Support: support, Precision: p, Recall: r, F1: f}
+		total += support
+		correct += tp
+	}
+	if total > 0 {
+		m.Accuracy = round(float64(correct) / float64(total))
+	}
+}
+
+// Labels returns every type that appears as expected or predicted, sorted
+func (m *TypeMetrics) Labels() []string {
+	seen := make(map[string]bool)
+	for expected, row := range m.Matrix {
+		seen[expected] = true
+		for predicted := range row {
+			seen[predicted] = true
+		}
+	}
+	labels := make([]string, 0, len(seen))
+	for label := range seen {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// RiskMetrics scores the risk score against the labeled range
+type RiskMetrics struct {
+	Scored  int     `json:"scored"`
+	MAE     float64 `json:"mae"`     // Mean distance outside the expected range
+	InRange float64 `json:"inRange"` // Fraction of scores within the expected range
+	errSum  int
+	inCount int
+}
+
+// add records one score against its expected range
+func (m *RiskMetrics) add(minScore, maxScore, actual int) {
+	m.Scored++
+	switch {
+	case actual < minScore:
+		m.errSum += minScore - actual
+	case actual > maxScore:
+		m.errSum += actual - maxScore
+	default:
+		m.inCount++
+	}
+}
+
+// finish computes the averages
+func (m *RiskMetrics) finish() {
+	if m.Scored > 0 {
+		m.MAE = round(float64(m.errSum) / float64(m.Scored))
+		m.InRange = round(float64(m.inCount) / float64(m.Scored))
+	}
+}
+
+// LatencyMetrics summarises response latency in milliseconds
+type LatencyMetrics struct {
+	Mean int64 `json:"mean"`
+	P50  int64 `json:"p50"`
+	P90  int64 `json:"p90"`
+	P99  int64 `json:"p99"`
+}
+
+// newLatencyMetrics computes percentiles using the nearest-rank method
+func newLatencyMetrics(samples []int64) LatencyMetrics {
+	if len(samples) == 0 {
+		return LatencyMetrics{}
+	}
+	sorted := append([]int64(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var sum int64
+	for _, s := range sorted {
+		sum += s
+	}
+	rank := func(p float64) int64 {
+		i := int(math.Ceil(p*float64(len(sorted)))) - 1
+		return sorted[max(i, 0)]
+	}
+	return LatencyMetrics{
+		Mean: sum / int64(len(sorted)),
+		P50:  rank(0.50),
+		P90:  rank(0.90),
+		P99:  rank(0.99),
+	}
+}
+
+// CostMetrics totals the token usage and cost of a run
+type CostMetrics struct {
+	InputTokens  int     `json:"inputTokens"`
+	OutputTokens int     `json:"outputTokens"`
+	USD          float64 `json:"usd"`
+	Estimated    bool    `json:"estimated"` // Some token counts are estimated from text length
+	Unmetered    int     `json:"unmetered"` // Failed calls with no reported usage, whose output tokens are unknown
+	Priced       bool    `json:"priced"`    // A price is configured for the model
+}
+
+// prf computes precision, recall and F1, treating empty denominators as zero
+func prf(tp, fp, fn int) (precision, recall, f1 float64) {
+	if tp+fp > 0 {
+		precision = float64(tp) / float64(tp+fp)
+	}
+	if tp+fn > 0 {
+		recall = float64(tp) / float64(tp+fn)
+	}
+	if precision+recall > 0 {
+		f1 = 2 * precision * recall / (precision + recall)
+	}
+	return round(precision), round(recall), round(f1)
+}
+
+// round keeps four decimal places so reports diff cleanly between runs
+func round(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
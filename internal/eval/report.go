@@ -0,0 +1,169 @@
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+)
+
+// Change is the difference in one metric between a baseline and a new run
+type Change struct {
+	Provider   string
+	Metric     string
+	Baseline   float64
+	Current    float64
+	Regression bool
+}
+
+// LoadReport reads a JSON report written by a previous run
+func LoadReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading baseline: %w", err)
+	}
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("error parsing baseline: %w", err)
+	}
+	return &report, nil
+}
+
+// WriteJSON writes the report as indented JSON with stable key order, so
+// reports from different runs can be diffed directly
+func WriteJSON(w io.Writer, report *Report) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// WriteText writes a human-readable summary of the report
+func WriteText(w io.Writer, report *Report) {
+	fmt.Fprintf(w, "Dataset: %s (%d cases)\n", report.Dataset, report.Cases)
+
+	for _, pr := range report.Providers {
+		fmt.Fprintf(w, "\n== %s (%s) ==\n", pr.Provider, pr.Model)
+		if pr.Errors > 0 {
+			fmt.Fprintf(w, "Errors: %d cases failed and were not scored\n", pr.Errors)
+		}
+
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "FIELD\tPRECISION\tRECALL\tF1\tTP\tFP\tFN\tTN")
+		for _, row := range []struct {
+			name string
+			m    BinaryMetrics
+		}{{"containsPII", pr.ContainsPII}, {"isSuspicious", pr.IsSuspicious}} {
+			fmt.Fprintf(tw, "%s\t%.3f\t%.3f\t%.3f\t%d\t%d\t%d\t%d\n", row.name, row.m.Precision, row.m.Recall, row.m.F1,
+				row.m.TruePositives, row.m.FalsePositives, row.m.FalseNegatives, row.m.TrueNegatives)
+		}
+		tw.Flush()
+
+		// Prompt type scores and confusion matrix
+		fmt.Fprintf(w, "\nPrompt type accuracy: %.3f\n", pr.PromptType.Accuracy)
+		labels := pr.PromptType.Labels()
+		if len(labels) > 0 {
+			tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "TYPE\tSUPPORT\tPRECISION\tRECALL\tF1")
+			for _, label := range labels {
+				c := pr.PromptType.Classes[label]
+				fmt.Fprintf(tw, "%s\t%d\t%.3f\t%.3f\t%.3f\n", label, c.Support, c.Precision, c.Recall, c.F1)
+			}
+			tw.Flush()
+
+			fmt.Fprintln(w, "\nConfusion matrix (rows expected, columns predicted):")
+			tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			fmt.Fprint(tw, "\t")
+			for _, label := range labels {
+				fmt.Fprintf(tw, "%s\t", label)
+			}
+			fmt.Fprintln(tw)
+			for _, expected := range labels {
+				fmt.Fprintf(tw, "%s\t", expected)
+				for _, predicted := range labels {
+					fmt.Fprintf(tw, "%d\t", pr.PromptType.Matrix[expected][predicted])
+				}
+				fmt.Fprintln(tw)
+			}
+			tw.Flush()
+		}
+
+		// Risk, latency and cost
+		fmt.Fprintf(w, "\nRisk score: MAE %.3f, in range %.1f%% (%d scored)\n", pr.Risk.MAE, pr.Risk.InRange*100, pr.Risk.Scored)
+		fmt.Fprintf(w, "Latency: mean %dms, p50 %dms, p90 %dms, p99 %dms\n", pr.Latency.Mean, pr.Latency.P50, pr.Latency.P90, pr.Latency.P99)
+		cost := "no price configured"
+		if pr.Cost.Priced {
+			cost = fmt.Sprintf("$%.4f", pr.Cost.USD)
+		}
+		estimated := ""
+		switch {
+		case pr.Cost.Unmetered > 0:
+			estimated = fmt.Sprintf(" (estimated; output unknown for %d failed calls)", pr.Cost.Unmetered)
+		case pr.Cost.Estimated:
+			estimated = " (estimated)"
+		}
+		fmt.Fprintf(w, "Tokens%s: %d input, %d output; cost %s\n", estimated, pr.Cost.InputTokens, pr.Cost.OutputTokens, cost)
+	}
+}
+
+// Compare lists metric changes between a baseline and the current report for
+// providers present in both. Quality metrics regress when they drop by more
+// than tolerance; risk MAE regresses when it rises by more than maeTolerance.
+func Compare(baseline, current *Report, tolerance, maeTolerance float64) []Change {
+	previous := make(map[string]ProviderReport)
+	for _, pr := range baseline.Providers {
+		previous[pr.Provider+"/"+pr.Model] = pr
+	}
+
+	var changes []Change
+	for _, cur := range current.Providers {
+		base, ok := previous[cur.Provider+"/"+cur.Model]
+		if !ok {
+			continue
+		}
+		name := cur.Provider + " (" + cur.Model + ")"
+
+		// Higher is better
+		for _, m := range []struct {
+			metric        string
+			before, after float64
+		}{
+			{"containsPII.f1", base.ContainsPII.F1, cur.ContainsPII.F1},
+			{"isSuspicious.f1", base.IsSuspicious.F1, cur.IsSuspicious.F1},
+			{"promptType.accuracy", base.PromptType.Accuracy, cur.PromptType.Accuracy},
+			{"riskScore.inRange", base.Risk.InRange, cur.Risk.InRange},
+		} {
+			changes = append(changes, Change{
+				Provider:   name,
+				Metric:     m.metric,
+				Baseline:   m.before,
+				Current:    m.after,
+				Regression: m.before-m.after > tolerance,
+			})
+		}
+
+		// Lower is better
+		changes = append(changes, Change{
+			Provider:   name,
+			Metric:     "riskScore.mae",
+			Baseline:   base.Risk.MAE,
+			Current:    cur.Risk.MAE,
+			Regression: cur.Risk.MAE-base.Risk.MAE > maeTolerance,
+		})
+	}
+	return changes
+}
+
+// WriteComparison writes metric changes, marking regressions
+func WriteComparison(w io.Writer, changes []Change) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROVIDER\tMETRIC\tBASELINE\tCURRENT\tDELTA\t")
+	for _, c := range changes {
+		flag := ""
+		if c.Regression {
+			flag = "REGRESSION"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%.3f\t%.3f\t%+.3f\t%s\n", c.Provider, c.Metric, c.Baseline, c.Current, c.Current-c.Baseline, flag)
+	}
+	tw.Flush()
+}
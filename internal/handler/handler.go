@@ -1,47 +1,137 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
-	"log"
+	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/auth"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/batch"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/cache"
 	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/detect"
 	"github.com/rlnorthcutt/ai-prompt-analysis/internal/llm"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/logging"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/metrics"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/policy"
 	"github.com/rlnorthcutt/ai-prompt-analysis/internal/prompt"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/ratelimit"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/store"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/tenant"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/usage"
+)
+
+// defaultShutdownGrace is used when server.shutdown_grace is unset
+const defaultShutdownGrace = 30 * time.Second
+
+// Request body limits used when server.max_body_bytes and
+// batch.max_body_bytes are unset
+const (
+	defaultMaxBodyBytes      = 1 << 20
+	defaultMaxBatchBodyBytes = 32 << 20
 )
 
 // Handler provides HTTP handlers for the API
 type Handler struct {
-	claudeAPI  llm.LLM
-	chatGPTAPI llm.LLM
+	claudeAPI  *llm.Instrumented
+	chatGPTAPI *llm.Instrumented
+	mockAPI    *llm.Instrumented
 	config     *config.Config
+	tenants    *tenant.Registry
 	templates  *template.Template
 	routes     Routes
+	store      store.Store
+	jobs       *batch.Manager
+	ledger     *usage.Ledger
+	cache      *cache.Cache
+	auth       *auth.Authenticator
+	limiter    *ratelimit.Limiter
+	mux        *http.ServeMux
+	started    time.Time
+	readiness  readinessCache
+	draining   atomic.Bool
 }
 
 // Routes defines the API endpoints
 type Routes struct {
 	Claude     string
 	ChatGPT    string
+	Mock       string
 	Demo       string
 	DemoSubmit string
+	Records    string
+	Batch      string
+	Metrics    string
+	Health     string
+	Ready      string
+	Status     string
+	Usage      string
 }
 
-// AnalysisResponse extends the prompt analysis with latency information
+// AnalysisResponse extends the prompt analysis with latency, usage and cost
 type AnalysisResponse struct {
 	llm.PromptAnalysis
-	Latency int64 `json:"latency"` // Response latency in milliseconds
+	Latency    int64            `json:"latency"`              // Response latency in milliseconds
+	Usage      *llm.Usage       `json:"usage,omitempty"`      // Tokens reported by the provider
+	CostUSD    *float64         `json:"costUsd,omitempty"`    // Omitted when the model has no price
+	Cached     bool             `json:"cached,omitempty"`     // The analysis was reused from the cache
+	Similarity *float64         `json:"similarity,omitempty"` // Similarity of the near-duplicate the analysis was reused from
+	Findings   []detect.Finding `json:"findings,omitempty"`   // Issues found by the tenant's local detectors
+	ID         string           `json:"id,omitempty"`         // Stored record ID, when persistence is enabled
+	Decision   *policy.Decision `json:"decision"`             // Outcome of the configured policy
 }
 
 // NewHandler creates a new Handler instance with initialized LLM providers
-func NewHandler(cfg *config.Config) *Handler {
-	// Initialize LLM providers
-	claudeAPI := llm.NewClaude(cfg)
-	chatGPTAPI := llm.NewChatGPT(cfg)
+// and batch workers. The store may be nil, in which case analyses are not
+// persisted. Policy and retention come from the caller's tenant settings.
+func NewHandler(cfg *config.Config, st store.Store, tenants *tenant.Registry) (*Handler, error) {
+	// Initialize LLM providers, recording metrics for each analysis
+	claudeAPI := llm.Instrument(llm.NewClaude(cfg), cfg)
+	chatGPTAPI := llm.Instrument(llm.NewChatGPT(cfg), cfg)
+	mock, err := llm.NewMock(cfg)
+	if err != nil {
+		return nil, err
+	}
+	mockAPI := llm.Instrument(mock, cfg)
+
+	// Open the usage ledger
+	ledger, err := usage.NewLedger(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Open the analysis cache (nil when caching is disabled)
+	analysisCache, err := cache.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Start the batch job workers
+	jobs, err := batch.NewManager(cfg, map[string]llm.LLM{
+		"claude":  claudeAPI,
+		"chatgpt": chatGPTAPI,
+		"mock":    mockAPI,
+	}, ledger, tenants, analysisCache)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load client credentials (nil when authentication is disabled)
+	authenticator, err := auth.New(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load API keys: %w", err)
+	}
 
 	// Load templates
 	templates := template.Must(template.ParseGlob("templates/*.html"))
@@ -50,17 +140,35 @@ func NewHandler(cfg *config.Config) *Handler {
 	routes := Routes{
 		Claude:     "/analyze/claude",
 		ChatGPT:    "/analyze/chatgpt",
+		Mock:       "/analyze/mock",
 		Demo:       "/analyze",
 		DemoSubmit: "/analyze/submit",
+		Records:    "/records",
+		Batch:      "/batch",
+		Metrics:    "/metrics",
+		Health:     "/healthz",
+		Ready:      "/readyz",
+		Status:     "/status",
+		Usage:      "/usage",
 	}
 
 	return &Handler{
 		claudeAPI:  claudeAPI,
 		chatGPTAPI: chatGPTAPI,
+		mockAPI:    mockAPI,
 		config:     cfg,
+		tenants:    tenants,
 		templates:  templates,
 		routes:     routes,
-	}
+		store:      st,
+		jobs:       jobs,
+		ledger:     ledger,
+		cache:      analysisCache,
+		auth:       authenticator,
+		limiter:    ratelimit.New(cfg),
+		mux:        http.NewServeMux(),
+		started:    time.Now(),
+	}, nil
 }
 
 // GetLLMProviders returns the initialized LLM providers
@@ -68,40 +176,170 @@ func (h *Handler) GetLLMProviders() (claude llm.LLM, chatgpt llm.LLM) {
 	return h.claudeAPI, h.chatGPTAPI
 }
 
-// RegisterRoutes registers all HTTP routes
+// providerByName returns the provider for an identifier accepted by
+// llm.NewProvider, or nil if there is none
+func (h *Handler) providerByName(name string) *llm.Instrumented {
+	switch name {
+	case "claude":
+		return h.claudeAPI
+	case "chatgpt":
+		return h.chatGPTAPI
+	case "mock":
+		return h.mockAPI
+	default:
+		return nil
+	}
+}
+
+// RegisterRoutes registers all HTTP routes on the handler's private mux
 func (h *Handler) RegisterRoutes() {
 	// Register API endpoints
-	http.HandleFunc(h.routes.Claude, h.ClaudeHandler())
-	http.HandleFunc(h.routes.ChatGPT, h.ChatGPTHandler())
+	h.mux.HandleFunc(h.routes.Claude, instrument(h.routes.Claude, "claude", h.guard(h.routes.Claude, auth.ScopeAnalyze, h.budget(h.ClaudeHandler()))))
+	h.mux.HandleFunc(h.routes.ChatGPT, instrument(h.routes.ChatGPT, "chatgpt", h.guard(h.routes.ChatGPT, auth.ScopeAnalyze, h.budget(h.ChatGPTHandler()))))
+	if h.config.Mock.Enabled {
+		h.mux.HandleFunc(h.routes.Mock, instrument(h.routes.Mock, "mock", h.guard(h.routes.Mock, auth.ScopeAnalyze, h.budget(h.HandleAnalyze(h.mockAPI)))))
+	}
+
+	// Asynchronous batch jobs
+	h.handleLimited("POST "+h.routes.Batch, auth.ScopeBatch, h.budget(h.HandleBatchSubmit()))
+	h.handleLimited("GET "+h.routes.Batch+"/{id}", auth.ScopeBatch, h.HandleBatchStatus())
+	h.handleLimited("GET "+h.routes.Batch+"/{id}/results", auth.ScopeBatch, h.HandleBatchResults())
+
+	// Record deletion for data subject requests (only if persistence is enabled)
+	if h.store != nil {
+		h.handleAuthorized("DELETE "+h.routes.Records+"/{id}", auth.ScopeHistory, h.HandleDeleteRecord())
+		h.handleAuthorized("DELETE "+h.routes.Records, auth.ScopeHistory, h.HandleDeleteUserRecords())
+	}
 
-	// Demo UI (only if enabled in config)
+	// Demo UI (only if enabled in config; validation rules it out with auth)
 	if h.config.Server.DemoUI {
-		http.HandleFunc(h.routes.Demo, h.HandleDemoUI())
-		http.HandleFunc(h.routes.DemoSubmit, h.HandleFormSubmit())
+		h.handle(h.routes.Demo, h.HandleDemoUI())
+		h.handle(h.routes.DemoSubmit, h.HandleFormSubmit())
 	}
+
+	// Health and status; probes are not logged, counted or authenticated
+	h.mux.HandleFunc("GET "+h.routes.Health, h.HandleHealth())
+	h.mux.HandleFunc("GET "+h.routes.Ready, h.HandleReady())
+	h.handleAuthorized("GET "+h.routes.Status, auth.ScopeAdmin, h.HandleStatus())
+
+	// Usage reports for charging back spending
+	h.handleAuthorized("GET "+h.routes.Usage, auth.ScopeAdmin, h.HandleUsageReport())
+
+	// Prometheus metrics (only if enabled in config)
+	if h.config.Server.Metrics {
+		h.mux.HandleFunc("GET "+h.routes.Metrics, h.limitIP(h.routes.Metrics, h.authorize(auth.ScopeAdmin, metrics.Handler().ServeHTTP)))
+	}
+}
+
+// handle registers a route that is not tied to a provider, counting its
+// requests under the route pattern
+func (h *Handler) handle(pattern string, handler http.HandlerFunc) {
+	h.mux.HandleFunc(pattern, instrument(pattern, "", handler))
+}
+
+// handleAuthorized registers a route that requires the scope. Callers are
+// limited by address before they authenticate.
+func (h *Handler) handleAuthorized(pattern, scope string, handler http.HandlerFunc) {
+	h.handle(pattern, h.limitIP(pattern, h.authorize(scope, handler)))
+}
+
+// handleLimited registers a route that requires the scope and is subject to
+// the client rate limits
+func (h *Handler) handleLimited(pattern, scope string, handler http.HandlerFunc) {
+	h.handle(pattern, h.guard(pattern, scope, handler))
 }
 
-// StartServer starts the HTTP server
-func (h *Handler) StartServer() error {
+// guard limits callers by address, authenticates them, checks the scope and
+// then applies the client rate limits
+func (h *Handler) guard(route, scope string, next http.HandlerFunc) http.HandlerFunc {
+	return h.limitIP(route, h.authorize(scope, h.limit(route, next)))
+}
+
+// StartServer starts the HTTP server and blocks until ctx is cancelled. It
+// then stops accepting connections and waits up to server.shutdown_grace for
+// in-flight requests and batch analyses to finish.
+func (h *Handler) StartServer(ctx context.Context) error {
 	// Get server address
 	serverAddr := fmt.Sprintf(":%s", h.config.Server.Port)
 	baseURL := fmt.Sprintf("http://localhost%s", serverAddr)
 
 	// Log server information
-	log.Printf("Starting server on %s...\n", serverAddr)
-	log.Printf("Claude API available: %v", h.claudeAPI.IsAvailable())
-	log.Printf("ChatGPT API available: %v", h.chatGPTAPI.IsAvailable())
-	log.Printf("Demo UI enabled: %v", h.config.Server.DemoUI)
-	log.Printf("Endpoints:")
-	log.Printf("  - Claude:  %s%s", baseURL, h.routes.Claude)
-	log.Printf("  - ChatGPT: %s%s", baseURL, h.routes.ChatGPT)
-	if h.config.Server.DemoUI {
-		log.Printf("  - Demo UI: %s%s", baseURL, h.routes.Demo)
+	slog.Info("starting server",
+		"addr", serverAddr,
+		"claude_available", h.claudeAPI.IsAvailable(),
+		"chatgpt_available", h.chatGPTAPI.IsAvailable(),
+		"mock_enabled", h.mockAPI.IsAvailable(),
+		"demo_ui", h.config.Server.DemoUI,
+		"persistence", h.store != nil,
+		"auth", h.auth != nil,
+	)
+	endpoints := []struct {
+		name    string
+		route   string
+		enabled bool
+	}{
+		{"claude", h.routes.Claude, true},
+		{"chatgpt", h.routes.ChatGPT, true},
+		{"mock", h.routes.Mock, h.config.Mock.Enabled},
+		{"batch", h.routes.Batch, true},
+		{"records", h.routes.Records, h.store != nil},
+		{"demo", h.routes.Demo, h.config.Server.DemoUI},
+		{"metrics", h.routes.Metrics, h.config.Server.Metrics},
+		{"status", h.routes.Status, true},
+	}
+	for _, e := range endpoints {
+		if e.enabled {
+			slog.Info("endpoint", "name", e.name, "url", baseURL+e.route)
+		}
+	}
+
+	// Configure the server
+	srv := &http.Server{
+		Addr:              serverAddr,
+		Handler:           h.mux,
+		ReadTimeout:       h.config.Server.ReadTimeout,
+		ReadHeaderTimeout: h.config.Server.ReadHeaderTimeout,
+		WriteTimeout:      h.config.Server.WriteTimeout,
+		IdleTimeout:       h.config.Server.IdleTimeout,
+		MaxHeaderBytes:    h.config.Server.MaxHeaderBytes,
+	}
+
+	// Start the server in the background
+	errs := make(chan error, 1)
+	go func() {
+		slog.Info("server listening", "addr", serverAddr)
+		errs <- srv.ListenAndServe()
+	}()
+
+	// Wait for a failure or a shutdown request
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
 	}
 
-	// Start the server - this will block until the server is stopped
-	log.Printf("Server is now listening on %s\n", serverAddr)
-	return http.ListenAndServe(serverAddr, nil)
+	// Fail readiness so load balancers stop routing here, then drain
+	h.draining.Store(true)
+	grace := h.config.Server.ShutdownGrace
+	if grace <= 0 {
+		grace = defaultShutdownGrace
+	}
+	slog.Info("shutting down", "grace", grace.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("error draining requests: %w", err)
+	}
+	if err := h.jobs.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("error draining batch workers: %w", err)
+	}
+	// Write the usage recorded since the ledger's last flush
+	if err := h.ledger.Close(); err != nil {
+		return fmt.Errorf("error saving usage: %w", err)
+	}
+	slog.Info("server stopped")
+	return nil
 }
 
 // HandleAnalyze handles the generic prompt analysis endpoint
@@ -113,6 +351,13 @@ func (h *Handler) HandleAnalyze(provider llm.LLM) http.HandlerFunc {
 			return
 		}
 
+		// Check the caller's tenant may use the provider
+		settings := h.tenants.FromContext(r.Context())
+		if !settings.Allows(llm.ProviderID(provider)) {
+			http.Error(w, fmt.Sprintf("Forbidden: %s is not enabled for tenant %s", provider.Name(), settings.Name), http.StatusForbidden)
+			return
+		}
+
 		// Check if provider is available
 		if !provider.IsAvailable() {
 			http.Error(w, fmt.Sprintf("%s API key not set", provider.Name()), http.StatusServiceUnavailable)
@@ -121,8 +366,9 @@ func (h *Handler) HandleAnalyze(provider llm.LLM) http.HandlerFunc {
 
 		// Parse request body
 		var req prompt.Request
+		r.Body = http.MaxBytesReader(w, r.Body, bodyLimit(h.config.Server.MaxBodyBytes, defaultMaxBodyBytes))
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+			http.Error(w, fmt.Sprintf("Invalid request body: %v", err), decodeStatus(err))
 			return
 		}
 
@@ -132,14 +378,19 @@ func (h *Handler) HandleAnalyze(provider llm.LLM) http.HandlerFunc {
 			return
 		}
 
-		// Start timing the response
-		startTime := time.Now()
-
-		// Analyze the prompt
-		analysis, err := provider.AnalyzePrompt(req.Prompt)
+		// Analyze the prompt, skipping the cache lookup on request
+		ctx := r.Context()
+		if strings.Contains(r.Header.Get("Cache-Control"), "no-cache") {
+			ctx = cache.WithBypass(ctx)
+		}
+		response, err := h.analyze(ctx, provider, req.Prompt, req.User)
 		if err != nil {
 			// Handle specific errors
+			var quotaErr *llm.QuotaError
 			switch {
+			case errors.As(err, &quotaErr):
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(quotaErr.RetryAfter.Seconds()))))
+				http.Error(w, fmt.Sprintf("%s is at capacity, try again later", provider.Name()), http.StatusServiceUnavailable)
 			case strings.Contains(err.Error(), "API key not set"):
 				http.Error(w, fmt.Sprintf("%s API key not set", provider.Name()), http.StatusServiceUnavailable)
 			default:
@@ -148,15 +399,6 @@ func (h *Handler) HandleAnalyze(provider llm.LLM) http.HandlerFunc {
 			return
 		}
 
-		// Calculate latency in milliseconds
-		latency := time.Since(startTime).Milliseconds()
-
-		// Create extended response with latency
-		response := AnalysisResponse{
-			PromptAnalysis: *analysis,
-			Latency:        latency,
-		}
-
 		// Return the analysis as JSON
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(response); err != nil {
@@ -166,6 +408,122 @@ func (h *Handler) HandleAnalyze(provider llm.LLM) http.HandlerFunc {
 	}
 }
 
+// analyze runs the prompt through the provider with the caller's tenant
+// settings, measures latency and persists the result when a store is
+// configured
+func (h *Handler) analyze(ctx context.Context, provider llm.LLM, promptText, user string) (*AnalysisResponse, error) {
+	// Start timing the response
+	startTime := time.Now()
+
+	// Apply the tenant's model and system prompt
+	settings := h.tenants.FromContext(ctx)
+	if id := auth.FromContext(ctx); id != nil {
+		ctx = llm.WithOverrides(ctx, h.tenants.Overrides(id.Tenant))
+	}
+	model := llm.ModelFor(ctx, provider)
+
+	// Analyze the prompt
+	// Providers are logged by identifier, matching the request log
+	providerID := llm.ProviderID(provider)
+	logger := logging.FromContext(ctx).With(logging.KeyProvider, providerID, logging.KeyModel, model)
+	ctx, used := llm.WithUsage(ctx)
+	analysis, hit, err := h.cache.Analyze(ctx, provider, promptText)
+
+	// Charge the tokens to the caller, including calls that failed after
+	// the provider responded
+	var client, tenant string
+	if id := auth.FromContext(ctx); id != nil {
+		client, tenant = id.Client, id.Tenant
+	}
+	var cost *float64
+	if used.Total() > 0 {
+		if c, priced := h.ledger.Record(client, tenant, providerID, model, *used); priced {
+			cost = &c
+		}
+	}
+
+	if err != nil {
+		logger.Warn("analysis failed",
+			logging.KeyLatency, time.Since(startTime).Milliseconds(),
+			logging.KeyErrorClass, llm.ErrorClass(err),
+			logging.KeyError, err.Error(),
+			logging.Prompt(promptText),
+		)
+		return nil, err
+	}
+
+	// Run the tenant's local detectors, which can only raise the flags and
+	// risk score the policy checks
+	findings := applyDetectors(ctx, settings.Detectors, promptText, analysis)
+
+	// Create extended response with latency in milliseconds
+	response := &AnalysisResponse{
+		PromptAnalysis: *analysis,
+		Latency:        time.Since(startTime).Milliseconds(),
+		CostUSD:        cost,
+		Cached:         hit != nil,
+		Findings:       findings,
+	}
+	if hit != nil && !hit.Exact {
+		response.Similarity = &hit.Similarity
+	}
+	if used.Total() > 0 {
+		response.Usage = used
+	}
+
+	// Check the analysis against the policy
+	_, span := tracer.Start(ctx, "policy.evaluate")
+	decision := settings.Policy.Evaluate(analysis)
+	span.SetAttributes(
+		attribute.String("policy.action", decision.Action),
+		attribute.Int("policy.violations", len(decision.Violations)),
+	)
+	span.End()
+	response.Decision = &decision
+	if len(decision.Violations) == 0 {
+		metrics.PolicyDecisions.WithLabelValues(decision.Action, "none").Inc()
+	}
+	for _, v := range decision.Violations {
+		metrics.PolicyDecisions.WithLabelValues(decision.Action, v.Rule).Inc()
+	}
+	logger.Info("analysis complete",
+		logging.KeyLatency, response.Latency,
+		logging.KeyDecision, decision.Action,
+		"prompt_type", analysis.PromptType,
+		"risk_score", analysis.RiskScore,
+		"input_tokens", used.InputTokens,
+		"output_tokens", used.OutputTokens,
+		"cached", response.Cached,
+		logging.Prompt(promptText),
+	)
+
+	// Persist the result according to the retention mode
+	if h.store != nil {
+		id, err := h.saveRecord(ctx, provider, settings.Retention, promptText, user, response)
+		if err != nil {
+			logger.Error("failed to store analysis", logging.KeyError, err.Error())
+		} else {
+			response.ID = id
+		}
+	}
+
+	return response, nil
+}
+
+// applyDetectors runs the detectors over the prompt and merges their report
+// into the provider's analysis: a flag raised by either is kept, and the
+// higher risk score wins. It returns the findings.
+func applyDetectors(ctx context.Context, detectors []detect.Detector, promptText string, analysis *llm.PromptAnalysis) []detect.Finding {
+	if len(detectors) == 0 {
+		return nil
+	}
+	report := detect.Run(ctx, detectors, promptText)
+	analysis.ContainsPII = analysis.ContainsPII || report.ContainsPII
+	analysis.IsSuspicious = analysis.IsSuspicious || report.IsSuspicious
+	analysis.RiskScore = max(analysis.RiskScore, report.RiskScore)
+	return report.Findings
+}
+
 // ClaudeHandler returns the handler for Claude analysis
 func (h *Handler) ClaudeHandler() http.HandlerFunc {
 	return h.HandleAnalyze(h.claudeAPI)
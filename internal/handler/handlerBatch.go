@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/auth"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/batch"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/llm"
+)
+
+// BatchRequest is the body of a batch job submission
+type BatchRequest struct {
+	Provider string       `json:"provider"`
+	Prompts  []batch.Item `json:"prompts"`
+}
+
+// HandleBatchSubmit queues a batch job and returns its ID
+func (h *Handler) HandleBatchSubmit() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Parse request body
+		var req BatchRequest
+		r.Body = http.MaxBytesReader(w, r.Body, bodyLimit(h.config.Batch.MaxBodyBytes, defaultMaxBatchBodyBytes))
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request body: %v", err), decodeStatus(err))
+			return
+		}
+
+		// Check if provider is available to the caller's tenant
+		provider := h.providerByName(req.Provider)
+		if provider == nil {
+			http.Error(w, fmt.Sprintf("Unknown provider: %q", req.Provider), http.StatusBadRequest)
+			return
+		}
+		if settings := h.tenants.FromContext(r.Context()); !settings.Allows(req.Provider) {
+			http.Error(w, fmt.Sprintf("Forbidden: %s is not enabled for tenant %s", provider.Name(), settings.Name), http.StatusForbidden)
+			return
+		}
+		if !provider.IsAvailable() {
+			http.Error(w, fmt.Sprintf("%s API key not set", provider.Name()), http.StatusServiceUnavailable)
+			return
+		}
+
+		// Queue the job under the caller's identity
+		status, err := h.jobs.Submit(r.Context(), req.Provider, req.Prompts)
+		if err != nil {
+			switch {
+			case errors.Is(err, batch.ErrNoItems), errors.Is(err, batch.ErrTooManyItems), errors.Is(err, llm.ErrUnknownProvider):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			case errors.Is(err, batch.ErrNotResumable):
+				http.Error(w, err.Error(), http.StatusConflict)
+			case errors.Is(err, batch.ErrQueueFull), errors.Is(err, batch.ErrManagerClosed):
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			default:
+				http.Error(w, fmt.Sprintf("Error submitting batch: %v", err), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		// Return the job status with a link to poll
+		w.Header().Set("Location", h.routes.Batch+"/"+status.ID)
+		writeJSON(w, http.StatusAccepted, status)
+	}
+}
+
+// HandleBatchStatus returns the progress of a batch job
+func (h *Handler) HandleBatchStatus() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status, err := h.jobs.Status(r.PathValue("id"))
+		if err != nil || !canAccessJob(r, status) {
+			http.Error(w, "Batch job not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, status)
+	}
+}
+
+// HandleBatchResults streams the results of a finished batch job as JSONL,
+// ordered by prompt position
+func (h *Handler) HandleBatchResults() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status, results, err := h.jobs.Results(r.PathValue("id"))
+		if err != nil || !canAccessJob(r, status) {
+			http.Error(w, "Batch job not found", http.StatusNotFound)
+			return
+		}
+		if status.Status != batch.StatusDone {
+			http.Error(w, fmt.Sprintf("Batch job is %s", status.Status), http.StatusConflict)
+			return
+		}
+
+		// Order results by their position in the submission
+		sort.Slice(results, func(i, j int) bool { return results[i].Line < results[j].Line })
+
+		// Write one result per line
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		encoder := json.NewEncoder(w)
+		for _, result := range results {
+			if err := encoder.Encode(result); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// canAccessJob reports whether the caller may see a job: its own jobs, or any
+// job with the admin scope. Everyone may when authentication is disabled.
+func canAccessJob(r *http.Request, status batch.JobStatus) bool {
+	id := auth.FromContext(r.Context())
+	return id == nil || id.Has(auth.ScopeAdmin) || id.Client == status.Client
+}
+
+// bodyLimit returns the configured request body limit, or def when unset
+func bodyLimit(configured, def int64) int64 {
+	if configured > 0 {
+		return configured
+	}
+	return def
+}
+
+// decodeStatus returns the status code for a request body that could not be
+// decoded
+func decodeStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// writeJSON writes a value as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding response: %v", err), http.StatusInternalServerError)
+	}
+}
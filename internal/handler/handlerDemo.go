@@ -4,23 +4,25 @@ import (
 	"encoding/json"
 	"html/template"
 	"net/http"
-	"time"
-
-	"github.com/rlnorthcutt/ai-prompt-analysis/internal/llm"
 )
 
+// ProviderOption is a provider offered in the demo UI
+type ProviderOption struct {
+	ID   string // Identifier accepted by providerByName
+	Name string
+}
+
 // TemplateData holds data for UI templates
 type TemplateData struct {
-	ClaudeAvailable  bool
-	ChatGPTAvailable bool
-	Error            string
-	TokenCount       int
-	PromptType       string
-	ContainsPII      bool
-	IsSuspicious     bool
-	RiskScore        int
-	Latency          int64
-	RawJSON          string
+	Providers    []ProviderOption // Available providers
+	Error        string
+	TokenCount   int
+	PromptType   string
+	ContainsPII  bool
+	IsSuspicious bool
+	RiskScore    int
+	Latency      int64
+	RawJSON      string
 }
 
 // HandleDemoUI handles the demo UI page
@@ -33,9 +35,11 @@ func (h *Handler) HandleDemoUI() http.HandlerFunc {
 		}
 
 		// Prepare template data
-		data := TemplateData{
-			ClaudeAvailable:  h.claudeAPI.IsAvailable(),
-			ChatGPTAvailable: h.chatGPTAPI.IsAvailable(),
+		var data TemplateData
+		for _, id := range []string{"chatgpt", "claude", "mock"} {
+			if provider := h.providerByName(id); provider.IsAvailable() {
+				data.Providers = append(data.Providers, ProviderOption{ID: id, Name: provider.Name()})
+			}
 		}
 
 		// Render template
@@ -71,13 +75,8 @@ func (h *Handler) HandleFormSubmit() http.HandlerFunc {
 		}
 
 		// Choose provider
-		var selectedProvider llm.LLM
-		switch providerName {
-		case "claude":
-			selectedProvider = h.claudeAPI
-		case "chatgpt":
-			selectedProvider = h.chatGPTAPI
-		default:
+		selectedProvider := h.providerByName(providerName)
+		if selectedProvider == nil {
 			renderErrorResult(w, h.templates, "Invalid provider selected")
 			return
 		}
@@ -88,25 +87,13 @@ func (h *Handler) HandleFormSubmit() http.HandlerFunc {
 			return
 		}
 
-		// Start timing the response
-		startTime := time.Now()
-
 		// Analyze the prompt
-		analysis, err := selectedProvider.AnalyzePrompt(promptText)
+		response, err := h.analyze(r.Context(), selectedProvider, promptText, "")
 		if err != nil {
 			renderErrorResult(w, h.templates, "Error analyzing prompt: "+err.Error())
 			return
 		}
 
-		// Calculate latency in milliseconds
-		latency := time.Since(startTime).Milliseconds()
-
-		// Create extended response with latency
-		response := AnalysisResponse{
-			PromptAnalysis: *analysis,
-			Latency:        latency,
-		}
-
 		// Convert to JSON for raw display
 		rawJSON, err := json.MarshalIndent(response, "", "  ")
 		if err != nil {
@@ -116,12 +103,12 @@ func (h *Handler) HandleFormSubmit() http.HandlerFunc {
 
 		// Prepare template data
 		data := TemplateData{
-			TokenCount:   analysis.TokenCount,
-			PromptType:   analysis.PromptType,
-			ContainsPII:  analysis.ContainsPII,
-			IsSuspicious: analysis.IsSuspicious,
-			RiskScore:    analysis.RiskScore,
-			Latency:      latency,
+			TokenCount:   response.TokenCount,
+			PromptType:   response.PromptType,
+			ContainsPII:  response.ContainsPII,
+			IsSuspicious: response.IsSuspicious,
+			RiskScore:    response.RiskScore,
+			Latency:      response.Latency,
 			RawJSON:      string(rawJSON),
 		}
 
@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/llm"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/logging"
+)
+
+// Default readiness check settings
+const (
+	defaultCheckInterval = 30 * time.Second
+	defaultCheckTimeout  = 5 * time.Second
+)
+
+// ReadyResponse reports the result of each readiness check
+type ReadyResponse struct {
+	Status string            `json:"status"` // "ready" or "not ready"
+	Checks map[string]string `json:"checks"` // "ok" or the class of error that failed the check
+}
+
+// ProviderStatus describes one provider for the status endpoint
+type ProviderStatus struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Model     string `json:"model"`
+	Available bool   `json:"available"`
+	llm.Status
+}
+
+// StatusResponse is returned by the status endpoint
+type StatusResponse struct {
+	StartedAt time.Time        `json:"startedAt"`
+	Uptime    string           `json:"uptime"`
+	Providers []ProviderStatus `json:"providers"`
+}
+
+// readinessCache holds the latest readiness result so frequent probes do
+// not call the provider APIs every time
+type readinessCache struct {
+	mu      sync.Mutex
+	checked time.Time
+	result  ReadyResponse
+}
+
+// HandleHealth reports that the process is up
+func (h *Handler) HandleHealth() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
+
+// HandleReady reports whether the service can handle analyses: the
+// configuration is loaded and every required provider is reachable
+func (h *Handler) HandleReady() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.draining.Load() {
+			writeJSON(w, http.StatusServiceUnavailable, ReadyResponse{
+				Status: "not ready",
+				Checks: map[string]string{"server": "shutting down"},
+			})
+			return
+		}
+
+		result := h.checkReadiness(r.Context())
+		status := http.StatusOK
+		if result.Status != "ready" {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, result)
+	}
+}
+
+// checkReadiness pings the required providers, reusing a recent result
+func (h *Handler) checkReadiness(ctx context.Context) ReadyResponse {
+	h.readiness.mu.Lock()
+	defer h.readiness.mu.Unlock()
+
+	interval := h.config.Health.CheckInterval
+	if interval <= 0 {
+		interval = defaultCheckInterval
+	}
+	if !h.readiness.checked.IsZero() && time.Since(h.readiness.checked) < interval {
+		return h.readiness.result
+	}
+
+	timeout := h.config.Health.CheckTimeout
+	if timeout <= 0 {
+		timeout = defaultCheckTimeout
+	}
+	// The result is shared, so one caller going away must not fail the check
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	// The handler only exists once configuration has loaded
+	result := ReadyResponse{Status: "ready", Checks: map[string]string{"config": "ok"}}
+	for _, name := range h.config.Health.RequiredProviders {
+		provider := h.providerByName(name)
+		if provider == nil {
+			result.Checks[name] = llm.ErrUnknownProvider.Error()
+			result.Status = "not ready"
+			continue
+		}
+		if err := provider.Ping(ctx); err != nil {
+			logging.FromContext(ctx).Warn("readiness check failed",
+				logging.KeyProvider, name,
+				logging.KeyErrorClass, llm.ErrorClass(err),
+				logging.KeyError, err.Error(),
+			)
+			result.Checks[name] = llm.ErrorClass(err)
+			result.Status = "not ready"
+			continue
+		}
+		result.Checks[name] = "ok"
+	}
+
+	h.readiness.checked = time.Now()
+	h.readiness.result = result
+	return result
+}
+
+// HandleStatus reports each provider's availability and recent health
+func (h *Handler) HandleStatus() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := StatusResponse{
+			StartedAt: h.started.UTC(),
+			Uptime:    time.Since(h.started).Round(time.Second).String(),
+		}
+		for _, id := range llm.ProviderNames {
+			provider := h.providerByName(id)
+			response.Providers = append(response.Providers, ProviderStatus{
+				ID:        id,
+				Name:      provider.Name(),
+				Model:     provider.Model(),
+				Available: provider.IsAvailable(),
+				Status:    provider.Status(),
+			})
+		}
+		writeJSON(w, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/auth"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/llm"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/store"
+)
+
+// DeleteResponse reports how many records a deletion request removed
+type DeleteResponse struct {
+	Deleted int `json:"deleted"`
+}
+
+// saveRecord stores an analysis, keeping the prompt only in the form the
+// retention mode allows, and returns the new record ID
+func (h *Handler) saveRecord(ctx context.Context, provider llm.LLM, retention *store.Retention, promptText, user string, response *AnalysisResponse) (string, error) {
+	rec := &store.Record{
+		ID:        store.NewID(),
+		User:      user,
+		Provider:  provider.Name(),
+		CreatedAt: time.Now().UTC(),
+		Analysis:  response.PromptAnalysis,
+		Latency:   response.Latency,
+		Usage:     response.Usage,
+		CostUSD:   response.CostUSD,
+		CacheKey:  h.cache.Key(ctx, provider, promptText),
+	}
+	if id := auth.FromContext(ctx); id != nil {
+		rec.Client = id.Client
+		rec.Tenant = id.Tenant
+	}
+
+	// Attach the prompt according to the retention mode
+	if err := retention.Apply(rec, promptText); err != nil {
+		return "", err
+	}
+
+	if err := h.store.Save(rec); err != nil {
+		return "", err
+	}
+	return rec.ID, nil
+}
+
+// ForgetCached removes a deleted record's analysis from the cache, so a
+// deletion also removes the copy kept under its prompt hash
+func (h *Handler) ForgetCached(rec *store.Record) {
+	h.cache.Forget(rec.CacheKey)
+}
+
+// HandleDeleteRecord deletes a single stored record by ID, and its cached
+// analysis. Records the caller does not own are reported as not found.
+func (h *Handler) HandleDeleteRecord() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+
+		// Check ownership before deleting
+		rec, err := h.store.Get(id)
+		if err == nil && !canAccessRecord(r, rec) {
+			err = store.ErrNotFound
+		}
+		if err == nil {
+			err = h.store.Delete(id)
+		}
+		if err == nil {
+			h.ForgetCached(rec)
+		}
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			http.Error(w, "Record not found", http.StatusNotFound)
+			return
+		case err != nil:
+			http.Error(w, fmt.Sprintf("Error deleting record: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleDeleteUserRecords deletes every stored record the caller owns for the
+// user given in the "user" query parameter, and their cached analyses
+func (h *Handler) HandleDeleteUserRecords() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Require an explicit user so a bare DELETE never wipes the store
+		user := r.URL.Query().Get("user")
+		if user == "" {
+			http.Error(w, "user query parameter is required", http.StatusBadRequest)
+			return
+		}
+
+		// Delete the user's records
+		var deleted []*store.Record
+		count, err := h.store.DeleteByUser(user, func(rec *store.Record) bool {
+			if !canAccessRecord(r, rec) {
+				return false
+			}
+			deleted = append(deleted, rec)
+			return true
+		})
+		for _, rec := range deleted {
+			h.ForgetCached(rec)
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error deleting records: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		// Return the number of deleted records as JSON
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(DeleteResponse{Deleted: count}); err != nil {
+			http.Error(w, fmt.Sprintf("Error encoding response: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// canAccessRecord reports whether the caller may delete a record: its own
+// records, or any record with the admin scope. Everyone may when
+// authentication is disabled.
+func canAccessRecord(r *http.Request, rec *store.Record) bool {
+	id := auth.FromContext(r.Context())
+	return id == nil || id.Has(auth.ScopeAdmin) || id.Client == rec.Client
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/usage"
+)
+
+// HandleUsageReport returns requests, tokens and cost by tenant and period.
+// The from and to query parameters bound the report (YYYY-MM-DD, default the
+// current month), period is day or month (default month), by=client breaks
+// tenants down by client, and format is json (default) or csv.
+func (h *Handler) HandleUsageReport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		from, to, err := usage.ParseRange(query.Get("from"), query.Get("to"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		period := query.Get("period")
+		if period == "" {
+			period = usage.PeriodMonth
+		}
+		var byClient bool
+		switch query.Get("by") {
+		case "", "tenant":
+		case "client":
+			byClient = true
+		default:
+			http.Error(w, fmt.Sprintf("invalid by %q: use tenant or client", query.Get("by")), http.StatusBadRequest)
+			return
+		}
+
+		// Build the report
+		report, err := h.ledger.NewReport(from, to, period, byClient)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Write it in the requested format
+		switch query.Get("format") {
+		case "", "json":
+			writeJSON(w, http.StatusOK, report)
+		case "csv":
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="usage-%s-%s.csv"`, report.From, report.To))
+			if err := report.WriteCSV(w); err != nil {
+				http.Error(w, fmt.Sprintf("Error encoding report: %v", err), http.StatusInternalServerError)
+			}
+		default:
+			http.Error(w, fmt.Sprintf("invalid format %q: use json or csv", query.Get("format")), http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/auth"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/logging"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/metrics"
+)
+
+// tracer records spans for request handling and policy evaluation
+var tracer = otel.Tracer("github.com/rlnorthcutt/ai-prompt-analysis/internal/handler")
+
+// statusRecorder captures the status code written by a handler, and the
+// caller once authorize has identified it
+type statusRecorder struct {
+	http.ResponseWriter
+	status   int
+	identity *auth.Identity
+}
+
+// WriteHeader records the status code before writing it
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// instrument assigns each request to a route an ID, traces it, logs it and
+// counts it by provider and status code. The provider is empty for routes
+// that are not tied to one.
+func instrument(route, provider string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		// Take the caller's request ID or create one, and echo it back
+		requestID := logging.NewRequestID(r.Header.Get("X-Request-ID"))
+		w.Header().Set("X-Request-ID", requestID)
+		ctx := logging.WithRequestID(r.Context(), requestID)
+
+		// Continue the caller's trace, if any
+		ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, route, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("http.route", route),
+			attribute.String("llm.provider", provider),
+			attribute.String("request.id", requestID),
+		))
+		defer span.End()
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.response.status_code", rec.status))
+		if rec.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rec.status))
+		}
+		metrics.HTTPRequests.WithLabelValues(route, provider, strconv.Itoa(rec.status)).Inc()
+		logger := logging.FromContext(ctx)
+		if id := rec.identity; id != nil {
+			logger = logger.With(logging.KeyClient, id.Client)
+			if id.Tenant != "" {
+				logger = logger.With(logging.KeyTenant, id.Tenant)
+			}
+		}
+		logger.Info("request",
+			"method", r.Method,
+			"route", route,
+			logging.KeyProvider, provider,
+			"status", rec.status,
+			logging.KeyLatency, time.Since(start).Milliseconds(),
+		)
+	}
+}
+
+// authorize requires a bearer credential granted the scope when
+// authentication is enabled. The client's identity is added to the request
+// context and its logs.
+func (h *Handler) authorize(scope string, next http.HandlerFunc) http.HandlerFunc {
+	if h.auth == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := h.auth.Authenticate(r)
+		if err != nil {
+			logging.FromContext(r.Context()).Warn("authentication failed", logging.KeyError, err.Error())
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ai-prompt-analysis"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if rec, ok := w.(*statusRecorder); ok {
+			rec.identity = id
+		}
+		trace.SpanFromContext(r.Context()).SetAttributes(
+			attribute.String("client.id", id.Client),
+			attribute.String("client.tenant", id.Tenant),
+		)
+
+		if !id.Has(scope) {
+			http.Error(w, fmt.Sprintf("Forbidden: the %s scope is required", scope), http.StatusForbidden)
+			return
+		}
+
+		ctx := auth.WithIdentity(r.Context(), id)
+		ctx = logging.WithClient(ctx, id.Client, id.Tenant)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// limitIP applies the rate_limits.per_ip limits before authentication, so
+// that requests with bad credentials cannot be sent without limit. Without
+// authentication, limit already keys callers by address, so nothing is
+// added.
+func (h *Handler) limitIP(route string, next http.HandlerFunc) http.HandlerFunc {
+	if h.limiter == nil || h.auth == nil || h.config.RateLimits.PerIP == (config.RateLimit{}) {
+		return next
+	}
+	return h.enforce(route, h.limiter.ResolveIP, next)
+}
+
+// limit applies the client rate and concurrency limits when rate limiting is
+// enabled. It runs after authorize so clients are limited by identity.
+func (h *Handler) limit(route string, next http.HandlerFunc) http.HandlerFunc {
+	if h.limiter == nil {
+		return next
+	}
+	return h.enforce(route, h.limiter.Resolve, next)
+}
+
+// enforce takes a request from the bucket resolve picks, rejecting it with
+// 429 when the bucket is empty or its in-flight limit is reached
+func (h *Handler) enforce(route string, resolve func(*http.Request) (string, config.RateLimit), next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, limits := resolve(r)
+		decision, release := h.limiter.Acquire(key, limits)
+
+		if decision.Limit > 0 {
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(decision.Limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+			w.Header().Set("X-RateLimit-Reset", strconv.Itoa(int(decision.Reset.Seconds())))
+		}
+		if !decision.Allowed {
+			metrics.RateLimited.WithLabelValues(route, decision.Reason).Inc()
+			logging.FromContext(r.Context()).Warn("rate limited", "limit_key", key, "reason", decision.Reason)
+			w.Header().Set("Retry-After", strconv.Itoa(int(decision.RetryAfter.Seconds())))
+			http.Error(w, fmt.Sprintf("Too many requests: %s limit exceeded", decision.Reason), http.StatusTooManyRequests)
+			return
+		}
+		defer release()
+
+		next(w, r)
+	}
+}
+
+// budget rejects requests from clients whose budget, or whose tenant's
+// budget, has reached a hard limit, and warns past a soft limit. It runs
+// after authorize, so anonymous requests are never charged.
+func (h *Handler) budget(next http.HandlerFunc) http.HandlerFunc {
+	if len(h.config.Budgets) == 0 {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := auth.FromContext(r.Context())
+		if id == nil {
+			next(w, r)
+			return
+		}
+
+		for _, breach := range h.ledger.CheckBudgets(id.Client, id.Tenant) {
+			threshold := "soft"
+			if breach.Hard {
+				threshold = "hard"
+			}
+			metrics.BudgetBreaches.WithLabelValues(id.Client, id.Tenant, breach.Period, threshold).Inc()
+
+			if breach.Hard {
+				logging.FromContext(r.Context()).Warn("budget exceeded", "budget", breach.String())
+				w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(breach.Reset).Seconds())+1))
+				http.Error(w, fmt.Sprintf("Budget exceeded: %s", breach), http.StatusTooManyRequests)
+				return
+			}
+			w.Header().Add("X-Budget-Warning", breach.String())
+		}
+
+		next(w, r)
+	}
+}
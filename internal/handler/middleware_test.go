@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/auth"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/ratelimit"
+)
+
+func TestGuardLimitsByAddressBeforeAuth(t *testing.T) {
+	sum := sha256.Sum256([]byte("good-key"))
+	cfg := &config.Config{}
+	cfg.Auth.Enabled = true
+	cfg.Auth.Keys = []config.APIKey{{Name: "alice", Hash: "sha256:" + hex.EncodeToString(sum[:]), Scopes: []string{auth.ScopeAnalyze}}}
+	cfg.RateLimits.Enabled = true
+	cfg.RateLimits.PerIP = config.RateLimit{RequestsPerMinute: 1, Burst: 2}
+
+	authenticator, err := auth.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &Handler{config: cfg, auth: authenticator, limiter: ratelimit.New(cfg)}
+	guarded := h.guard("/analyze/mock", auth.ScopeAnalyze, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	send := func(key string) int {
+		r := httptest.NewRequest(http.MethodPost, "/analyze/mock", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		r.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		guarded(w, r)
+		return w.Code
+	}
+
+	// Bad credentials use up the address's budget, and then a valid key from
+	// the same address is turned away before authentication too
+	for i, step := range []struct {
+		key  string
+		want int
+	}{
+		{"bad-key", http.StatusUnauthorized},
+		{"good-key", http.StatusOK},
+		{"bad-key", http.StatusTooManyRequests},
+		{"good-key", http.StatusTooManyRequests},
+	} {
+		if got := send(step.key); got != step.want {
+			t.Errorf("request %d: status = %d, want %d", i+1, got, step.want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// defaultPollInterval is used when no poll interval is configured
+const defaultPollInterval = 30 * time.Second
+
+// Batch errors
+var (
+	ErrBatchFailed   = errors.New("vendor batch failed")
+	ErrBatchNoResult = errors.New("no result returned for prompt")
+)
+
+// BatchPrompt is one prompt submitted through a vendor batch API
+type BatchPrompt struct {
+	CustomID string // Caller-chosen ID used to match the result; letters, digits, "_" and "-" only
+	Prompt   string
+}
+
+// BatchResult is the outcome of one prompt in a vendor batch
+type BatchResult struct {
+	Analysis *PromptAnalysis
+	Usage    Usage // Tokens the vendor reported for the prompt
+	Err      error
+}
+
+// BatchLLM is implemented by providers that offer a discounted asynchronous
+// batch API alongside their realtime one
+type BatchLLM interface {
+	LLM
+
+	// SubmitBatch uploads the prompts as a single vendor batch and returns its ID
+	SubmitBatch(ctx context.Context, prompts []BatchPrompt) (string, error)
+
+	// BatchResults reports whether the batch has ended and, once it has,
+	// returns the result for each custom ID
+	BatchResults(ctx context.Context, batchID string) (map[string]BatchResult, bool, error)
+}
+
+// AwaitBatch polls a submitted vendor batch until it ends. Every custom ID
+// has an entry in the returned map; prompts the vendor did not return a
+// result for carry ErrBatchNoResult.
+func AwaitBatch(ctx context.Context, provider BatchLLM, batchID string, customIDs []string, pollInterval time.Duration) (map[string]BatchResult, error) {
+	if pollInterval <= 0 {
+		pollInterval = defaultPollInterval
+	}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		results, done, err := provider.BatchResults(ctx, batchID)
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			if results == nil {
+				results = make(map[string]BatchResult)
+			}
+			for _, id := range customIDs {
+				if _, ok := results[id]; !ok {
+					results[id] = BatchResult{Err: ErrBatchNoResult}
+				}
+			}
+			return results, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("stopped polling %s batch %s: %w", provider.Name(), batchID, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
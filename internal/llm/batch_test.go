@@ -0,0 +1,260 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
+)
+
+// testAnalysis is a reply that passes the analysis schema
+const testAnalysis = `{"tokenCount":5,"promptType":"coding","containsPII":false,"isSuspicious":false,"riskScore":2}`
+
+// testPrompts are submitted by the batch tests; line-3 gets no result
+var testPrompts = []BatchPrompt{
+	{CustomID: "line-1", Prompt: "Write a sort function"},
+	{CustomID: "line-2", Prompt: "Summarise this article"},
+	{CustomID: "line-3", Prompt: "Translate this sentence"},
+}
+
+// customIDs returns the custom IDs of the prompts
+func customIDs(prompts []BatchPrompt) []string {
+	ids := make([]string, len(prompts))
+	for i, p := range prompts {
+		ids[i] = p.CustomID
+	}
+	return ids
+}
+
+// fakeClaudeBatches serves the Message Batches API: one batch that is in
+// progress on the first poll and ended on the next
+type fakeClaudeBatches struct {
+	t     *testing.T
+	url   string
+	mu    sync.Mutex
+	polls int
+	got   ClaudeBatchRequest
+}
+
+func (f *fakeClaudeBatches) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("x-api-key") != "test-key" {
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method + " " + r.URL.Path {
+	case "POST /v1/messages/batches":
+		if err := json.NewDecoder(r.Body).Decode(&f.got); err != nil {
+			f.t.Errorf("decode batch request: %v", err)
+		}
+		fmt.Fprint(w, `{"id":"msgbatch_1","processing_status":"in_progress"}`)
+	case "GET /v1/messages/batches/msgbatch_1":
+		f.polls++
+		if f.polls == 1 {
+			fmt.Fprint(w, `{"id":"msgbatch_1","processing_status":"in_progress"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"id":"msgbatch_1","processing_status":"ended","results_url":%q}`, f.url+"/v1/messages/batches/msgbatch_1/results")
+	case "GET /v1/messages/batches/msgbatch_1/results":
+		message, _ := json.Marshal(map[string]any{
+			"content": []map[string]string{{"type": "text", "text": testAnalysis}},
+			"usage":   map[string]int{"input_tokens": 120, "output_tokens": 30},
+		})
+		fmt.Fprintf(w, `{"custom_id":"line-1","result":{"type":"succeeded","message":%s}}`+"\n", message)
+		fmt.Fprint(w, `{"custom_id":"line-2","result":{"type":"errored","error":{"type":"invalid_request_error"}}}`+"\n")
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestClaudeBatch(t *testing.T) {
+	t.Setenv("CLAUDE_API_KEY", "test-key")
+	fake := &fakeClaudeBatches{t: t}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	fake.url = srv.URL
+
+	cfg := &config.Config{}
+	cfg.Claude.APIURL = srv.URL + "/v1/messages"
+	cfg.Claude.BatchAPIURL = srv.URL + "/v1/messages/batches"
+	cfg.Claude.ModelID = "claude-test"
+	cfg.Claude.MaxTokens = 256
+	cfg.Analysis.SystemPrompt = "Analyze prompts"
+	claude := NewClaude(cfg)
+
+	ctx := context.Background()
+	batchID, err := claude.SubmitBatch(ctx, testPrompts)
+	if err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	if batchID != "msgbatch_1" {
+		t.Errorf("batch ID = %q", batchID)
+	}
+	if len(fake.got.Requests) != 3 || fake.got.Requests[0].CustomID != "line-1" || fake.got.Requests[0].Params.Model != "claude-test" || fake.got.Requests[0].Params.System != "Analyze prompts" {
+		t.Errorf("batch request = %+v", fake.got)
+	}
+
+	results, err := AwaitBatch(ctx, claude, batchID, customIDs(testPrompts), time.Millisecond)
+	if err != nil {
+		t.Fatalf("await: %v", err)
+	}
+	checkBatchResults(t, results, Usage{InputTokens: 120, OutputTokens: 30})
+	if fake.polls != 2 {
+		t.Errorf("polls = %d, want 2", fake.polls)
+	}
+}
+
+// fakeChatGPTBatches serves the Files and Batch APIs: one batch that is in
+// progress on the first poll and completed on the next
+type fakeChatGPTBatches struct {
+	t     *testing.T
+	mu    sync.Mutex
+	polls int
+	input []ChatGPTBatchEntry
+}
+
+func (f *fakeChatGPTBatches) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer test-key" {
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method + " " + r.URL.Path {
+	case "POST /v1/files":
+		if r.FormValue("purpose") != "batch" {
+			f.t.Errorf("purpose = %q", r.FormValue("purpose"))
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			f.t.Errorf("upload: %v", err)
+			http.Error(w, "bad upload", http.StatusBadRequest)
+			return
+		}
+		decoder := json.NewDecoder(file)
+		for {
+			var entry ChatGPTBatchEntry
+			if err := decoder.Decode(&entry); err == io.EOF {
+				break
+			} else if err != nil {
+				f.t.Errorf("decode input file: %v", err)
+				break
+			}
+			f.input = append(f.input, entry)
+		}
+		fmt.Fprint(w, `{"id":"file-in"}`)
+	case "POST /v1/batches":
+		var create ChatGPTBatchCreate
+		if err := json.NewDecoder(r.Body).Decode(&create); err != nil {
+			f.t.Errorf("decode batch create: %v", err)
+		}
+		if create.InputFileID != "file-in" || create.Endpoint != "/v1/chat/completions" {
+			f.t.Errorf("batch create = %+v", create)
+		}
+		fmt.Fprint(w, `{"id":"batch_1","status":"validating"}`)
+	case "GET /v1/batches/batch_1":
+		f.polls++
+		if f.polls == 1 {
+			fmt.Fprint(w, `{"id":"batch_1","status":"in_progress"}`)
+			return
+		}
+		fmt.Fprint(w, `{"id":"batch_1","status":"completed","output_file_id":"file-out","error_file_id":"file-err"}`)
+	case "GET /v1/files/file-out/content":
+		body, _ := json.Marshal(map[string]any{
+			"choices": []map[string]any{{"message": map[string]string{"role": "assistant", "content": testAnalysis}}},
+			"usage":   map[string]int{"prompt_tokens": 90, "completion_tokens": 25},
+		})
+		fmt.Fprintf(w, `{"custom_id":"line-1","response":{"status_code":200,"body":%s}}`+"\n", body)
+	case "GET /v1/files/file-err/content":
+		fmt.Fprint(w, `{"custom_id":"line-2","response":null,"error":{"code":"server_error","message":"internal error"}}`+"\n")
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestChatGPTBatch(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "test-key")
+	fake := &fakeChatGPTBatches{t: t}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	cfg := &config.Config{}
+	cfg.ChatGPT.APIURL = srv.URL + "/v1/chat/completions"
+	cfg.ChatGPT.BatchAPIURL = srv.URL + "/v1/batches"
+	cfg.ChatGPT.FilesAPIURL = srv.URL + "/v1/files"
+	cfg.ChatGPT.ModelID = "gpt-test"
+	chatGPT := NewChatGPT(cfg)
+
+	ctx := context.Background()
+	batchID, err := chatGPT.SubmitBatch(ctx, testPrompts)
+	if err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	if batchID != "batch_1" {
+		t.Errorf("batch ID = %q", batchID)
+	}
+	if len(fake.input) != 3 || fake.input[1].CustomID != "line-2" || fake.input[1].URL != "/v1/chat/completions" || fake.input[1].Body.Model != "gpt-test" {
+		t.Errorf("input file = %+v", fake.input)
+	}
+
+	results, err := AwaitBatch(ctx, chatGPT, batchID, customIDs(testPrompts), time.Millisecond)
+	if err != nil {
+		t.Fatalf("await: %v", err)
+	}
+	checkBatchResults(t, results, Usage{InputTokens: 90, OutputTokens: 25})
+}
+
+func TestAwaitBatchStopsOnCancel(t *testing.T) {
+	t.Setenv("CLAUDE_API_KEY", "test-key")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":"msgbatch_1","processing_status":"in_progress"}`)
+	}))
+	defer srv.Close()
+
+	cfg := &config.Config{}
+	cfg.Claude.BatchAPIURL = srv.URL
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := AwaitBatch(ctx, NewClaude(cfg), "msgbatch_1", nil, time.Hour)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+// checkBatchResults checks the results mapped back from the fake batches:
+// line-1 succeeded, line-2 errored and line-3 was not returned
+func checkBatchResults(t *testing.T, results map[string]BatchResult, usage Usage) {
+	t.Helper()
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+
+	ok := results["line-1"]
+	if ok.Err != nil {
+		t.Fatalf("line-1: %v", ok.Err)
+	}
+	if ok.Analysis.PromptType != "coding" || ok.Analysis.RiskScore != 2 {
+		t.Errorf("line-1 analysis = %+v", ok.Analysis)
+	}
+	if ok.Usage != usage {
+		t.Errorf("line-1 usage = %+v, want %+v", ok.Usage, usage)
+	}
+
+	if err := results["line-2"].Err; !errors.Is(err, ErrRequestFailed) {
+		t.Errorf("line-2 err = %v, want ErrRequestFailed", err)
+	}
+	if err := results["line-3"].Err; !errors.Is(err, ErrBatchNoResult) {
+		t.Errorf("line-3 err = %v, want ErrBatchNoResult", err)
+	}
+}
@@ -0,0 +1,207 @@
+package llm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
+)
+
+// Cassette modes
+const (
+	CassetteRecord = "record"
+	CassetteReplay = "replay"
+)
+
+// ErrCassetteMiss is returned in replay mode when no recording matches a request
+var ErrCassetteMiss = errors.New("no recorded interaction for request")
+
+// redacted replaces credentials in recorded interactions
+const redacted = "REDACTED"
+
+// secretHeaders are scrubbed from recordings. Besides credentials these
+// include the account IDs and request IDs the providers send back, which
+// identify the account the recording was made with.
+var secretHeaders = []string{
+	"Authorization", "X-Api-Key", "Cookie", "Set-Cookie",
+	"Anthropic-Organization-Id", "Openai-Organization", "Openai-Project",
+	"Request-Id", "X-Request-Id",
+}
+
+// Interaction is one recorded request/response pair
+type Interaction struct {
+	Request struct {
+		Method string      `json:"method"`
+		URL    string      `json:"url"`
+		Header http.Header `json:"header"`
+		Body   string      `json:"body"`
+	} `json:"request"`
+	Response struct {
+		StatusCode int         `json:"statusCode"`
+		Header     http.Header `json:"header"`
+		Body       string      `json:"body"`
+	} `json:"response"`
+}
+
+// cassetteTransport records requests to, or replays them from, a directory
+// with one JSON file per interaction
+type cassetteTransport struct {
+	mode string
+	dir  string
+	next http.RoundTripper
+}
+
+// newHTTPClient creates the HTTP client for a provider, wrapping it in a
+// cassette transport when recording or replay is enabled
+func newHTTPClient(cassette config.Cassette) *http.Client {
+	if cassette.Mode != CassetteRecord && cassette.Mode != CassetteReplay {
+		return &http.Client{}
+	}
+	return &http.Client{Transport: &cassetteTransport{
+		mode: cassette.Mode,
+		dir:  cassette.Dir,
+		next: http.DefaultTransport,
+	}}
+}
+
+// lookupAPIKey returns the provider's API key from the environment. Replay
+// needs no credentials, so a placeholder is used when the variable is unset.
+func lookupAPIKey(envVar string, cassette config.Cassette) string {
+	key := os.Getenv(envVar)
+	if key == "" && cassette.Mode == CassetteReplay {
+		return redacted
+	}
+	return key
+}
+
+// RoundTrip serves the request from the cassette or sends and records it
+func (t *cassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	path := filepath.Join(t.dir, interactionKey(req, body)+".json")
+
+	if t.mode == CassetteReplay {
+		return t.replay(req, path)
+	}
+
+	// Send the request and record the exchange
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	var in Interaction
+	in.Request.Method = req.Method
+	in.Request.URL = req.URL.String()
+	in.Request.Header = req.Header.Clone()
+	in.Request.Body = string(body)
+	in.Response.StatusCode = resp.StatusCode
+	in.Response.Header = resp.Header.Clone()
+	in.Response.Body = string(respBody)
+	scrub(&in)
+
+	if err := writeInteraction(path, &in); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// replay returns the recorded response stored at path
+func (t *cassetteTransport) replay(req *http.Request, path string) (*http.Response, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s %s", ErrCassetteMiss, req.Method, req.URL)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading cassette: %w", err)
+	}
+
+	var in Interaction
+	if err := json.Unmarshal(data, &in); err != nil {
+		return nil, fmt.Errorf("error parsing cassette %s: %w", path, err)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", in.Response.StatusCode, http.StatusText(in.Response.StatusCode)),
+		StatusCode:    in.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        in.Response.Header,
+		Body:          io.NopCloser(strings.NewReader(in.Response.Body)),
+		ContentLength: int64(len(in.Response.Body)),
+		Request:       req,
+	}, nil
+}
+
+// interactionKey identifies a request by method, URL and body. Multipart
+// boundaries are random, so they are normalised before hashing.
+func interactionKey(req *http.Request, body []byte) string {
+	if _, params, err := mime.ParseMediaType(req.Header.Get("Content-Type")); err == nil && params["boundary"] != "" {
+		body = bytes.ReplaceAll(body, []byte(params["boundary"]), []byte("BOUNDARY"))
+	}
+
+	h := sha256.New()
+	h.Write([]byte(req.Method + " " + req.URL.String() + "\n"))
+	h.Write(body)
+	return strings.ToLower(req.Method) + "-" + hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// scrub removes credentials from an interaction, including any copies of
+// them that appear in the bodies
+func scrub(in *Interaction) {
+	for _, name := range secretHeaders {
+		for _, header := range []http.Header{in.Request.Header, in.Response.Header} {
+			for _, value := range header.Values(name) {
+				if secret := strings.TrimSpace(strings.TrimPrefix(value, "Bearer ")); secret != "" {
+					in.Request.Body = strings.ReplaceAll(in.Request.Body, secret, redacted)
+					in.Response.Body = strings.ReplaceAll(in.Response.Body, secret, redacted)
+				}
+			}
+			if header.Get(name) != "" {
+				header.Set(name, redacted)
+			}
+		}
+	}
+}
+
+// writeInteraction saves an interaction as indented JSON so recordings can
+// be reviewed and diffed. The file is only readable by its owner until it
+// has been reviewed, as a scrubbed recording may still hold prompts.
+func writeInteraction(path string, in *Interaction) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("error creating cassette directory: %w", err)
+	}
+	data, err := json.MarshalIndent(in, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding cassette: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("error writing cassette: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
+)
+
+// The prompts recorded in testdata/cassettes. Run the tests with
+// RECORD_CASSETTES=1 and the provider API keys set to re-record them.
+const (
+	claudeCassettePrompt  = "Write a Python function that reverses a string"
+	chatGPTCassettePrompt = "My SSN is 123-45-6789, can you check whether my credit score has changed?"
+)
+
+// cassetteConfig returns a config that replays, or records, the test
+// cassettes with the default provider settings
+func cassetteConfig() *config.Config {
+	mode := CassetteReplay
+	if os.Getenv("RECORD_CASSETTES") != "" {
+		mode = CassetteRecord
+	}
+
+	cfg := &config.Config{}
+	cfg.Analysis.SystemPrompt = "Analyze the prompt and reply with only a JSON object with the fields tokenCount, promptType, containsPII, isSuspicious and riskScore (1-10)."
+	cfg.Claude.APIURL = "https://api.anthropic.com/v1/messages"
+	cfg.Claude.ModelID = "claude-3-haiku-20240307"
+	cfg.Claude.MaxTokens = 1024
+	cfg.Claude.Version = "2023-06-01"
+	cfg.Claude.Cassette = config.Cassette{Mode: mode, Dir: "testdata/cassettes/claude"}
+	cfg.ChatGPT.APIURL = "https://api.openai.com/v1/chat/completions"
+	cfg.ChatGPT.ModelID = "gpt-4o-mini"
+	cfg.ChatGPT.MaxTokens = 1024
+	cfg.ChatGPT.Cassette = config.Cassette{Mode: mode, Dir: "testdata/cassettes/chatgpt"}
+	return cfg
+}
+
+func TestClaudeCassette(t *testing.T) {
+	ctx, usage := WithUsage(context.Background())
+	analysis, err := NewClaude(cassetteConfig()).AnalyzePrompt(ctx, claudeCassettePrompt)
+	if err != nil {
+		t.Fatalf("analyze: %v", err)
+	}
+
+	// The recorded reply wraps the JSON in prose and a code fence and
+	// capitalises the prompt type
+	if analysis.PromptType != "coding" || analysis.ContainsPII || analysis.IsSuspicious || analysis.RiskScore != 1 {
+		t.Errorf("analysis = %+v", analysis)
+	}
+	if usage.InputTokens != 68 || usage.OutputTokens != 62 {
+		t.Errorf("usage = %+v", *usage)
+	}
+}
+
+func TestChatGPTCassette(t *testing.T) {
+	ctx, usage := WithUsage(context.Background())
+	analysis, err := NewChatGPT(cassetteConfig()).AnalyzePrompt(ctx, chatGPTCassettePrompt)
+	if err != nil {
+		t.Fatalf("analyze: %v", err)
+	}
+
+	if analysis.PromptType != "content" || !analysis.ContainsPII || analysis.IsSuspicious || analysis.RiskScore != 7 {
+		t.Errorf("analysis = %+v", analysis)
+	}
+	if usage.InputTokens != 71 || usage.OutputTokens != 41 {
+		t.Errorf("usage = %+v", *usage)
+	}
+}
+
+func TestCassetteMiss(t *testing.T) {
+	if os.Getenv("RECORD_CASSETTES") != "" {
+		t.Skip("recording")
+	}
+
+	// A request whose payload differs from every recording is not sent
+	_, err := NewClaude(cassetteConfig()).AnalyzePrompt(context.Background(), "A prompt that was never recorded")
+	if !errors.Is(err, ErrCassetteMiss) {
+		t.Errorf("err = %v, want ErrCassetteMiss", err)
+	}
+}
+
+func TestCassetteRecordScrubsSecrets(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Anthropic-Organization-Id", "8c1f2a4e-5b6d-4e7f-9a0b-1c2d3e4f5a6b")
+		w.Header().Set("Request-Id", "req_011CQmUBN3Dp8mCQwqrR6bxL")
+		w.Header().Set("Set-Cookie", "session=abc")
+		w.Write([]byte(`{"content":[{"type":"text","text":"{\"tokenCount\": 1, \"promptType\": \"coding\", \"containsPII\": false, \"isSuspicious\": false, \"riskScore\": 1}"}],"usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	defer upstream.Close()
+
+	dir := t.TempDir()
+	t.Setenv("CLAUDE_API_KEY", "sk-ant-secret")
+	cfg := cassetteConfig()
+	cfg.Claude.APIURL = upstream.URL
+	cfg.Claude.Cassette = config.Cassette{Mode: CassetteRecord, Dir: dir}
+	if _, err := NewClaude(cfg).AnalyzePrompt(context.Background(), claudeCassettePrompt); err != nil {
+		t.Fatalf("analyze: %v", err)
+	}
+
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(paths) != 1 {
+		t.Fatalf("recorded %d interactions, want 1", len(paths))
+	}
+	info, err := os.Stat(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("cassette mode = %v, want 0600", perm)
+	}
+
+	data, _ := os.ReadFile(paths[0])
+	if strings.Contains(string(data), "secret") || strings.Contains(string(data), "8c1f2a4e") || strings.Contains(string(data), "req_011") {
+		t.Errorf("cassette holds a secret:\n%s", data)
+	}
+	var in Interaction
+	if err := json.Unmarshal(data, &in); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Anthropic-Organization-Id", "Request-Id", "Set-Cookie"} {
+		if got := in.Response.Header.Get(name); got != redacted {
+			t.Errorf("response %s = %q, want %q", name, got, redacted)
+		}
+	}
+	if got := in.Request.Header.Get("X-Api-Key"); got != redacted {
+		t.Errorf("request X-Api-Key = %q, want %q", got, redacted)
+	}
+}
@@ -2,19 +2,20 @@ package llm
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
-	"os"
 
 	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
-	"github.com/rlnorthcutt/ai-prompt-analysis/internal/prompt"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/metrics"
 )
 
 // ChatGPT implements the LLM interface for OpenAI's ChatGPT API
 type ChatGPT struct {
 	config *config.Config
+	client *http.Client
 }
 
 // ChatGPTRequest represents the request structure for ChatGPT API
@@ -38,12 +39,17 @@ type ChatGPTResponse struct {
 			Content string `json:"content"`
 		} `json:"message"`
 	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
 }
 
 // NewChatGPT creates a new ChatGPT instance
 func NewChatGPT(config *config.Config) *ChatGPT {
 	return &ChatGPT{
 		config: config,
+		client: newHTTPClient(config.ChatGPT.Cassette),
 	}
 }
 
@@ -52,27 +58,91 @@ func (c *ChatGPT) Name() string {
 	return "ChatGPT"
 }
 
+// Model returns the model ID used for analysis
+func (c *ChatGPT) Model() string {
+	return c.config.ChatGPT.ModelID
+}
+
 // IsAvailable checks if the ChatGPT API is available
 func (c *ChatGPT) IsAvailable() bool {
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	return apiKey != ""
+	return lookupAPIKey("OPENAI_API_KEY", c.config.ChatGPT.Cassette) != ""
 }
 
-// AnalyzePrompt analyzes a prompt using ChatGPT API
-func (c *ChatGPT) AnalyzePrompt(promptText string) (*PromptAnalysis, error) {
-	// Get API key from environment
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
-		return nil, ErrAPIKeyNotSet
+// AnalyzePrompt analyzes a prompt using ChatGPT API. A reply that fails the
+// analysis schema is sent back once with the problems for correction.
+func (c *ChatGPT) AnalyzePrompt(ctx context.Context, promptText string) (*PromptAnalysis, error) {
+	req := c.newRequest(ctx, promptText)
+	chatGPTResp, err := c.complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	analysis, err := c.parse(ctx, chatGPTResp)
+	if !errors.Is(err, ErrResponseParsing) || len(chatGPTResp.Choices) == 0 {
+		return analysis, err
 	}
 
-	// Create ChatGPT API request payload
-	chatGPTReq := ChatGPTRequest{
-		Model: c.config.ChatGPT.ModelID,
+	// Ask once for a corrected reply
+	req.Messages = append(req.Messages,
+		ChatGPTMessage{Role: "assistant", Content: chatGPTResp.Choices[0].Message.Content},
+		ChatGPTMessage{Role: "user", Content: correctionPrompt(err)},
+	)
+	if chatGPTResp, err = c.complete(ctx, req); err != nil {
+		return nil, err
+	}
+	if analysis, err = c.parse(ctx, chatGPTResp); err != nil {
+		return nil, err
+	}
+	metrics.ResponseRepairs.WithLabelValues(ProviderID(c), "reprompt").Inc()
+	return analysis, nil
+}
+
+// complete sends a chat completion request and decodes the reply, recording
+// its usage
+func (c *ChatGPT) complete(ctx context.Context, req ChatGPTRequest) (*ChatGPTResponse, error) {
+	// Convert request to JSON
+	reqBody, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling request: %w", err)
+	}
+
+	// Send request
+	body, err := c.send(ctx, "POST", c.config.ChatGPT.APIURL, "application/json", reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse ChatGPT's response
+	var chatGPTResp ChatGPTResponse
+	if err := json.Unmarshal(body, &chatGPTResp); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrResponseParsing, err)
+	}
+	recordUsage(ctx, ProviderID(c), ModelFor(ctx, c), chatGPTResp.Usage.PromptTokens, chatGPTResp.Usage.CompletionTokens)
+	return &chatGPTResp, nil
+}
+
+// parse extracts the analysis from a reply within a trace span
+func (c *ChatGPT) parse(ctx context.Context, chatGPTResp *ChatGPTResponse) (*PromptAnalysis, error) {
+	_, span := tracer.Start(ctx, "llm.parse_response")
+	analysis, err := c.parseResponse(chatGPTResp)
+	endSpan(span, err)
+	return analysis, err
+}
+
+// Ping checks the API is reachable and the key is accepted by listing models
+func (c *ChatGPT) Ping(ctx context.Context) error {
+	_, err := c.send(ctx, "GET", c.config.ChatGPT.ModelsURL, "", nil)
+	return err
+}
+
+// newRequest creates the ChatGPT API request payload for a prompt, with the
+// context's model and system prompt overrides
+func (c *ChatGPT) newRequest(ctx context.Context, promptText string) ChatGPTRequest {
+	return ChatGPTRequest{
+		Model: ModelFor(ctx, c),
 		Messages: []ChatGPTMessage{
 			{
 				Role:    "system",
-				Content: c.config.Analysis.SystemPrompt,
+				Content: SystemPromptFor(ctx, c.config.Analysis.SystemPrompt),
 			},
 			{
 				Role:    "user",
@@ -82,48 +152,45 @@ func (c *ChatGPT) AnalyzePrompt(promptText string) (*PromptAnalysis, error) {
 		MaxTokens:   c.config.ChatGPT.MaxTokens,
 		Temperature: c.config.ChatGPT.Temperature,
 	}
+}
 
-	// Convert request to JSON
-	reqBody, err := json.Marshal(chatGPTReq)
-	if err != nil {
-		return nil, fmt.Errorf("error marshaling request: %w", err)
-	}
-
-	// Create HTTP request
-	req, err := http.NewRequest("POST", c.config.ChatGPT.APIURL, bytes.NewBuffer(reqBody))
-	if err != nil {
-		return nil, fmt.Errorf("error creating request: %w", err)
-	}
-
-	// Set headers
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", apiKey))
-
-	// Send request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrRequestFailed, err)
+// send performs an authenticated request against the OpenAI API and returns
+// the response body, failing on any non-200 status
+func (c *ChatGPT) send(ctx context.Context, method, url, contentType string, reqBody []byte) ([]byte, error) {
+	// Get API key from environment
+	apiKey := lookupAPIKey("OPENAI_API_KEY", c.config.ChatGPT.Cassette)
+	if apiKey == "" {
+		return nil, ErrAPIKeyNotSet
 	}
-	defer resp.Body.Close()
 
-	// Read response body
-	body, err := io.ReadAll(resp.Body)
+	// Send the request, retrying transient failures
+	status, body, err := doWithRetry(ctx, c.client, c.config, ProviderID(c), func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(reqBody))
+		if err != nil {
+			return nil, err
+		}
+
+		// Set headers
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", apiKey))
+		return req, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("error reading response: %w", err)
+		return nil, err
 	}
 
 	// Check for successful response
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("%w with status %d: %s", ErrRequestFailed, resp.StatusCode, string(body))
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("%w with status %d: %s", ErrRequestFailed, status, string(body))
 	}
 
-	// Parse ChatGPT's response
-	var chatGPTResp ChatGPTResponse
-	if err := json.Unmarshal(body, &chatGPTResp); err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrResponseParsing, err)
-	}
+	return body, nil
+}
 
+// parseResponse extracts the analysis from a chat completion
+func (c *ChatGPT) parseResponse(chatGPTResp *ChatGPTResponse) (*PromptAnalysis, error) {
 	// Extract and parse the JSON response from ChatGPT
 	if len(chatGPTResp.Choices) == 0 {
 		return nil, ErrInvalidResponse
@@ -131,10 +198,10 @@ func (c *ChatGPT) AnalyzePrompt(promptText string) (*PromptAnalysis, error) {
 
 	// Parse the analysis
 	jsonText := chatGPTResp.Choices[0].Message.Content
-	var analysis PromptAnalysis
-	if err := prompt.ParseJSON(jsonText, &analysis); err != nil {
-		return nil, fmt.Errorf("%w: %v\nRaw response: %s", ErrResponseParsing, err, jsonText)
+	analysis, err := parseAnalysis(ProviderID(c), jsonText)
+	if err != nil {
+		return nil, fmt.Errorf("%w\nRaw response: %s", err, jsonText)
 	}
 
-	return &analysis, nil
-}
\ No newline at end of file
+	return analysis, nil
+}
@@ -0,0 +1,226 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/url"
+)
+
+// ChatGPTBatchEntry is one line of an OpenAI Batch API input file
+type ChatGPTBatchEntry struct {
+	CustomID string         `json:"custom_id"`
+	Method   string         `json:"method"`
+	URL      string         `json:"url"`
+	Body     ChatGPTRequest `json:"body"`
+}
+
+// ChatGPTBatchCreate represents the request to create an OpenAI batch
+type ChatGPTBatchCreate struct {
+	InputFileID      string `json:"input_file_id"`
+	Endpoint         string `json:"endpoint"`
+	CompletionWindow string `json:"completion_window"`
+}
+
+// ChatGPTBatch represents a batch returned by the OpenAI Batch API
+type ChatGPTBatch struct {
+	ID           string `json:"id"`
+	Status       string `json:"status"`
+	OutputFileID string `json:"output_file_id"`
+	ErrorFileID  string `json:"error_file_id"`
+}
+
+// ChatGPTFile represents a file uploaded to the OpenAI Files API
+type ChatGPTFile struct {
+	ID string `json:"id"`
+}
+
+// ChatGPTBatchResult represents one line of an OpenAI batch output or error file
+type ChatGPTBatchResult struct {
+	CustomID string `json:"custom_id"`
+	Response *struct {
+		StatusCode int             `json:"status_code"`
+		Body       ChatGPTResponse `json:"body"`
+	} `json:"response"`
+	Error *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// SubmitBatch uploads a JSONL input file with one chat completion per prompt
+// and creates a batch over it
+func (c *ChatGPT) SubmitBatch(ctx context.Context, prompts []BatchPrompt) (string, error) {
+	// Batch entries target the same endpoint as realtime requests
+	endpoint, err := url.Parse(c.config.ChatGPT.APIURL)
+	if err != nil {
+		return "", fmt.Errorf("error parsing API URL: %w", err)
+	}
+
+	// Build the JSONL input file
+	var input bytes.Buffer
+	encoder := json.NewEncoder(&input)
+	for _, p := range prompts {
+		entry := ChatGPTBatchEntry{
+			CustomID: p.CustomID,
+			Method:   "POST",
+			URL:      endpoint.Path,
+			Body:     c.newRequest(ctx, p.Prompt),
+		}
+		if err := encoder.Encode(entry); err != nil {
+			return "", fmt.Errorf("error marshaling request: %w", err)
+		}
+	}
+
+	// Upload the input file
+	fileID, err := c.uploadBatchFile(ctx, input.Bytes())
+	if err != nil {
+		return "", err
+	}
+
+	// Create the batch
+	reqBody, err := json.Marshal(ChatGPTBatchCreate{
+		InputFileID:      fileID,
+		Endpoint:         endpoint.Path,
+		CompletionWindow: "24h",
+	})
+	if err != nil {
+		return "", fmt.Errorf("error marshaling request: %w", err)
+	}
+	body, err := c.send(ctx, "POST", c.config.ChatGPT.BatchAPIURL, "application/json", reqBody)
+	if err != nil {
+		return "", err
+	}
+
+	var batch ChatGPTBatch
+	if err := json.Unmarshal(body, &batch); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrResponseParsing, err)
+	}
+	if batch.ID == "" {
+		return "", ErrInvalidResponse
+	}
+
+	return batch.ID, nil
+}
+
+// BatchResults checks a batch and downloads its output and error files once
+// it has ended
+func (c *ChatGPT) BatchResults(ctx context.Context, batchID string) (map[string]BatchResult, bool, error) {
+	// Check the batch status
+	body, err := c.send(ctx, "GET", c.config.ChatGPT.BatchAPIURL+"/"+batchID, "", nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var batch ChatGPTBatch
+	if err := json.Unmarshal(body, &batch); err != nil {
+		return nil, false, fmt.Errorf("%w: %v", ErrResponseParsing, err)
+	}
+
+	switch batch.Status {
+	case "completed", "expired", "cancelled":
+		// Ended; expired and cancelled batches may still have partial output
+	case "failed":
+		return nil, true, fmt.Errorf("%w: batch %s failed validation", ErrBatchFailed, batchID)
+	default:
+		return nil, false, nil
+	}
+
+	// Collect results from the output and error files
+	results := make(map[string]BatchResult)
+	for _, fileID := range []string{batch.OutputFileID, batch.ErrorFileID} {
+		if fileID == "" {
+			continue
+		}
+		if err := c.readBatchFile(ctx, fileID, results); err != nil {
+			return nil, true, err
+		}
+	}
+
+	return results, true, nil
+}
+
+// uploadBatchFile uploads JSONL content to the Files API with the batch purpose
+func (c *ChatGPT) uploadBatchFile(ctx context.Context, content []byte) (string, error) {
+	// Build the multipart form
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	if err := writer.WriteField("purpose", "batch"); err != nil {
+		return "", fmt.Errorf("error building upload: %w", err)
+	}
+	part, err := writer.CreateFormFile("file", "batch.jsonl")
+	if err != nil {
+		return "", fmt.Errorf("error building upload: %w", err)
+	}
+	if _, err := part.Write(content); err != nil {
+		return "", fmt.Errorf("error building upload: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return "", fmt.Errorf("error building upload: %w", err)
+	}
+
+	// Upload the file
+	body, err := c.send(ctx, "POST", c.config.ChatGPT.FilesAPIURL, writer.FormDataContentType(), form.Bytes())
+	if err != nil {
+		return "", err
+	}
+
+	var file ChatGPTFile
+	if err := json.Unmarshal(body, &file); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrResponseParsing, err)
+	}
+	if file.ID == "" {
+		return "", ErrInvalidResponse
+	}
+
+	return file.ID, nil
+}
+
+// readBatchFile downloads a batch output or error file and adds its lines to
+// results, recording the usage of each completion
+func (c *ChatGPT) readBatchFile(ctx context.Context, fileID string, results map[string]BatchResult) error {
+	body, err := c.send(ctx, "GET", c.config.ChatGPT.FilesAPIURL+"/"+fileID+"/content", "", nil)
+	if err != nil {
+		return err
+	}
+
+	// Parse one result per line
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var line ChatGPTBatchResult
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return fmt.Errorf("%w: %v", ErrResponseParsing, err)
+		}
+
+		switch {
+		case line.Error != nil:
+			results[line.CustomID] = BatchResult{Err: fmt.Errorf("%w: %s: %s", ErrRequestFailed, line.Error.Code, line.Error.Message)}
+		case line.Response == nil:
+			results[line.CustomID] = BatchResult{Err: ErrInvalidResponse}
+		case line.Response.StatusCode != 200:
+			results[line.CustomID] = BatchResult{Err: fmt.Errorf("%w with status %d", ErrRequestFailed, line.Response.StatusCode)}
+		default:
+			resp := &line.Response.Body
+			recordUsage(ctx, ProviderID(c), ModelFor(ctx, c), resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
+			analysis, err := c.parseResponse(resp)
+			results[line.CustomID] = BatchResult{
+				Analysis: analysis,
+				Usage:    Usage{InputTokens: resp.Usage.PromptTokens, OutputTokens: resp.Usage.CompletionTokens},
+				Err:      err,
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading results: %w", err)
+	}
+
+	return nil
+}
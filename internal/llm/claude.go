@@ -2,19 +2,20 @@ package llm
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
-	"os"
 
 	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
-	"github.com/rlnorthcutt/ai-prompt-analysis/internal/prompt"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/metrics"
 )
 
 // Claude implements the LLM interface for Claude API
 type Claude struct {
 	config *config.Config
+	client *http.Client
 }
 
 // ClaudeRequest represents the request structure for Claude API
@@ -37,12 +38,17 @@ type ClaudeResponse struct {
 	Content []struct {
 		Text string `json:"text"`
 	} `json:"content"`
+	Usage struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
 }
 
 // NewClaude creates a new Claude instance
 func NewClaude(config *config.Config) *Claude {
 	return &Claude{
 		config: config,
+		client: newHTTPClient(config.Claude.Cassette),
 	}
 }
 
@@ -51,76 +57,137 @@ func (c *Claude) Name() string {
 	return "Claude"
 }
 
+// Model returns the model ID used for analysis
+func (c *Claude) Model() string {
+	return c.config.Claude.ModelID
+}
+
 // IsAvailable checks if the Claude API is available
 func (c *Claude) IsAvailable() bool {
-	apiKey := os.Getenv("CLAUDE_API_KEY")
-	return apiKey != ""
+	return lookupAPIKey("CLAUDE_API_KEY", c.config.Claude.Cassette) != ""
 }
 
-// AnalyzePrompt analyzes a prompt using Claude API
-func (c *Claude) AnalyzePrompt(promptText string) (*PromptAnalysis, error) {
-	// Get API key from environment
-	apiKey := os.Getenv("CLAUDE_API_KEY")
-	if apiKey == "" {
-		return nil, ErrAPIKeyNotSet
+// AnalyzePrompt analyzes a prompt using Claude API. A reply that fails the
+// analysis schema is sent back once with the problems for correction.
+func (c *Claude) AnalyzePrompt(ctx context.Context, promptText string) (*PromptAnalysis, error) {
+	req := c.newRequest(ctx, promptText)
+	claudeResp, err := c.complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	analysis, err := c.parse(ctx, claudeResp)
+	if !errors.Is(err, ErrResponseParsing) || len(claudeResp.Content) == 0 {
+		return analysis, err
 	}
 
-	// Create Claude API request payload
-	claudeReq := ClaudeRequest{
-		Model:     c.config.Claude.ModelID,
-		MaxTokens: c.config.Claude.MaxTokens,
-		Messages: []ClaudeMessage{
-			{
-				Role:    "user",
-				Content: fmt.Sprintf("Analyze this prompt: %s", promptText),
-			},
-		},
-		System:      c.config.Analysis.SystemPrompt,
-		Temperature: c.config.Claude.Temperature,
+	// Ask once for a corrected reply
+	req.Messages = append(req.Messages,
+		ClaudeMessage{Role: "assistant", Content: claudeResp.Content[0].Text},
+		ClaudeMessage{Role: "user", Content: correctionPrompt(err)},
+	)
+	if claudeResp, err = c.complete(ctx, req); err != nil {
+		return nil, err
 	}
+	if analysis, err = c.parse(ctx, claudeResp); err != nil {
+		return nil, err
+	}
+	metrics.ResponseRepairs.WithLabelValues(ProviderID(c), "reprompt").Inc()
+	return analysis, nil
+}
 
+// complete sends a messages request and decodes the reply, recording
+// its usage
+func (c *Claude) complete(ctx context.Context, req ClaudeRequest) (*ClaudeResponse, error) {
 	// Convert request to JSON
-	reqBody, err := json.Marshal(claudeReq)
+	reqBody, err := json.Marshal(req)
 	if err != nil {
 		return nil, fmt.Errorf("error marshaling request: %w", err)
 	}
 
-	// Create HTTP request
-	req, err := http.NewRequest("POST", c.config.Claude.APIURL, bytes.NewBuffer(reqBody))
+	// Send request
+	body, err := c.send(ctx, "POST", c.config.Claude.APIURL, "application/json", reqBody)
 	if err != nil {
-		return nil, fmt.Errorf("error creating request: %w", err)
+		return nil, err
 	}
 
-	// Set headers
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", apiKey)
-	req.Header.Set("anthropic-version", c.config.Claude.Version)
+	// Parse Claude's response
+	var claudeResp ClaudeResponse
+	if err := json.Unmarshal(body, &claudeResp); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrResponseParsing, err)
+	}
+	recordUsage(ctx, ProviderID(c), ModelFor(ctx, c), claudeResp.Usage.InputTokens, claudeResp.Usage.OutputTokens)
+	return &claudeResp, nil
+}
 
-	// Send request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrRequestFailed, err)
+// parse extracts the analysis from a reply within a trace span
+func (c *Claude) parse(ctx context.Context, claudeResp *ClaudeResponse) (*PromptAnalysis, error) {
+	_, span := tracer.Start(ctx, "llm.parse_response")
+	analysis, err := c.parseResponse(claudeResp)
+	endSpan(span, err)
+	return analysis, err
+}
+
+// Ping checks the API is reachable and the key is accepted by listing models
+func (c *Claude) Ping(ctx context.Context) error {
+	_, err := c.send(ctx, "GET", c.config.Claude.ModelsURL, "", nil)
+	return err
+}
+
+// newRequest creates the Claude API request payload for a prompt, with the
+// context's model and system prompt overrides
+func (c *Claude) newRequest(ctx context.Context, promptText string) ClaudeRequest {
+	return ClaudeRequest{
+		Model:     ModelFor(ctx, c),
+		MaxTokens: c.config.Claude.MaxTokens,
+		Messages: []ClaudeMessage{
+			{
+				Role:    "user",
+				Content: fmt.Sprintf("Analyze this prompt: %s", promptText),
+			},
+		},
+		System:      SystemPromptFor(ctx, c.config.Analysis.SystemPrompt),
+		Temperature: c.config.Claude.Temperature,
+	}
+}
+
+// send performs an authenticated request against the Claude API and returns
+// the response body, failing on any non-200 status
+func (c *Claude) send(ctx context.Context, method, url, contentType string, reqBody []byte) ([]byte, error) {
+	// Get API key from environment
+	apiKey := lookupAPIKey("CLAUDE_API_KEY", c.config.Claude.Cassette)
+	if apiKey == "" {
+		return nil, ErrAPIKeyNotSet
 	}
-	defer resp.Body.Close()
 
-	// Read response body
-	body, err := io.ReadAll(resp.Body)
+	// Send the request, retrying transient failures
+	status, body, err := doWithRetry(ctx, c.client, c.config, ProviderID(c), func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(reqBody))
+		if err != nil {
+			return nil, err
+		}
+
+		// Set headers
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		req.Header.Set("x-api-key", apiKey)
+		req.Header.Set("anthropic-version", c.config.Claude.Version)
+		return req, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("error reading response: %w", err)
+		return nil, err
 	}
 
 	// Check for successful response
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("%w with status %d: %s", ErrRequestFailed, resp.StatusCode, string(body))
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("%w with status %d: %s", ErrRequestFailed, status, string(body))
 	}
 
-	// Parse Claude's response
-	var claudeResp ClaudeResponse
-	if err := json.Unmarshal(body, &claudeResp); err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrResponseParsing, err)
-	}
+	return body, nil
+}
 
+// parseResponse extracts the analysis from a Claude message
+func (c *Claude) parseResponse(claudeResp *ClaudeResponse) (*PromptAnalysis, error) {
 	// Extract and parse the JSON response from Claude
 	if len(claudeResp.Content) == 0 {
 		return nil, ErrInvalidResponse
@@ -128,10 +195,10 @@ func (c *Claude) AnalyzePrompt(promptText string) (*PromptAnalysis, error) {
 
 	// Parse the analysis
 	jsonText := claudeResp.Content[0].Text
-	var analysis PromptAnalysis
-	if err := prompt.ParseJSON(jsonText, &analysis); err != nil {
-		return nil, fmt.Errorf("%w: %v\nRaw response: %s", ErrResponseParsing, err, jsonText)
+	analysis, err := parseAnalysis(ProviderID(c), jsonText)
+	if err != nil {
+		return nil, fmt.Errorf("%w\nRaw response: %s", err, jsonText)
 	}
 
-	return &analysis, nil
-}
\ No newline at end of file
+	return analysis, nil
+}
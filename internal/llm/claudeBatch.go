@@ -0,0 +1,134 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// ClaudeBatchRequest represents the request structure for the Message Batches API
+type ClaudeBatchRequest struct {
+	Requests []ClaudeBatchEntry `json:"requests"`
+}
+
+// ClaudeBatchEntry is one message request within a batch
+type ClaudeBatchEntry struct {
+	CustomID string        `json:"custom_id"`
+	Params   ClaudeRequest `json:"params"`
+}
+
+// ClaudeBatch represents a message batch returned by the Message Batches API
+type ClaudeBatch struct {
+	ID               string `json:"id"`
+	ProcessingStatus string `json:"processing_status"`
+	ResultsURL       string `json:"results_url"`
+}
+
+// ClaudeBatchResult represents one line of a message batch results file
+type ClaudeBatchResult struct {
+	CustomID string `json:"custom_id"`
+	Result   struct {
+		Type    string          `json:"type"` // succeeded, errored, canceled or expired
+		Message ClaudeResponse  `json:"message"`
+		Error   json.RawMessage `json:"error"`
+	} `json:"result"`
+}
+
+// SubmitBatch creates a message batch with one request per prompt
+func (c *Claude) SubmitBatch(ctx context.Context, prompts []BatchPrompt) (string, error) {
+	// Build one message request per prompt
+	batchReq := ClaudeBatchRequest{Requests: make([]ClaudeBatchEntry, len(prompts))}
+	for i, p := range prompts {
+		batchReq.Requests[i] = ClaudeBatchEntry{
+			CustomID: p.CustomID,
+			Params:   c.newRequest(ctx, p.Prompt),
+		}
+	}
+
+	// Convert request to JSON
+	reqBody, err := json.Marshal(batchReq)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling request: %w", err)
+	}
+
+	// Create the batch
+	body, err := c.send(ctx, "POST", c.config.Claude.BatchAPIURL, "application/json", reqBody)
+	if err != nil {
+		return "", err
+	}
+
+	var batch ClaudeBatch
+	if err := json.Unmarshal(body, &batch); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrResponseParsing, err)
+	}
+	if batch.ID == "" {
+		return "", ErrInvalidResponse
+	}
+
+	return batch.ID, nil
+}
+
+// BatchResults checks a message batch and downloads its results once it has
+// ended, recording the usage of each message
+func (c *Claude) BatchResults(ctx context.Context, batchID string) (map[string]BatchResult, bool, error) {
+	// Check the batch status
+	body, err := c.send(ctx, "GET", c.config.Claude.BatchAPIURL+"/"+batchID, "", nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var batch ClaudeBatch
+	if err := json.Unmarshal(body, &batch); err != nil {
+		return nil, false, fmt.Errorf("%w: %v", ErrResponseParsing, err)
+	}
+	if batch.ProcessingStatus != "ended" {
+		return nil, false, nil
+	}
+	if batch.ResultsURL == "" {
+		return nil, true, fmt.Errorf("%w: batch %s ended without results", ErrBatchFailed, batchID)
+	}
+
+	// Download the results file
+	body, err = c.send(ctx, "GET", batch.ResultsURL, "", nil)
+	if err != nil {
+		return nil, true, err
+	}
+
+	// Parse one result per line
+	results := make(map[string]BatchResult)
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var line ClaudeBatchResult
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, true, fmt.Errorf("%w: %v", ErrResponseParsing, err)
+		}
+
+		switch line.Result.Type {
+		case "succeeded":
+			message := &line.Result.Message
+			recordUsage(ctx, ProviderID(c), ModelFor(ctx, c), message.Usage.InputTokens, message.Usage.OutputTokens)
+			analysis, err := c.parseResponse(message)
+			results[line.CustomID] = BatchResult{
+				Analysis: analysis,
+				Usage:    Usage{InputTokens: message.Usage.InputTokens, OutputTokens: message.Usage.OutputTokens},
+				Err:      err,
+			}
+		case "errored":
+			results[line.CustomID] = BatchResult{Err: fmt.Errorf("%w: %s", ErrRequestFailed, string(line.Result.Error))}
+		default:
+			results[line.CustomID] = BatchResult{Err: fmt.Errorf("%w: request %s", ErrBatchFailed, line.Result.Type)}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, true, fmt.Errorf("error reading results: %w", err)
+	}
+
+	return results, true, nil
+}
@@ -0,0 +1,135 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+)
+
+// Payer states of a flight besides the index of the paying caller
+const (
+	payerNext = -1 // The payer left; the next caller to receive the result pays
+	payerPaid = -2 // The usage has been charged
+)
+
+// flight is one provider call shared by concurrent identical analyses
+type flight struct {
+	done     chan struct{}
+	analysis *PromptAnalysis
+	usage    Usage // Tokens the call consumed, charged to one caller
+	err      error
+
+	// Guarded by the group's mutex
+	callers int                // Callers that have joined, numbering them from 0
+	waiters int                // Callers still waiting
+	payer   int                // Caller charged the usage, or a payer state
+	cancel  context.CancelFunc // Stops the call once no caller is waiting
+}
+
+// flightGroup coalesces concurrent analyses of the same prompt, so that only
+// the first caller reaches the provider and the rest share its result
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// flightKey identifies an analysis by the tenant, model, system prompt and
+// prompt it is made with
+func flightKey(tenant, model, systemPrompt, promptText string) string {
+	h := sha256.New()
+	for _, part := range []string{tenant, model, systemPrompt, promptText} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// do runs analyze for the first caller with a key and makes later callers
+// with the same key wait for its result. It reports whether the result was
+// shared with an earlier caller. The call runs with the first caller's
+// context values, so its spans are recorded there, but collects its usage
+// separately. The usage is added to the first caller's context, or, if it
+// stopped waiting, to that of the next caller to receive the result, so one
+// call is charged once; the other callers are charged nothing. The call is
+// only cancelled once every waiting caller has gone.
+func (g *flightGroup) do(ctx context.Context, key string, analyze func(context.Context) (*PromptAnalysis, error)) (*PromptAnalysis, bool, error) {
+	g.mu.Lock()
+	if g.flights == nil {
+		g.flights = make(map[string]*flight)
+	}
+	f, shared := g.flights[key]
+	if !shared {
+		callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		callCtx, usage := WithUsage(callCtx)
+		f = &flight{done: make(chan struct{}), cancel: cancel}
+		g.flights[key] = f
+		go func() {
+			defer cancel()
+			f.analysis, f.err = analyze(callCtx)
+			f.usage = *usage
+			g.mu.Lock()
+			g.forget(key, f)
+			g.mu.Unlock()
+			close(f.done)
+		}()
+	}
+	caller := f.callers
+	f.callers++
+	f.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return g.receive(ctx, f, caller, shared)
+	case <-ctx.Done():
+	}
+
+	g.mu.Lock()
+	select {
+	case <-f.done:
+		// The result arrived as the caller gave up, and a later caller may
+		// already have received it expecting this one to pay
+		g.mu.Unlock()
+		return g.receive(ctx, f, caller, shared)
+	default:
+	}
+	f.waiters--
+	if f.payer == caller {
+		f.payer = payerNext
+	}
+	if f.waiters == 0 {
+		// Later callers start a fresh call rather than join this one
+		f.cancel()
+		g.forget(key, f)
+	}
+	g.mu.Unlock()
+	return nil, shared, fmt.Errorf("%w: %v", ErrRequestFailed, ctx.Err())
+}
+
+// receive returns the flight's result to a caller, charging it the usage if
+// it is the payer
+func (g *flightGroup) receive(ctx context.Context, f *flight, caller int, shared bool) (*PromptAnalysis, bool, error) {
+	g.mu.Lock()
+	if f.payer == caller || f.payer == payerNext {
+		f.payer = payerPaid
+		addUsage(ctx, f.usage.InputTokens, f.usage.OutputTokens)
+	}
+	g.mu.Unlock()
+
+	if f.err != nil {
+		return nil, shared, f.err
+	}
+	// Each caller gets its own copy of the analysis
+	analysis := *f.analysis
+	return &analysis, shared, nil
+}
+
+// forget removes the flight from the group unless it has been replaced. The
+// caller must hold the group's mutex.
+func (g *flightGroup) forget(key string, f *flight) {
+	if g.flights[key] == f {
+		delete(g.flights, key)
+	}
+}
@@ -0,0 +1,136 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingCall returns an analyze function that reports usage once release
+// is closed, counting the calls made
+func blockingCall(calls *atomic.Int32, release <-chan struct{}) func(context.Context) (*PromptAnalysis, error) {
+	return func(ctx context.Context) (*PromptAnalysis, error) {
+		calls.Add(1)
+		<-release
+		addUsage(ctx, 100, 20)
+		return &PromptAnalysis{PromptType: "coding", RiskScore: 2}, nil
+	}
+}
+
+// waitForCallers blocks until the flight for key has n callers
+func waitForCallers(t *testing.T, g *flightGroup, key string, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		g.mu.Lock()
+		f := g.flights[key]
+		joined := f != nil && f.callers == n
+		g.mu.Unlock()
+		if joined {
+			return
+		}
+	}
+	t.Fatalf("flight did not reach %d callers", n)
+}
+
+func TestFlightChargesUsageOnce(t *testing.T) {
+	var g flightGroup
+	var calls atomic.Int32
+	release := make(chan struct{})
+	key := flightKey("", "model", "system", "prompt")
+
+	const callers = 5
+	usages := make([]*Usage, callers)
+	var wg sync.WaitGroup
+	for i := range callers {
+		ctx, usage := WithUsage(context.Background())
+		usages[i] = usage
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := g.do(ctx, key, blockingCall(&calls, release)); err != nil {
+				t.Errorf("caller %d: %v", i, err)
+			}
+		}()
+		waitForCallers(t, &g, key, i+1)
+	}
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Errorf("calls = %d, want 1", calls.Load())
+	}
+	total := Usage{}
+	for _, u := range usages {
+		total.InputTokens += u.InputTokens
+		total.OutputTokens += u.OutputTokens
+	}
+	if total != (Usage{InputTokens: 100, OutputTokens: 20}) {
+		t.Errorf("total charged = %+v, want one call", total)
+	}
+	if *usages[0] != total {
+		t.Errorf("leader charged %+v, want %+v", *usages[0], total)
+	}
+}
+
+func TestFlightPassesChargeOnWhenLeaderLeaves(t *testing.T) {
+	var g flightGroup
+	var calls atomic.Int32
+	release := make(chan struct{})
+	key := flightKey("", "model", "system", "prompt")
+
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	leaderCtx, leaderUsage := WithUsage(leaderCtx)
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, _, err := g.do(leaderCtx, key, blockingCall(&calls, release))
+		leaderErr <- err
+	}()
+	waitForCallers(t, &g, key, 1)
+
+	waiterCtx, waiterUsage := WithUsage(context.Background())
+	waiterDone := make(chan error, 1)
+	go func() {
+		_, shared, err := g.do(waiterCtx, key, blockingCall(&calls, release))
+		if !shared {
+			t.Error("waiter did not share the call")
+		}
+		waiterDone <- err
+	}()
+	waitForCallers(t, &g, key, 2)
+
+	// The leader gives up; the call continues for the waiter, who pays
+	cancel()
+	if err := <-leaderErr; !errors.Is(err, ErrRequestFailed) {
+		t.Fatalf("leader err = %v", err)
+	}
+	close(release)
+	if err := <-waiterDone; err != nil {
+		t.Fatalf("waiter: %v", err)
+	}
+	if leaderUsage.Total() != 0 || waiterUsage.Total() != 120 {
+		t.Errorf("leader charged %+v, waiter %+v", *leaderUsage, *waiterUsage)
+	}
+}
+
+func TestFlightKeySeparatesTenants(t *testing.T) {
+	base := flightKey("", "model", "system", "prompt")
+	for _, key := range []string{
+		flightKey("acme", "model", "system", "prompt"),
+		flightKey("", "model-2", "system", "prompt"),
+		flightKey("", "model", "system 2", "prompt"),
+		flightKey("", "model", "system", "prompt 2"),
+	} {
+		if key == base {
+			t.Errorf("key %s matches the base key", key)
+		}
+	}
+
+	// Tenant overrides reach the key through the context
+	ctx := WithOverrides(context.Background(), &Overrides{Tenant: "acme"})
+	if TenantFor(ctx) != "acme" || TenantFor(context.Background()) != "" {
+		t.Error("TenantFor does not read the overrides")
+	}
+}
@@ -0,0 +1,178 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/metrics"
+)
+
+// ErrQuotaExceeded is returned when a provider call would wait longer than
+// the quota's max_wait
+var ErrQuotaExceeded = errors.New("provider quota exceeded")
+
+// defaultQuotaWait is used when a quota leaves max_wait unset
+const defaultQuotaWait = 10 * time.Second
+
+// QuotaError reports a call shed by the governor and when to try again
+type QuotaError struct {
+	Provider   string
+	Limit      string        // "requests" or "tokens"
+	RetryAfter time.Duration // Time until the call would have been admitted
+}
+
+// Error describes the exhausted quota
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s: %s per minute limit for %s, retry after %s", ErrQuotaExceeded, e.Limit, e.Provider, e.RetryAfter.Round(time.Second))
+}
+
+// Unwrap lets errors.Is match ErrQuotaExceeded
+func (e *QuotaError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+// waitKey marks a context whose calls queue for quota without a time limit
+type waitKey struct{}
+
+// WaitForQuota returns a context whose provider calls queue for as long as
+// the quota requires instead of being shed after max_wait. Background work
+// such as batch jobs uses it.
+func WaitForQuota(ctx context.Context) context.Context {
+	return context.WithValue(ctx, waitKey{}, true)
+}
+
+// quotaBucket refills at a per-minute rate up to its capacity. Its level
+// goes negative while calls are queued against it.
+type quotaBucket struct {
+	capacity float64
+	level    float64
+}
+
+// deficit returns how long it takes the bucket to hold n
+func (b *quotaBucket) deficit(n float64) time.Duration {
+	if b.capacity == 0 || b.level >= n {
+		return 0
+	}
+	return time.Duration((n - b.level) / b.capacity * float64(time.Minute))
+}
+
+// governor keeps calls to one provider within its requests-per-minute and
+// tokens-per-minute quotas. Calls reserve capacity up front, queue until it
+// is available and are shed if that would take longer than max_wait. Token
+// reservations are estimates, corrected with the usage the API reports.
+type governor struct {
+	provider string
+	maxWait  time.Duration
+
+	mu       sync.Mutex
+	requests quotaBucket
+	tokens   quotaBucket
+	updated  time.Time
+}
+
+// reservation is capacity taken by one call
+type reservation struct {
+	g      *governor
+	tokens float64
+}
+
+// newGovernor returns a governor for the quota, or nil when it sets no
+// limits
+func newGovernor(provider string, quota config.ProviderQuota) *governor {
+	if quota.RequestsPerMinute <= 0 && quota.TokensPerMinute <= 0 {
+		return nil
+	}
+	maxWait := quota.MaxWait
+	if maxWait <= 0 {
+		maxWait = defaultQuotaWait
+	}
+	return &governor{
+		provider: provider,
+		maxWait:  maxWait,
+		requests: quotaBucket{capacity: float64(quota.RequestsPerMinute), level: float64(quota.RequestsPerMinute)},
+		tokens:   quotaBucket{capacity: float64(quota.TokensPerMinute), level: float64(quota.TokensPerMinute)},
+		updated:  time.Now(),
+	}
+}
+
+// reserve takes one request and the estimated tokens from the quota, waiting
+// until they are available. A nil governor admits every call.
+func (g *governor) reserve(ctx context.Context, estimate int) (*reservation, error) {
+	if g == nil {
+		return nil, nil
+	}
+
+	g.mu.Lock()
+	g.refill(time.Now())
+	tokens := float64(estimate)
+	if g.tokens.capacity > 0 {
+		tokens = math.Min(tokens, g.tokens.capacity) // A call larger than the quota would never fit
+	}
+	delay, limit := g.requests.deficit(1), "requests"
+	if d := g.tokens.deficit(tokens); d > delay {
+		delay, limit = d, "tokens"
+	}
+	if delay > g.maxWait && ctx.Value(waitKey{}) == nil {
+		g.mu.Unlock()
+		metrics.QuotaShed.WithLabelValues(g.provider, limit).Inc()
+		return nil, &QuotaError{Provider: g.provider, Limit: limit, RetryAfter: delay}
+	}
+	g.requests.level--
+	if g.tokens.capacity > 0 {
+		g.tokens.level -= tokens
+	}
+	g.mu.Unlock()
+
+	res := &reservation{g: g, tokens: tokens}
+	metrics.QuotaWait.WithLabelValues(g.provider).Observe(delay.Seconds())
+	if delay <= 0 {
+		return res, nil
+	}
+
+	// Queue until the reserved capacity has been earned
+	trace.SpanFromContext(ctx).AddEvent("quota_wait", trace.WithAttributes(
+		attribute.String("llm.quota.limit", limit),
+		attribute.String("llm.quota.wait", delay.String()),
+	))
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return res, nil
+	case <-ctx.Done():
+		res.release(0)
+		g.mu.Lock()
+		g.requests.level++
+		g.mu.Unlock()
+		return nil, fmt.Errorf("%w: %v", ErrRequestFailed, ctx.Err())
+	}
+}
+
+// release settles the reservation with the tokens the call actually used,
+// returning any excess to the quota. A nil reservation is ignored.
+func (r *reservation) release(used int) {
+	if r == nil || r.g.tokens.capacity == 0 {
+		return
+	}
+	r.g.mu.Lock()
+	r.g.tokens.level += r.tokens - float64(used)
+	r.g.mu.Unlock()
+}
+
+// refill adds the capacity earned since the last update; the caller holds
+// g.mu
+func (g *governor) refill(now time.Time) {
+	elapsed := now.Sub(g.updated).Minutes()
+	g.updated = now
+	for _, b := range []*quotaBucket{&g.requests, &g.tokens} {
+		b.level = math.Min(b.level+elapsed*b.capacity, b.capacity)
+	}
+}
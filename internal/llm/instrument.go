@@ -0,0 +1,163 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/metrics"
+)
+
+// tracer records spans for provider calls
+var tracer = otel.Tracer("github.com/rlnorthcutt/ai-prompt-analysis/internal/llm")
+
+// Instrumented wraps a provider to record metrics and health for each
+// analysis, to keep its calls within the configured quota, and to share one
+// call between concurrent identical analyses
+type Instrumented struct {
+	LLM
+	id           string // Provider identifier, as accepted by NewProvider
+	systemPrompt string // Configured system prompt; tenants may override it
+	status       statusTracker
+	governor     *governor
+	flights      flightGroup
+	reserve      int // Output tokens reserved per call until usage is known
+}
+
+// Instrument returns a provider that traces every analysis made through it
+// and records its latency, parse failures, risk score and recent health.
+// Calls are held to the provider's entry in quotas, if any.
+func Instrument(provider LLM, cfg *config.Config) *Instrumented {
+	id := ProviderID(provider)
+	p := &Instrumented{
+		LLM:          provider,
+		id:           id,
+		systemPrompt: cfg.Analysis.SystemPrompt,
+		governor:     newGovernor(id, cfg.Quotas[id]),
+	}
+
+	// Reserve the full output allowance, as vendors do when they meter
+	// max_tokens against the tokens-per-minute limit
+	switch id {
+	case "claude":
+		p.reserve = cfg.Claude.MaxTokens
+	case "chatgpt":
+		p.reserve = cfg.ChatGPT.MaxTokens
+	}
+	return p
+}
+
+// Status returns the provider's rolling health statistics
+func (p *Instrumented) Status() Status {
+	return p.status.snapshot()
+}
+
+// Ping checks that the wrapped provider's API is reachable. Providers that
+// cannot be pinged are considered reachable when they are available.
+func (p *Instrumented) Ping(ctx context.Context) error {
+	if !p.IsAvailable() {
+		return ErrAPIKeyNotSet
+	}
+	if pinger, ok := p.LLM.(Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+// AnalyzePrompt analyzes the prompt with the wrapped provider and records
+// the outcome. Concurrent calls for the same tenant with the same prompt,
+// model and system prompt share one provider call, whose usage is charged
+// to only one of them.
+func (p *Instrumented) AnalyzePrompt(ctx context.Context, promptText string) (*PromptAnalysis, error) {
+	key := flightKey(TenantFor(ctx), ModelFor(ctx, p), SystemPromptFor(ctx, p.systemPrompt), promptText)
+	analysis, shared, err := p.flights.do(ctx, key, func(ctx context.Context) (*PromptAnalysis, error) {
+		return p.analyze(ctx, promptText)
+	})
+	if shared {
+		metrics.CoalescedCalls.WithLabelValues(p.id).Inc()
+	}
+	return analysis, err
+}
+
+// analyze makes one traced, metered call to the wrapped provider
+func (p *Instrumented) analyze(ctx context.Context, promptText string) (*PromptAnalysis, error) {
+	ctx, span := tracer.Start(ctx, "llm.analyze", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("llm.provider", p.id),
+		attribute.String("llm.model", ModelFor(ctx, p)),
+	))
+
+	// Wait for room in the provider quota; shed calls don't count against
+	// the provider's health
+	res, err := p.governor.reserve(ctx, estimateTokens(promptText)+p.reserve)
+	if err != nil {
+		endSpan(span, err)
+		return nil, err
+	}
+
+	callCtx, usage := WithUsage(ctx)
+	start := time.Now()
+	analysis, err := p.LLM.AnalyzePrompt(callCtx, promptText)
+	res.release(usage.Total())
+	addUsage(ctx, usage.InputTokens, usage.OutputTokens)
+	endSpan(span, err)
+	p.status.record(time.Since(start), err)
+
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	metrics.ProviderLatency.WithLabelValues(p.id, ModelFor(ctx, p), outcome).Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		if errors.Is(err, ErrResponseParsing) || errors.Is(err, ErrInvalidResponse) {
+			metrics.ParseFailures.WithLabelValues(p.id).Inc()
+		}
+		return nil, err
+	}
+
+	span.SetAttributes(
+		attribute.String("llm.prompt_type", analysis.PromptType),
+		attribute.Int("llm.risk_score", analysis.RiskScore),
+	)
+	metrics.RiskScores.WithLabelValues(p.id).Observe(float64(analysis.RiskScore))
+	if analysis.ContainsPII {
+		metrics.PromptFlags.WithLabelValues(p.id, "pii").Inc()
+	}
+	if analysis.IsSuspicious {
+		metrics.PromptFlags.WithLabelValues(p.id, "suspicious").Inc()
+	}
+	return analysis, nil
+}
+
+// estimateTokens approximates the input tokens of a prompt at four bytes per
+// token
+func estimateTokens(promptText string) int {
+	return len(promptText)/4 + 1
+}
+
+// recordUsage adds the token counts from a provider usage block to the
+// token metrics, the current span and the call's usage
+func recordUsage(ctx context.Context, provider, model string, input, output int) {
+	addUsage(ctx, input, output)
+	metrics.Tokens.WithLabelValues(provider, model, "input").Add(float64(input))
+	metrics.Tokens.WithLabelValues(provider, model, "output").Add(float64(output))
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Int("llm.usage.input_tokens", input),
+		attribute.Int("llm.usage.output_tokens", output),
+	)
+}
+
+// endSpan marks the span as failed when err is set, then ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
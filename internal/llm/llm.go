@@ -1,7 +1,12 @@
 package llm
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
 )
 
 // Common errors
@@ -11,8 +16,32 @@ var (
 	ErrRequestFailed    = errors.New("request to LLM API failed")
 	ErrResponseParsing  = errors.New("failed to parse LLM API response")
 	ErrInvalidPrompt    = errors.New("invalid or empty prompt")
+	ErrUnknownProvider  = errors.New("unknown LLM provider")
 )
 
+// ErrorClass returns a short, stable category for an analysis error, for
+// use in logs and alerts
+func ErrorClass(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, ErrAPIKeyNotSet):
+		return "api_key"
+	case errors.Is(err, ErrQuotaExceeded):
+		return "quota"
+	case errors.Is(err, ErrResponseParsing), errors.Is(err, ErrInvalidResponse):
+		return "parse"
+	case errors.Is(err, ErrRequestFailed):
+		return "upstream"
+	default:
+		return "internal"
+	}
+}
+
 // PromptAnalysis represents the structured analysis of a prompt
 type PromptAnalysis struct {
 	TokenCount   int    `json:"tokenCount"`
@@ -26,10 +55,36 @@ type PromptAnalysis struct {
 type LLM interface {
 	// Name returns the name of the LLM provider
 	Name() string
+
+	// Model returns the model ID used for analysis
+	Model() string
 	
 	// AnalyzePrompt analyzes a prompt and returns a structured analysis
-	AnalyzePrompt(prompt string) (*PromptAnalysis, error)
+	AnalyzePrompt(ctx context.Context, prompt string) (*PromptAnalysis, error)
 	
 	// IsAvailable checks if the LLM provider is available (API key set, etc.)
 	IsAvailable() bool
-}
\ No newline at end of file
+}
+
+// ProviderNames lists the provider identifiers accepted by NewProvider
+var ProviderNames = []string{"claude", "chatgpt", "mock"}
+
+// ProviderID returns the identifier NewProvider accepts for a provider, which
+// is also its metric label
+func ProviderID(provider LLM) string {
+	return strings.ToLower(provider.Name())
+}
+
+// NewProvider creates the LLM provider with the given identifier
+func NewProvider(name string, cfg *config.Config) (LLM, error) {
+	switch name {
+	case "claude":
+		return NewClaude(cfg), nil
+	case "chatgpt":
+		return NewChatGPT(cfg), nil
+	case "mock":
+		return NewMock(cfg)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+	}
+}
@@ -0,0 +1,204 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/detect"
+)
+
+// ErrInjected is returned by the mock provider for simulated failures
+var ErrInjected = errors.New("injected mock error")
+
+// Mock implements the LLM interface without calling an API. Analyses come
+// from a fixture file when the prompt matches exactly, and otherwise from
+// keyword rules and the local detectors.
+type Mock struct {
+	config      *config.Config
+	fixtures    map[string]PromptAnalysis
+	detectors   []detect.Detector
+	piiPatterns []*regexp.Regexp
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// mockFixture is one line of a fixture file
+type mockFixture struct {
+	Prompt   string         `json:"prompt"`
+	Analysis PromptAnalysis `json:"analysis"`
+}
+
+// NewMock creates a new Mock instance, loading its fixtures and patterns
+func NewMock(config *config.Config) (*Mock, error) {
+	m := &Mock{
+		config:   config,
+		fixtures: make(map[string]PromptAnalysis),
+		rng:      rand.New(rand.NewPCG(config.Mock.Seed, config.Mock.Seed)),
+	}
+
+	// The built-in detectors provide the PII and jailbreak flags
+	detectors, err := detect.Load(nil)
+	if err != nil {
+		return nil, err
+	}
+	m.detectors = detectors
+
+	for _, pattern := range config.Mock.PIIPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mock PII pattern %q: %w", pattern, err)
+		}
+		m.piiPatterns = append(m.piiPatterns, re)
+	}
+
+	if config.Mock.Fixtures != "" {
+		if err := m.loadFixtures(config.Mock.Fixtures); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// loadFixtures reads a JSONL file of prompt/analysis pairs
+func (m *Mock) loadFixtures(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening mock fixtures: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var f mockFixture
+		if err := json.Unmarshal([]byte(text), &f); err != nil {
+			return fmt.Errorf("mock fixtures line %d: %w", line, err)
+		}
+		m.fixtures[f.Prompt] = f.Analysis
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading mock fixtures: %w", err)
+	}
+	return nil
+}
+
+// Name returns the name of the LLM provider
+func (m *Mock) Name() string {
+	return "Mock"
+}
+
+// Model returns the model ID used for analysis
+func (m *Mock) Model() string {
+	return m.config.Mock.ModelID
+}
+
+// IsAvailable reports whether the mock provider is enabled in config
+func (m *Mock) IsAvailable() bool {
+	return m.config.Mock.Enabled
+}
+
+// AnalyzePrompt returns a deterministic analysis after the configured delay
+func (m *Mock) AnalyzePrompt(ctx context.Context, promptText string) (*PromptAnalysis, error) {
+	// Simulate network latency
+	delay, fail := m.roll()
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%w: %v", ErrRequestFailed, ctx.Err())
+	}
+
+	// Inject failures
+	if fail || (m.config.Mock.ErrorKeyword != "" && strings.Contains(promptText, m.config.Mock.ErrorKeyword)) {
+		return nil, fmt.Errorf("%w: %w", ErrRequestFailed, ErrInjected)
+	}
+
+	// Report estimated usage so quotas can be exercised without an API
+	recordUsage(ctx, ProviderID(m), m.Model(), estimateTokens(promptText), 0)
+
+	// Fixtures take precedence over rules
+	if analysis, ok := m.fixtures[promptText]; ok {
+		return &analysis, nil
+	}
+
+	return m.analyze(ctx, promptText), nil
+}
+
+// roll draws the latency jitter and injected failure for one request
+func (m *Mock) roll() (time.Duration, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delay := m.config.Mock.Latency
+	if m.config.Mock.Jitter > 0 {
+		delay += time.Duration(m.rng.Int64N(int64(m.config.Mock.Jitter)))
+	}
+	return delay, m.config.Mock.ErrorRate > 0 && m.rng.Float64() < m.config.Mock.ErrorRate
+}
+
+// analyze derives an analysis from the type rules and local detectors
+func (m *Mock) analyze(ctx context.Context, promptText string) *PromptAnalysis {
+	detectors := m.detectors
+	if o := overridesFrom(ctx); o.Detectors != nil {
+		detectors = o.Detectors
+	}
+	report := detect.Run(ctx, detectors, promptText)
+	if !report.ContainsPII {
+		for _, re := range m.piiPatterns {
+			if re.MatchString(promptText) {
+				report.ContainsPII = true
+				report.RiskScore = min(report.RiskScore+3, 10)
+				break
+			}
+		}
+	}
+
+	// The first rule with a matching keyword sets the type
+	promptType := ""
+	lower := strings.ToLower(promptText)
+	for _, rule := range m.config.Mock.TypeRules {
+		for _, keyword := range rule.Keywords {
+			if strings.Contains(lower, strings.ToLower(keyword)) {
+				promptType = rule.Type
+				break
+			}
+		}
+		if promptType != "" {
+			break
+		}
+	}
+	switch {
+	case promptType != "":
+	case report.IsSuspicious:
+		promptType = "jailbreak"
+	case m.config.Mock.DefaultType != "":
+		promptType = m.config.Mock.DefaultType
+	default:
+		promptType = "content"
+	}
+
+	return &PromptAnalysis{
+		TokenCount:   report.TokenCount,
+		PromptType:   promptType,
+		ContainsPII:  report.ContainsPII,
+		IsSuspicious: report.IsSuspicious,
+		RiskScore:    report.RiskScore,
+	}
+}
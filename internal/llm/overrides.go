@@ -0,0 +1,61 @@
+package llm
+
+import (
+	"context"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/detect"
+)
+
+// Overrides replace configured settings for the calls made with a context,
+// so shared providers can serve tenants with different models and system
+// prompts. Empty fields keep the configured values.
+type Overrides struct {
+	Tenant       string            // Tenant the calls are made for; calls for different tenants never share a result
+	Models       map[string]string // Model ID by provider identifier
+	SystemPrompt string
+	Detectors    []detect.Detector // Run by the mock provider
+}
+
+// overridesKey stores *Overrides in a context
+type overridesKey struct{}
+
+// WithOverrides returns a context whose provider calls use the overrides. A
+// nil o returns ctx unchanged.
+func WithOverrides(ctx context.Context, o *Overrides) context.Context {
+	if o == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, overridesKey{}, o)
+}
+
+// overridesFrom returns the context's overrides, or an empty set
+func overridesFrom(ctx context.Context) *Overrides {
+	if o, ok := ctx.Value(overridesKey{}).(*Overrides); ok {
+		return o
+	}
+	return &Overrides{}
+}
+
+// ModelFor returns the model the provider uses for calls made with the
+// context
+func ModelFor(ctx context.Context, provider LLM) string {
+	if model := overridesFrom(ctx).Models[ProviderID(provider)]; model != "" {
+		return model
+	}
+	return provider.Model()
+}
+
+// TenantFor returns the tenant whose overrides apply to calls made with the
+// context, or "" for the global settings
+func TenantFor(ctx context.Context) string {
+	return overridesFrom(ctx).Tenant
+}
+
+// SystemPromptFor returns the system prompt for calls made with the context,
+// given the configured one
+func SystemPromptFor(ctx context.Context, configured string) string {
+	if prompt := overridesFrom(ctx).SystemPrompt; prompt != "" {
+		return prompt
+	}
+	return configured
+}
@@ -0,0 +1,119 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/metrics"
+)
+
+// Retry reasons
+const (
+	RetryNetwork     = "network"
+	RetryRateLimit   = "rate-limit"
+	RetryServerError = "server-error"
+)
+
+// Default retry settings
+const (
+	defaultBackoff    = 500 * time.Millisecond
+	defaultMaxBackoff = 10 * time.Second
+)
+
+// doWithRetry sends the request built by newRequest, retrying network
+// errors, rate limits and server errors with exponential backoff up to
+// retry.max_attempts. It returns the status code and body of the final
+// response.
+func doWithRetry(ctx context.Context, client *http.Client, cfg *config.Config, provider string, newRequest func() (*http.Request, error)) (int, []byte, error) {
+	attempts := max(cfg.Retry.MaxAttempts, 1)
+	backoff := cfg.Retry.Backoff
+	if backoff <= 0 {
+		backoff = defaultBackoff
+	}
+	maxBackoff := cfg.Retry.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+
+	for attempt := 1; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return 0, nil, fmt.Errorf("error creating request: %w", err)
+		}
+
+		// Send the request and classify the outcome
+		_, span := tracer.Start(ctx, "llm.http", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("url.full", req.URL.String()),
+			attribute.Int("llm.attempt", attempt),
+		))
+		status, body, wait, reason, err := do(client, req)
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		endSpan(span, err)
+		if reason == "" || attempt >= attempts || ctx.Err() != nil {
+			if errors.Is(err, ErrCassetteMiss) {
+				return 0, nil, fmt.Errorf("%w: %w", ErrRequestFailed, err)
+			}
+			if err != nil {
+				return 0, nil, fmt.Errorf("%w: %v", ErrRequestFailed, err)
+			}
+			return status, body, nil
+		}
+
+		// Wait before the next attempt, honouring Retry-After when given
+		if wait <= 0 {
+			wait = min(backoff<<(attempt-1), maxBackoff)
+		}
+		metrics.ProviderRetries.WithLabelValues(provider, reason).Inc()
+		parent := trace.SpanFromContext(ctx)
+		parent.SetAttributes(attribute.Int("llm.retries", attempt))
+		parent.AddEvent("retry", trace.WithAttributes(
+			attribute.String("llm.retry.reason", reason),
+			attribute.String("llm.retry.wait", wait.String()),
+		))
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return 0, nil, fmt.Errorf("%w: %v", ErrRequestFailed, ctx.Err())
+		}
+	}
+}
+
+// do sends one request and reports why it should be retried, if at all,
+// along with any wait the server asked for
+func do(client *http.Client, req *http.Request) (status int, body []byte, wait time.Duration, reason string, err error) {
+	resp, err := client.Do(req)
+	if errors.Is(err, ErrCassetteMiss) {
+		// A replay miss fails the same way every time
+		return 0, nil, 0, "", err
+	}
+	if err != nil {
+		return 0, nil, 0, RetryNetwork, err
+	}
+	defer resp.Body.Close()
+
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, 0, RetryNetwork, fmt.Errorf("error reading response: %w", err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		reason = RetryRateLimit
+	case resp.StatusCode >= 500:
+		reason = RetryServerError
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		wait = time.Duration(seconds) * time.Second
+	}
+	return resp.StatusCode, body, wait, reason, nil
+}
@@ -0,0 +1,85 @@
+package llm
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/metrics"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/prompt"
+)
+
+// AnalysisSchema is the JSON Schema every provider response is checked against
+//
+//go:embed analysis.schema.json
+var AnalysisSchema []byte
+
+// analysisSchema is the parsed AnalysisSchema
+var analysisSchema = mustParseSchema(AnalysisSchema)
+
+// mustParseSchema parses the embedded schema, which is fixed at build time
+func mustParseSchema(data []byte) *prompt.Schema {
+	s, err := prompt.ParseSchema(data)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// ValidationError reports a provider response that does not match the
+// analysis schema, even after repair
+type ValidationError struct {
+	Problems []string
+}
+
+// Error describes the problems with the response
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrResponseParsing, strings.Join(e.Problems, "; "))
+}
+
+// Unwrap lets errors.Is match ErrResponseParsing
+func (e *ValidationError) Unwrap() error {
+	return ErrResponseParsing
+}
+
+// parseAnalysis extracts the analysis from a provider's reply. The first JSON
+// object in the text is repaired where possible and then validated against
+// the analysis schema; local repairs are counted against the provider.
+func parseAnalysis(provider, text string) (*PromptAnalysis, error) {
+	var doc map[string]any
+	if err := prompt.ParseJSON(text, &doc); err != nil {
+		return nil, &ValidationError{Problems: []string{"the reply is not a JSON object: " + err.Error()}}
+	}
+
+	changes := analysisSchema.Repair(doc)
+	if problems := analysisSchema.Validate(doc); len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+	if len(changes) > 0 {
+		metrics.ResponseRepairs.WithLabelValues(provider, "local").Inc()
+	}
+
+	// The validated document always decodes into the analysis
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrResponseParsing, err)
+	}
+	var analysis PromptAnalysis
+	if err := json.Unmarshal(data, &analysis); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrResponseParsing, err)
+	}
+	return &analysis, nil
+}
+
+// correctionPrompt asks the model to fix a reply that failed validation
+func correctionPrompt(err error) string {
+	problems := []string{err.Error()}
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		problems = verr.Problems
+	}
+	return fmt.Sprintf("Your reply did not match the required format: %s. "+
+		"Reply with only the corrected JSON object, with no other text.", strings.Join(problems, "; "))
+}
@@ -0,0 +1,94 @@
+package llm
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// statusWindow is the number of recent calls used for rolling statistics
+const statusWindow = 100
+
+// Pinger is implemented by providers that can check their API is reachable
+// without running an analysis
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Status summarises a provider's recent health
+type Status struct {
+	LastSuccess    *time.Time `json:"lastSuccess,omitempty"`
+	LastFailure    *time.Time `json:"lastFailure,omitempty"`
+	LastErrorClass string     `json:"lastErrorClass,omitempty"`
+	Calls          int        `json:"calls"`        // Calls in the rolling window
+	ErrorRate      float64    `json:"errorRate"`    // Fraction of calls in the window that failed
+	AvgLatency     int64      `json:"avgLatencyMs"` // Mean latency of successful calls in the window
+}
+
+// callOutcome is one analysis recorded by a statusTracker
+type callOutcome struct {
+	failed  bool
+	latency time.Duration
+}
+
+// statusTracker keeps the outcomes of the most recent calls in a ring
+type statusTracker struct {
+	mu             sync.Mutex
+	outcomes       [statusWindow]callOutcome
+	next           int
+	count          int
+	lastSuccess    time.Time
+	lastFailure    time.Time
+	lastErrorClass string
+}
+
+// record adds the outcome of one call
+func (t *statusTracker) record(latency time.Duration, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.outcomes[t.next] = callOutcome{failed: err != nil, latency: latency}
+	t.next = (t.next + 1) % statusWindow
+	t.count = min(t.count+1, statusWindow)
+
+	if err != nil {
+		t.lastFailure = time.Now().UTC()
+		t.lastErrorClass = ErrorClass(err)
+	} else {
+		t.lastSuccess = time.Now().UTC()
+	}
+}
+
+// snapshot computes the rolling statistics
+func (t *statusTracker) snapshot() Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	status := Status{Calls: t.count, LastErrorClass: t.lastErrorClass}
+	if !t.lastSuccess.IsZero() {
+		last := t.lastSuccess
+		status.LastSuccess = &last
+	}
+	if !t.lastFailure.IsZero() {
+		last := t.lastFailure
+		status.LastFailure = &last
+	}
+
+	failed, succeeded := 0, 0
+	var total time.Duration
+	for _, o := range t.outcomes[:t.count] {
+		if o.failed {
+			failed++
+			continue
+		}
+		succeeded++
+		total += o.latency
+	}
+	if t.count > 0 {
+		status.ErrorRate = float64(failed) / float64(t.count)
+	}
+	if succeeded > 0 {
+		status.AvgLatency = (total / time.Duration(succeeded)).Milliseconds()
+	}
+	return status
+}
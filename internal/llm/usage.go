@@ -0,0 +1,32 @@
+package llm
+
+import "context"
+
+// Usage is the number of tokens a call consumed, as reported by the API
+type Usage struct {
+	InputTokens  int `json:"inputTokens"`
+	OutputTokens int `json:"outputTokens"`
+}
+
+// Total returns the input and output tokens combined
+func (u Usage) Total() int {
+	return u.InputTokens + u.OutputTokens
+}
+
+// usageKey stores a *Usage accumulator in a context
+type usageKey struct{}
+
+// WithUsage returns a context that collects the usage reported by provider
+// calls made with it
+func WithUsage(ctx context.Context) (context.Context, *Usage) {
+	usage := &Usage{}
+	return context.WithValue(ctx, usageKey{}, usage), usage
+}
+
+// addUsage adds token counts to the context's accumulator, if any
+func addUsage(ctx context.Context, input, output int) {
+	if usage, ok := ctx.Value(usageKey{}).(*Usage); ok {
+		usage.InputTokens += input
+		usage.OutputTokens += output
+	}
+}
@@ -0,0 +1,142 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
+)
+
+// Standard field names, kept consistent so logs can be queried in a SIEM
+const (
+	KeyRequestID  = "request_id"
+	KeyClient     = "client"
+	KeyTenant     = "tenant"
+	KeyProvider   = "provider"
+	KeyModel      = "model"
+	KeyLatency    = "latency_ms"
+	KeyDecision   = "decision"
+	KeyErrorClass = "error_class"
+	KeyError      = "error"
+	KeyPrompt     = "prompt"
+)
+
+// maxRequestIDLength bounds caller-supplied request IDs
+const maxRequestIDLength = 128
+
+// requestIDKey stores the request ID in a context
+type requestIDKey struct{}
+
+// clientKey stores the authenticated client and tenant in a context
+type clientKey struct{}
+
+// client is the value stored under clientKey
+type client struct {
+	name   string
+	tenant string
+}
+
+// logPrompts is set from logging.log_prompts
+var logPrompts bool
+
+// Setup installs the default slog logger for the configured level and
+// format. Output from the standard log package is routed through it too.
+func Setup(cfg *config.Config) error {
+	logger, err := New(os.Stderr, cfg)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	logPrompts = cfg.Logging.LogPrompts
+	return nil
+}
+
+// New creates a logger writing to w
+func New(w io.Writer, cfg *config.Config) (*slog.Logger, error) {
+	var level slog.Level
+	if cfg.Logging.Level != "" {
+		if err := level.UnmarshalText([]byte(cfg.Logging.Level)); err != nil {
+			return nil, fmt.Errorf("invalid logging.level %q: %w", cfg.Logging.Level, err)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	switch strings.ToLower(cfg.Logging.Format) {
+	case "", "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid logging.format %q: must be json or text", cfg.Logging.Format)
+	}
+}
+
+// NewRequestID returns the caller's request ID if it is usable, or a new
+// random one
+func NewRequestID(header string) string {
+	if header != "" && len(header) <= maxRequestIDLength && printable(header) {
+		return header
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// printable reports whether s contains only printable ASCII, so request IDs
+// cannot inject control characters into logs or headers
+func printable(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x21 || s[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// WithRequestID returns a context carrying the request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID from the context, if any
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// WithClient returns a context carrying the authenticated client name and
+// tenant. The tenant may be empty.
+func WithClient(ctx context.Context, name, tenant string) context.Context {
+	return context.WithValue(ctx, clientKey{}, client{name: name, tenant: tenant})
+}
+
+// FromContext returns the default logger with the request ID, client and
+// tenant attached
+func FromContext(ctx context.Context) *slog.Logger {
+	logger := slog.Default()
+	if id := RequestID(ctx); id != "" {
+		logger = logger.With(KeyRequestID, id)
+	}
+	if c, ok := ctx.Value(clientKey{}).(client); ok {
+		logger = logger.With(KeyClient, c.name)
+		if c.tenant != "" {
+			logger = logger.With(KeyTenant, c.tenant)
+		}
+	}
+	return logger
+}
+
+// Prompt returns the prompt as a log attribute when logging.log_prompts is
+// enabled, and an empty attribute, which handlers drop, otherwise
+func Prompt(text string) slog.Attr {
+	if !logPrompts {
+		return slog.Attr{}
+	}
+	return slog.String(KeyPrompt, text)
+}
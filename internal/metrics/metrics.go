@@ -0,0 +1,185 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes every metric name
+const namespace = "prompt_analysis"
+
+// registry holds the application metrics along with the Go runtime and
+// process collectors
+var registry = prometheus.NewRegistry()
+
+// Application metrics
+var (
+	// HTTPRequests counts handled requests by route pattern, provider and
+	// status code
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests handled, by route, provider and status code.",
+	}, []string{"route", "provider", "status"})
+
+	// ProviderLatency observes the duration of provider analyses, including
+	// retries, by outcome (ok or error)
+	ProviderLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "provider_request_duration_seconds",
+		Help:      "Duration of provider analyses in seconds, by provider, model and outcome.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2, 4, 8, 15, 30, 60},
+	}, []string{"provider", "model", "outcome"})
+
+	// ParseFailures counts provider responses that could not be parsed into
+	// an analysis
+	ParseFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "provider_parse_failures_total",
+		Help:      "Provider responses that could not be parsed, by provider.",
+	}, []string{"provider"})
+
+	// ResponseRepairs counts provider responses that failed the analysis
+	// schema but were fixed, by method (local repair or reprompt)
+	ResponseRepairs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "provider_response_repairs_total",
+		Help:      "Provider responses fixed to match the analysis schema, by provider and method.",
+	}, []string{"provider", "method"})
+
+	// ProviderRetries counts retried provider requests by the reason for the
+	// retry (network, rate-limit or server-error)
+	ProviderRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "provider_retries_total",
+		Help:      "Provider requests retried, by provider and reason.",
+	}, []string{"provider", "reason"})
+
+	// Tokens counts tokens reported by provider usage blocks, by direction
+	// (input or output)
+	Tokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "provider_tokens_total",
+		Help:      "Tokens used by provider calls, by provider, model and direction.",
+	}, []string{"provider", "model", "direction"})
+
+	// RiskScores observes the risk score of each successful analysis
+	RiskScores = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "risk_score",
+		Help:      "Risk scores returned by analyses, by provider.",
+		Buckets:   prometheus.LinearBuckets(1, 1, 10),
+	}, []string{"provider"})
+
+	// PromptFlags counts analyses flagged as containing PII or as suspicious
+	PromptFlags = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "prompt_flags_total",
+		Help:      "Analyses flagged as containing PII or as suspicious, by provider and flag.",
+	}, []string{"provider", "flag"})
+
+	// PolicyDecisions counts policy outcomes. Blocked analyses are counted
+	// once per violated rule; allowed analyses use the rule "none".
+	PolicyDecisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "policy_decisions_total",
+		Help:      "Policy decisions, by action and violated rule.",
+	}, []string{"action", "rule"})
+
+	// QuotaWait observes how long provider calls queued for quota
+	QuotaWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "provider_quota_wait_seconds",
+		Help:      "Time provider calls queued for the provider quota, by provider.",
+		Buckets:   []float64{0, 0.1, 0.5, 1, 2, 5, 10, 30, 60},
+	}, []string{"provider"})
+
+	// QuotaShed counts provider calls rejected because the quota could not
+	// admit them within max_wait, by the exhausted limit (requests or tokens)
+	QuotaShed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "provider_quota_shed_total",
+		Help:      "Provider calls shed by the quota governor, by provider and limit.",
+	}, []string{"provider", "limit"})
+
+	// ClientTokens counts tokens used on behalf of each client and tenant,
+	// by direction (input or output)
+	ClientTokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "client_tokens_total",
+		Help:      "Tokens used for analyses, by client, tenant and direction.",
+	}, []string{"client", "tenant", "direction"})
+
+	// CostUSD sums the priced cost of provider calls. Models without an
+	// entry in the pricing table add nothing.
+	CostUSD = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cost_usd_total",
+		Help:      "Cost of provider calls in USD, by client, tenant, provider and model.",
+	}, []string{"client", "tenant", "provider", "model"})
+
+	// BudgetBreaches counts requests made past a budget threshold, by period
+	// (day or month) and threshold (soft or hard). Hard breaches are rejected.
+	BudgetBreaches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "budget_breaches_total",
+		Help:      "Requests past a spending budget threshold, by client, tenant, period and threshold.",
+	}, []string{"client", "tenant", "period", "threshold"})
+
+	// CacheLookups counts analysis cache lookups by result (hit, similar,
+	// miss or bypass)
+	CacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_lookups_total",
+		Help:      "Analysis cache lookups, by provider and result.",
+	}, []string{"provider", "result"})
+
+	// CoalescedCalls counts analyses that shared a concurrent identical
+	// provider call instead of making their own
+	CoalescedCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "coalesced_calls_total",
+		Help:      "Provider calls saved by sharing a concurrent identical analysis, by provider.",
+	}, []string{"provider"})
+
+	// RateLimited counts requests rejected by the client rate limiter, by
+	// reason (rate or concurrency)
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Requests rejected by client rate limits, by route and reason.",
+	}, []string{"route", "reason"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		ProviderLatency,
+		ParseFailures,
+		ResponseRepairs,
+		ProviderRetries,
+		Tokens,
+		RiskScores,
+		PromptFlags,
+		PolicyDecisions,
+		RateLimited,
+		QuotaWait,
+		QuotaShed,
+		ClientTokens,
+		CostUSD,
+		BudgetBreaches,
+		CacheLookups,
+		CoalescedCalls,
+	)
+}
+
+// Handler returns the HTTP handler serving the metrics in the Prometheus
+// exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
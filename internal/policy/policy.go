@@ -0,0 +1,85 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/llm"
+)
+
+// Policy actions
+const (
+	ActionAllow = "allow"
+	ActionBlock = "block"
+)
+
+// Violation rules
+const (
+	RuleRiskScore   = "risk-score"
+	RulePII         = "pii"
+	RuleSuspicious  = "suspicious"
+	RuleBlockedType = "blocked-type"
+)
+
+// Violation is a single policy rule broken by an analysis
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Decision is the outcome of evaluating an analysis against the policy
+type Decision struct {
+	Action     string      `json:"action"`
+	Violations []Violation `json:"violations,omitempty"`
+}
+
+// Policy decides whether an analyzed prompt is acceptable
+type Policy struct {
+	MaxRiskScore    int
+	BlockPII        bool
+	BlockSuspicious bool
+	BlockedTypes    []string
+}
+
+// New creates the policy from configuration
+func New(cfg *config.Config) *Policy {
+	return &Policy{
+		MaxRiskScore:    cfg.Policy.MaxRiskScore,
+		BlockPII:        cfg.Policy.BlockPII,
+		BlockSuspicious: cfg.Policy.BlockSuspicious,
+		BlockedTypes:    cfg.Policy.BlockedTypes,
+	}
+}
+
+// Evaluate checks an analysis against every rule and blocks it if any fail
+func (p *Policy) Evaluate(analysis *llm.PromptAnalysis) Decision {
+	var violations []Violation
+
+	if p.MaxRiskScore > 0 && analysis.RiskScore > p.MaxRiskScore {
+		violations = append(violations, Violation{
+			Rule:    RuleRiskScore,
+			Message: fmt.Sprintf("risk score %d exceeds the maximum of %d", analysis.RiskScore, p.MaxRiskScore),
+		})
+	}
+	if p.BlockPII && analysis.ContainsPII {
+		violations = append(violations, Violation{Rule: RulePII, Message: "prompt contains PII"})
+	}
+	if p.BlockSuspicious && analysis.IsSuspicious {
+		violations = append(violations, Violation{Rule: RuleSuspicious, Message: "prompt appears to be a jailbreak attempt"})
+	}
+	for _, blocked := range p.BlockedTypes {
+		if strings.EqualFold(analysis.PromptType, blocked) {
+			violations = append(violations, Violation{
+				Rule:    RuleBlockedType,
+				Message: fmt.Sprintf("prompt type %q is not allowed", analysis.PromptType),
+			})
+			break
+		}
+	}
+
+	if len(violations) > 0 {
+		return Decision{Action: ActionBlock, Violations: violations}
+	}
+	return Decision{Action: ActionAllow}
+}
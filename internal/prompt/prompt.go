@@ -3,13 +3,13 @@ package prompt
 import (
 	"encoding/json"
 	"errors"
-	"regexp"
 	"strings"
 )
 
 // Request represents the incoming prompt analysis request
 type Request struct {
 	Prompt string `json:"prompt"`
+	User   string `json:"user,omitempty"` // Optional data subject ID used for retention and deletion
 }
 
 // Validate validates a prompt request
@@ -20,13 +20,21 @@ func (r *Request) Validate() error {
 	return nil
 }
 
-// ExtractJSON attempts to extract valid JSON from text that might contain additional content
+// ExtractJSON attempts to extract valid JSON from text that might contain additional content.
+// It returns the first complete JSON object in the text, so code fences, leading prose and
+// trailing text are dropped, and falls back to the text itself.
 func ExtractJSON(text string) string {
-	// Look for JSON between curly braces
-	re := regexp.MustCompile(`\{.*\}`)
-	match := re.FindString(text)
-	if match != "" {
-		return match
+	for start := strings.IndexByte(text, '{'); start >= 0; {
+		var obj json.RawMessage
+		dec := json.NewDecoder(strings.NewReader(text[start:]))
+		if err := dec.Decode(&obj); err == nil && len(obj) > 0 && obj[0] == '{' {
+			return string(obj)
+		}
+		next := strings.IndexByte(text[start+1:], '{')
+		if next < 0 {
+			break
+		}
+		start += next + 1
 	}
 	return text
 }
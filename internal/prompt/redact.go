@@ -0,0 +1,61 @@
+package prompt
+
+import (
+	"regexp"
+	"sort"
+)
+
+// piiPattern pairs a PII category with the expression that detects it
+type piiPattern struct {
+	Kind    string
+	Pattern *regexp.Regexp
+}
+
+// piiPatterns lists the PII categories recognised by Redact, most specific first
+var piiPatterns = []piiPattern{
+	{Kind: "EMAIL", Pattern: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)},
+	{Kind: "CREDIT_CARD", Pattern: regexp.MustCompile(`\b(?:\d[ \-]?){13,16}\b`)},
+	{Kind: "SSN", Pattern: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`)},
+	{Kind: "PHONE", Pattern: regexp.MustCompile(`(?:\+\d{1,3}[ .\-]?)?\(?\b\d{3}\)?[ .\-]?\d{3}[ .\-]?\d{4}\b`)},
+	{Kind: "IP_ADDRESS", Pattern: regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)},
+}
+
+// PIIMatch is a recognised piece of PII within a text
+type PIIMatch struct {
+	Kind  string // PII category, e.g. EMAIL or PHONE
+	Start int    // Byte offset of the match
+	End   int    // Byte offset just past the match
+}
+
+// FindPII returns every recognised piece of PII in text, ordered by position.
+// Overlapping matches from less specific categories are dropped.
+func FindPII(text string) []PIIMatch {
+	var matches []PIIMatch
+	for _, p := range piiPatterns {
+		for _, loc := range p.Pattern.FindAllStringIndex(text, -1) {
+			if !overlaps(matches, loc[0], loc[1]) {
+				matches = append(matches, PIIMatch{Kind: p.Kind, Start: loc[0], End: loc[1]})
+			}
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Start < matches[j].Start })
+	return matches
+}
+
+// overlaps reports whether [start, end) intersects any existing match
+func overlaps(matches []PIIMatch, start, end int) bool {
+	for _, m := range matches {
+		if start < m.End && m.Start < end {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact replaces recognised PII in text with placeholders such as [EMAIL]
+func Redact(text string) string {
+	for _, p := range piiPatterns {
+		text = p.Pattern.ReplaceAllString(text, "["+p.Kind+"]")
+	}
+	return text
+}
@@ -0,0 +1,191 @@
+package prompt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Schema is the subset of JSON Schema used to check model output: an object
+// whose properties are integers, numbers, strings or booleans, with required,
+// additionalProperties, enum, minimum and maximum
+type Schema struct {
+	SchemaURI            string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 string             `json:"type"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+}
+
+// ParseSchema parses a JSON Schema document, rejecting keywords outside the
+// supported subset
+func ParseSchema(data []byte) (*Schema, error) {
+	var s Schema
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&s); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	if s.Type != "object" {
+		return nil, fmt.Errorf("invalid schema: type must be object, not %q", s.Type)
+	}
+	for name, p := range s.Properties {
+		switch p.Type {
+		case "integer", "number", "string", "boolean":
+		default:
+			return nil, fmt.Errorf("invalid schema: property %s has unsupported type %q", name, p.Type)
+		}
+	}
+	return &s, nil
+}
+
+// Validate returns a description of each way the document breaks the schema
+func (s *Schema) Validate(doc map[string]any) []string {
+	var problems []string
+	for _, name := range s.Required {
+		if _, ok := doc[name]; !ok {
+			problems = append(problems, fmt.Sprintf("%s is required", name))
+		}
+	}
+
+	for _, name := range sortedKeys(doc) {
+		p, ok := s.Properties[name]
+		if !ok {
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				problems = append(problems, fmt.Sprintf("%s is not allowed", name))
+			}
+			continue
+		}
+		if problem := p.check(doc[name]); problem != "" {
+			problems = append(problems, fmt.Sprintf("%s %s", name, problem))
+		}
+	}
+	return problems
+}
+
+// check returns how a property value breaks the property schema, or ""
+func (p *Schema) check(v any) string {
+	switch p.Type {
+	case "integer", "number":
+		n, ok := v.(float64)
+		if !ok {
+			return "must be a " + p.Type
+		}
+		if p.Type == "integer" && n != math.Trunc(n) {
+			return "must be an integer"
+		}
+		if p.Minimum != nil && n < *p.Minimum {
+			return fmt.Sprintf("must be at least %g", *p.Minimum)
+		}
+		if p.Maximum != nil && n > *p.Maximum {
+			return fmt.Sprintf("must be at most %g", *p.Maximum)
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return "must be a string"
+		}
+		if len(p.Enum) > 0 && !slices.Contains(p.Enum, str) {
+			return "must be one of " + strings.Join(p.Enum, ", ")
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return "must be a boolean"
+		}
+	}
+	return ""
+}
+
+// Repair fixes the mistakes models commonly make in place and returns a
+// description of each change. Numbers given as strings are converted and
+// clamped to their range, non-integers are rounded, "true" and "false" become
+// booleans, enum values are matched ignoring case and surrounding space, and
+// properties the schema does not allow are dropped. Anything else is left for
+// Validate to report.
+func (s *Schema) Repair(doc map[string]any) []string {
+	var changes []string
+	for _, name := range sortedKeys(doc) {
+		p, ok := s.Properties[name]
+		if !ok {
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				delete(doc, name)
+				changes = append(changes, fmt.Sprintf("dropped %s", name))
+			}
+			continue
+		}
+		if fixed, ok := p.repair(doc[name]); ok {
+			changes = append(changes, fmt.Sprintf("%s: %v -> %v", name, doc[name], fixed))
+			doc[name] = fixed
+		}
+	}
+	return changes
+}
+
+// repair returns the corrected property value, if it can be corrected
+func (p *Schema) repair(v any) (any, bool) {
+	switch p.Type {
+	case "integer", "number":
+		n, ok := v.(float64)
+		if str, isString := v.(string); isString {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+			if err != nil {
+				return nil, false
+			}
+			n, ok = parsed, true
+		}
+		if !ok || math.IsNaN(n) || math.IsInf(n, 0) {
+			return nil, false
+		}
+		fixed := n
+		if p.Type == "integer" {
+			fixed = math.Round(fixed)
+		}
+		if p.Minimum != nil {
+			fixed = math.Max(fixed, *p.Minimum)
+		}
+		if p.Maximum != nil {
+			fixed = math.Min(fixed, *p.Maximum)
+		}
+		if _, isString := v.(string); !isString && fixed == n {
+			return nil, false
+		}
+		return fixed, true
+	case "string":
+		str, ok := v.(string)
+		if !ok || len(p.Enum) == 0 || slices.Contains(p.Enum, str) {
+			return nil, false
+		}
+		for _, value := range p.Enum {
+			if strings.EqualFold(strings.TrimSpace(str), value) {
+				return value, true
+			}
+		}
+	case "boolean":
+		if str, ok := v.(string); ok {
+			if b, err := strconv.ParseBool(strings.TrimSpace(str)); err == nil {
+				return b, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// sortedKeys returns the document's keys in order, so problems and changes
+// are reported deterministically
+func sortedKeys(doc map[string]any) []string {
+	keys := make([]string, 0, len(doc))
+	for k := range doc {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,188 @@
+package prompt
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testSchema mirrors the analysis schema the providers are checked against
+const testSchema = `{
+  "type": "object",
+  "properties": {
+    "tokenCount": {"type": "integer", "minimum": 0},
+    "promptType": {"type": "string", "enum": ["coding", "research", "content", "jailbreak"]},
+    "containsPII": {"type": "boolean"},
+    "riskScore": {"type": "integer", "minimum": 1, "maximum": 10}
+  },
+  "required": ["tokenCount", "promptType", "containsPII", "riskScore"],
+  "additionalProperties": false
+}`
+
+func mustSchema(t *testing.T) *Schema {
+	t.Helper()
+	s, err := ParseSchema([]byte(testSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestExtractJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"plain", `{"a":1}`, `{"a":1}`},
+		{"fenced", "```json\n{\"a\":1}\n```", `{"a":1}`},
+		{"prose", "Here is the analysis: {\"a\":{\"b\":2}} Hope this helps.", `{"a":{"b":2}}`},
+		{"stray brace", "Use {braces} like this: {\"a\":1}", `{"a":1}`},
+		{"first of two", `{"a":1} {"a":2}`, `{"a":1}`},
+		{"no object", "no JSON here", "no JSON here"},
+		{"truncated", `{"a":`, `{"a":`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExtractJSON(tt.text); got != tt.want {
+				t.Errorf("ExtractJSON(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepair(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     map[string]any
+		want    map[string]any
+		changed int
+	}{
+		{
+			name: "valid",
+			doc:  map[string]any{"tokenCount": 5.0, "promptType": "coding", "containsPII": false, "riskScore": 2.0},
+			want: map[string]any{"tokenCount": 5.0, "promptType": "coding", "containsPII": false, "riskScore": 2.0},
+		},
+		{
+			name:    "wrong-case enum",
+			doc:     map[string]any{"promptType": " Coding "},
+			want:    map[string]any{"promptType": "coding"},
+			changed: 1,
+		},
+		{
+			name: "unknown enum",
+			doc:  map[string]any{"promptType": "banana"},
+			want: map[string]any{"promptType": "banana"},
+		},
+		{
+			name:    "string numbers and booleans",
+			doc:     map[string]any{"tokenCount": "12", "containsPII": "true", "riskScore": " 7 "},
+			want:    map[string]any{"tokenCount": 12.0, "containsPII": true, "riskScore": 7.0},
+			changed: 3,
+		},
+		{
+			name:    "out of range and fractional",
+			doc:     map[string]any{"tokenCount": -3.0, "riskScore": 6.6},
+			want:    map[string]any{"tokenCount": 0.0, "riskScore": 7.0},
+			changed: 2,
+		},
+		{
+			name:    "extra property",
+			doc:     map[string]any{"riskScore": 3.0, "reason": "benign"},
+			want:    map[string]any{"riskScore": 3.0},
+			changed: 1,
+		},
+		{
+			name: "unparseable",
+			doc:  map[string]any{"riskScore": "high", "containsPII": "maybe"},
+			want: map[string]any{"riskScore": "high", "containsPII": "maybe"},
+		},
+	}
+	s := mustSchema(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := s.Repair(tt.doc)
+			if len(changes) != tt.changed {
+				t.Errorf("changes = %q, want %d", changes, tt.changed)
+			}
+			if !reflect.DeepEqual(tt.doc, tt.want) {
+				t.Errorf("doc = %v, want %v", tt.doc, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  map[string]any
+		want []string
+	}{
+		{
+			name: "valid",
+			doc:  map[string]any{"tokenCount": 5.0, "promptType": "coding", "containsPII": false, "riskScore": 2.0},
+		},
+		{
+			name: "missing required field",
+			doc:  map[string]any{"tokenCount": 5.0, "promptType": "coding", "containsPII": false},
+			want: []string{"riskScore is required"},
+		},
+		{
+			name: "wrong-case enum",
+			doc:  map[string]any{"tokenCount": 5.0, "promptType": "Coding", "containsPII": false, "riskScore": 2.0},
+			want: []string{"promptType must be one of coding, research, content, jailbreak"},
+		},
+		{
+			name: "wrong types and ranges",
+			doc:  map[string]any{"tokenCount": 1.5, "promptType": 3.0, "containsPII": "no", "riskScore": 11.0},
+			want: []string{
+				"containsPII must be a boolean",
+				"promptType must be a string",
+				"riskScore must be at most 10",
+				"tokenCount must be an integer",
+			},
+		},
+		{
+			name: "extra property",
+			doc:  map[string]any{"tokenCount": 5.0, "promptType": "content", "containsPII": true, "riskScore": 1.0, "reason": "x"},
+			want: []string{"reason is not allowed"},
+		},
+	}
+	s := mustSchema(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.Validate(tt.doc); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepairThenValidate(t *testing.T) {
+	// A fenced reply with a wrong-case enum and a string score is accepted
+	// after repair
+	var doc map[string]any
+	reply := "```json\n{\"tokenCount\": 4, \"promptType\": \"RESEARCH\", \"containsPII\": false, \"riskScore\": \"3\"}\n```"
+	if err := ParseJSON(reply, &doc); err != nil {
+		t.Fatal(err)
+	}
+	s := mustSchema(t)
+	s.Repair(doc)
+	if problems := s.Validate(doc); len(problems) > 0 {
+		t.Fatalf("problems after repair: %q", problems)
+	}
+	if doc["promptType"] != "research" || doc["riskScore"] != 3.0 {
+		t.Errorf("doc = %v", doc)
+	}
+}
+
+func TestParseSchemaRejectsUnsupported(t *testing.T) {
+	for _, data := range []string{
+		`{"type": "array"}`,
+		`{"type": "object", "properties": {"a": {"type": "array"}}}`,
+		`{"type": "object", "properties": {"a": {"type": "string", "pattern": "x"}}}`,
+	} {
+		if _, err := ParseSchema([]byte(data)); err == nil {
+			t.Errorf("ParseSchema(%s) succeeded", data)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/auth"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
+)
+
+// Reasons a request is rejected
+const (
+	ReasonRate        = "rate"
+	ReasonConcurrency = "concurrency"
+)
+
+// Idle buckets are dropped after idleTTL, checked every sweepInterval
+const (
+	idleTTL       = 10 * time.Minute
+	sweepInterval = time.Minute
+)
+
+// Decision is the outcome of Acquire, with the values for the rate limit
+// response headers
+type Decision struct {
+	Allowed    bool
+	Reason     string        // Why the request was rejected
+	Limit      int           // Bucket capacity; 0 when there is no rate limit
+	Remaining  int           // Requests left in the bucket
+	Reset      time.Duration // Time until the bucket is full again
+	RetryAfter time.Duration // Time until the next request is allowed
+}
+
+// bucket is a token bucket and in-flight counter for one key
+type bucket struct {
+	limits   config.RateLimit
+	tokens   float64
+	updated  time.Time
+	inFlight int
+}
+
+// Limiter enforces per-client request rates and concurrency
+type Limiter struct {
+	cfg *config.Config
+	now func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+// New creates a limiter from the rate_limits settings. It returns nil when
+// rate limiting is disabled.
+func New(cfg *config.Config) *Limiter {
+	if !cfg.RateLimits.Enabled {
+		return nil
+	}
+	return &Limiter{
+		cfg:     cfg,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+		swept:   time.Now(),
+	}
+}
+
+// Resolve returns the bucket key and limits for a request. A matching client
+// override gives the client its own limits, and a tenant override shares one
+// budget among the tenant's clients. Otherwise each client, or each IP
+// address for unauthenticated requests, gets the default limits.
+func (l *Limiter) Resolve(r *http.Request) (string, config.RateLimit) {
+	id := auth.FromContext(r.Context())
+	if id != nil {
+		for _, o := range l.cfg.RateLimits.Overrides {
+			if o.Client != "" && o.Client == id.Client {
+				return "client:" + id.Client, o.RateLimit
+			}
+		}
+		for _, o := range l.cfg.RateLimits.Overrides {
+			if o.Tenant != "" && o.Tenant == id.Tenant {
+				return "tenant:" + id.Tenant, o.RateLimit
+			}
+		}
+		return "client:" + id.Client, l.cfg.RateLimits.Default
+	}
+	return "ip:" + l.clientIP(r), l.cfg.RateLimits.Default
+}
+
+// ResolveIP returns the bucket key and per-IP limits for the caller's
+// address. It is used before authentication, so callers that fail to
+// authenticate are limited too.
+func (l *Limiter) ResolveIP(r *http.Request) (string, config.RateLimit) {
+	return "ip:" + l.clientIP(r), l.cfg.RateLimits.PerIP
+}
+
+// clientIP returns the address of the caller, taken from X-Forwarded-For
+// when the server runs behind a trusted proxy
+func (l *Limiter) clientIP(r *http.Request) string {
+	if l.cfg.RateLimits.TrustForwardedFor {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Acquire takes a token from the key's bucket and an in-flight slot. When
+// the request is allowed, release must be called once it completes.
+func (l *Limiter) Acquire(key string, limits config.RateLimit) (d Decision, release func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limits: limits, tokens: float64(burst(limits)), updated: now}
+		l.buckets[key] = b
+	}
+	b.refill(now)
+
+	// Apply the key's current limits, which change when a client starts
+	// matching an override or the per-IP and default limits differ
+	b.limits = limits
+	b.tokens = math.Min(b.tokens, float64(burst(limits)))
+
+	// Check concurrency first so a rejected request does not spend a token
+	d = Decision{Allowed: true}
+	if limits.MaxInFlight > 0 && b.inFlight >= limits.MaxInFlight {
+		d.Allowed = false
+		d.Reason = ReasonConcurrency
+		d.RetryAfter = time.Second
+	}
+	if limits.RequestsPerMinute > 0 {
+		d.Limit = burst(limits)
+		if d.Allowed && b.tokens < 1 {
+			d.Allowed = false
+			d.Reason = ReasonRate
+			d.RetryAfter = b.wait(1 - b.tokens)
+		}
+		if d.Allowed {
+			b.tokens--
+		}
+		d.Remaining = int(b.tokens)
+		d.Reset = b.wait(float64(d.Limit) - b.tokens)
+	}
+	if !d.Allowed {
+		return d, nil
+	}
+
+	b.inFlight++
+	return d, func() {
+		l.mu.Lock()
+		b.inFlight--
+		l.mu.Unlock()
+	}
+}
+
+// sweep drops buckets that have been idle and full for a while; the caller
+// holds l.mu
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < sweepInterval {
+		return
+	}
+	l.swept = now
+	for key, b := range l.buckets {
+		if b.inFlight == 0 && now.Sub(b.updated) > idleTTL {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// refill adds the tokens earned since the last update
+func (b *bucket) refill(now time.Time) {
+	if b.limits.RequestsPerMinute > 0 {
+		earned := now.Sub(b.updated).Minutes() * b.limits.RequestsPerMinute
+		b.tokens = math.Min(b.tokens+earned, float64(burst(b.limits)))
+	}
+	b.updated = now
+}
+
+// wait returns how long it takes to earn the given number of tokens,
+// rounded up to whole seconds for the response headers
+func (b *bucket) wait(tokens float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	seconds := math.Ceil(tokens / b.limits.RequestsPerMinute * 60)
+	return time.Duration(seconds) * time.Second
+}
+
+// burst returns the bucket capacity, which defaults to one request
+func burst(limits config.RateLimit) int {
+	return max(limits.Burst, 1)
+}
@@ -0,0 +1,106 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
+)
+
+// newTestLimiter returns a limiter whose clock only moves when the returned
+// function is called
+func newTestLimiter() (*Limiter, func(time.Duration)) {
+	cfg := &config.Config{}
+	cfg.RateLimits.Enabled = true
+	l := New(cfg)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	l.swept = now
+	return l, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestBurstThenRefill(t *testing.T) {
+	l, advance := newTestLimiter()
+	limits := config.RateLimit{RequestsPerMinute: 60, Burst: 3}
+
+	for i := range 3 {
+		d, release := l.Acquire("client:a", limits)
+		if !d.Allowed {
+			t.Fatalf("request %d rejected within the burst", i+1)
+		}
+		release()
+	}
+	d, _ := l.Acquire("client:a", limits)
+	if d.Allowed || d.Reason != ReasonRate || d.RetryAfter != time.Second {
+		t.Fatalf("decision after the burst = %+v, want a rate rejection retrying in 1s", d)
+	}
+
+	// One request a second is earned back, up to the burst
+	advance(time.Second)
+	if d, _ := l.Acquire("client:a", limits); !d.Allowed {
+		t.Errorf("request after refill rejected: %+v", d)
+	}
+	advance(time.Hour)
+	if d, _ := l.Acquire("client:a", limits); !d.Allowed || d.Remaining != 2 || d.Limit != 3 {
+		t.Errorf("decision after a long idle = %+v, want the bucket capped at the burst", d)
+	}
+}
+
+func TestMaxInFlightRelease(t *testing.T) {
+	l, _ := newTestLimiter()
+	limits := config.RateLimit{MaxInFlight: 1}
+
+	d, release := l.Acquire("client:a", limits)
+	if !d.Allowed {
+		t.Fatalf("first request rejected: %+v", d)
+	}
+	if d, _ := l.Acquire("client:a", limits); d.Allowed || d.Reason != ReasonConcurrency {
+		t.Errorf("second concurrent request = %+v, want a concurrency rejection", d)
+	}
+	if d, _ := l.Acquire("client:b", limits); !d.Allowed {
+		t.Errorf("another client's request rejected: %+v", d)
+	}
+
+	release()
+	if d, _ := l.Acquire("client:a", limits); !d.Allowed {
+		t.Errorf("request after release rejected: %+v", d)
+	}
+}
+
+func TestAcquireAppliesCurrentLimits(t *testing.T) {
+	l, _ := newTestLimiter()
+
+	d, release := l.Acquire("client:a", config.RateLimit{MaxInFlight: 1})
+	if !d.Allowed {
+		t.Fatalf("first request rejected: %+v", d)
+	}
+
+	// The key's limits were raised since its bucket was created
+	if d, _ := l.Acquire("client:a", config.RateLimit{MaxInFlight: 2}); !d.Allowed {
+		t.Errorf("request under the raised limit rejected: %+v", d)
+	}
+	release()
+	if got := l.buckets["client:a"].limits.MaxInFlight; got != 2 {
+		t.Errorf("bucket MaxInFlight = %d, want 2", got)
+	}
+}
+
+func TestSweepDropsIdleBuckets(t *testing.T) {
+	l, advance := newTestLimiter()
+	limits := config.RateLimit{RequestsPerMinute: 60, Burst: 1}
+
+	_, release := l.Acquire("client:idle", limits)
+	release()
+	_, hold := l.Acquire("client:busy", limits)
+	defer hold()
+
+	advance(idleTTL + sweepInterval)
+	l.Acquire("client:new", limits)
+
+	if _, ok := l.buckets["client:idle"]; ok {
+		t.Error("idle bucket was not swept")
+	}
+	if _, ok := l.buckets["client:busy"]; !ok {
+		t.Error("bucket with a request in flight was swept")
+	}
+}
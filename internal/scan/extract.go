@@ -0,0 +1,160 @@
+package scan
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Prompt is a prompt found in a file
+type Prompt struct {
+	File   string // Path relative to the scanned directory, slash-separated
+	Line   int    // 1-based line where the prompt text starts
+	Source string // Where the prompt came from, e.g. "yaml:analysis.system_prompt"
+	Text   string
+}
+
+// extractor pulls prompts out of file contents
+type extractor struct {
+	yamlKeys      map[string]bool
+	goIdentifiers *regexp.Regexp
+}
+
+// newExtractor creates an extractor for the configured YAML keys and Go
+// identifier pattern
+func newExtractor(yamlKeys []string, goIdentifiers string) (*extractor, error) {
+	e := &extractor{yamlKeys: make(map[string]bool)}
+	for _, key := range yamlKeys {
+		e.yamlKeys[key] = true
+	}
+
+	if goIdentifiers != "" {
+		re, err := regexp.Compile(goIdentifiers)
+		if err != nil {
+			return nil, fmt.Errorf("invalid go_identifiers pattern: %w", err)
+		}
+		e.goIdentifiers = re
+	}
+
+	return e, nil
+}
+
+// extract returns the prompts in a file, choosing the strategy by extension
+func (e *extractor) extract(file string, data []byte) ([]Prompt, error) {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		return e.extractYAML(file, data)
+	case ".go":
+		return e.extractGo(file, data)
+	default:
+		// Plain text, markdown and templates are a single prompt
+		if len(bytes.TrimSpace(data)) == 0 {
+			return nil, nil
+		}
+		return []Prompt{{File: file, Line: 1, Source: "file", Text: string(data)}}, nil
+	}
+}
+
+// extractYAML returns the string values of configured keys in every document
+func (e *extractor) extractYAML(file string, data []byte) ([]Prompt, error) {
+	var prompts []Prompt
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return prompts, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid YAML: %w", file, err)
+		}
+		prompts = e.walkYAML(file, &doc, "", prompts)
+	}
+}
+
+// walkYAML collects matching scalar values below a node
+func (e *extractor) walkYAML(file string, node *yaml.Node, keyPath string, prompts []Prompt) []Prompt {
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range node.Content {
+			prompts = e.walkYAML(file, child, keyPath, prompts)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			childPath := key.Value
+			if keyPath != "" {
+				childPath = keyPath + "." + key.Value
+			}
+
+			if e.yamlKeys[key.Value] && value.Kind == yaml.ScalarNode && value.Tag == "!!str" {
+				// Block scalars start on the line after the indicator
+				line := value.Line
+				if value.Style == yaml.LiteralStyle || value.Style == yaml.FoldedStyle {
+					line++
+				}
+				prompts = append(prompts, Prompt{File: file, Line: line, Source: "yaml:" + childPath, Text: value.Value})
+				continue
+			}
+			prompts = e.walkYAML(file, value, childPath, prompts)
+		}
+	}
+	return prompts
+}
+
+// extractGo returns string literals assigned to matching const and var names
+func (e *extractor) extractGo(file string, data []byte) ([]Prompt, error) {
+	if e.goIdentifiers == nil {
+		return nil, nil
+	}
+
+	fset := token.NewFileSet()
+	parsed, err := parser.ParseFile(fset, file, data, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid Go source: %w", file, err)
+	}
+
+	var prompts []Prompt
+	for _, decl := range parsed.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || (gen.Tok != token.CONST && gen.Tok != token.VAR) {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			value, ok := spec.(*ast.ValueSpec)
+			if !ok {
+				continue
+			}
+			for i, name := range value.Names {
+				if i >= len(value.Values) || !e.goIdentifiers.MatchString(name.Name) {
+					continue
+				}
+				lit, ok := value.Values[i].(*ast.BasicLit)
+				if !ok || lit.Kind != token.STRING {
+					continue
+				}
+				text, err := strconv.Unquote(lit.Value)
+				if err != nil {
+					continue
+				}
+				prompts = append(prompts, Prompt{
+					File:   file,
+					Line:   fset.Position(lit.Pos()).Line,
+					Source: fmt.Sprintf("go:%s %s", gen.Tok, name.Name),
+					Text:   text,
+				})
+			}
+		}
+	}
+	return prompts, nil
+}
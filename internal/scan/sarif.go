@@ -0,0 +1,106 @@
+package scan
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/policy"
+)
+
+// sarifSchema is the SARIF 2.1.0 schema URI
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+// ruleDescriptions documents each policy rule in SARIF output
+var ruleDescriptions = map[string]string{
+	policy.RuleRiskScore:   "Prompt risk score exceeds the configured maximum",
+	policy.RulePII:         "Prompt contains personally identifiable information",
+	policy.RuleSuspicious:  "Prompt appears to be a jailbreak or injection attempt",
+	policy.RuleBlockedType: "Prompt type is not allowed by policy",
+}
+
+// sarifLog is the root of a SARIF document
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifact `json:"artifactLocation"`
+	Region           sarifRegion   `json:"region"`
+}
+
+type sarifArtifact struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// WriteSARIF writes issues as a SARIF 2.1.0 log for code scanning tools
+func WriteSARIF(w io.Writer, issues []Issue) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{Name: "ai-prompt-analysis"}},
+		// Always emit an array so an empty scan is still valid SARIF
+		Results: []sarifResult{},
+	}
+	for _, id := range []string{policy.RuleRiskScore, policy.RulePII, policy.RuleSuspicious, policy.RuleBlockedType} {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+			ID:               id,
+			ShortDescription: sarifMessage{Text: ruleDescriptions[id]},
+		})
+	}
+
+	for _, issue := range issues {
+		run.Results = append(run.Results, sarifResult{
+			RuleID:  issue.Rule,
+			Level:   "error",
+			Message: sarifMessage{Text: issue.Message + " in " + issue.Source},
+			Locations: []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifact{URI: issue.File},
+					Region:           sarifRegion{StartLine: issue.Line},
+				},
+			}},
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sarifLog{Schema: sarifSchema, Version: "2.1.0", Runs: []sarifRun{run}})
+}
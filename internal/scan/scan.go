@@ -0,0 +1,199 @@
+package scan
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/detect"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/llm"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/policy"
+)
+
+// defaultMaxFileSize is used when scan.max_file_size is unset
+const defaultMaxFileSize = 1 << 20
+
+// Issue is a policy violation at a location in the scanned tree
+type Issue struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+	Source  string `json:"source"`
+}
+
+// Scanner finds prompts in a directory tree and checks them against the policy
+type Scanner struct {
+	include     []string
+	exclude     []string
+	maxFileSize int64
+	extractor   *extractor
+	detectors   []detect.Detector
+	policy      *policy.Policy
+	provider    llm.LLM // Optional; nil runs local detectors only
+}
+
+// New creates a scanner from configuration. The provider may be nil.
+func New(cfg *config.Config, provider llm.LLM) (*Scanner, error) {
+	ex, err := newExtractor(cfg.Scan.YAMLKeys, cfg.Scan.GoIdentifiers)
+	if err != nil {
+		return nil, err
+	}
+	detectors, err := detect.Load(cfg.Detectors)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Scanner{
+		include:     cfg.Scan.Include,
+		exclude:     cfg.Scan.Exclude,
+		maxFileSize: cfg.Scan.MaxFileSize,
+		extractor:   ex,
+		detectors:   detectors,
+		policy:      policy.New(cfg),
+		provider:    provider,
+	}
+	if s.maxFileSize <= 0 {
+		s.maxFileSize = defaultMaxFileSize
+	}
+	return s, nil
+}
+
+// Scan walks root and returns the policy violations found, ordered by file
+// and line, along with the number of prompts checked
+func (s *Scanner) Scan(ctx context.Context, root string) ([]Issue, int, error) {
+	var issues []Issue
+	checked := 0
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		// Skip excluded directories entirely
+		if d.IsDir() {
+			if rel != "." && (matchAny(s.exclude, rel) || matchAny(s.exclude, rel+"/")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || matchAny(s.exclude, rel) || !matchAny(s.include, rel) {
+			return nil
+		}
+
+		// Read the file, skipping large and binary files
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() > s.maxFileSize {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if bytes.IndexByte(data, 0) >= 0 {
+			return nil
+		}
+
+		// Check every prompt in the file
+		prompts, err := s.extractor.extract(rel, data)
+		if err != nil {
+			return err
+		}
+		for _, p := range prompts {
+			found, err := s.check(ctx, p)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %w", p.File, p.Line, err)
+			}
+			issues = append(issues, found...)
+			checked++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, checked, err
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].File != issues[j].File {
+			return issues[i].File < issues[j].File
+		}
+		return issues[i].Line < issues[j].Line
+	})
+	return issues, checked, nil
+}
+
+// check analyzes one prompt and converts policy violations into issues,
+// placing detector-backed violations on the line of each finding
+func (s *Scanner) check(ctx context.Context, p Prompt) ([]Issue, error) {
+	report := detect.Run(ctx, s.detectors, p.Text)
+	analysis := llm.PromptAnalysis{
+		TokenCount:   report.TokenCount,
+		ContainsPII:  report.ContainsPII,
+		IsSuspicious: report.IsSuspicious,
+		RiskScore:    report.RiskScore,
+	}
+
+	// Combine with the LLM's view when a provider is configured
+	if s.provider != nil {
+		remote, err := s.provider.AnalyzePrompt(ctx, p.Text)
+		if err != nil {
+			return nil, err
+		}
+		analysis.TokenCount = remote.TokenCount
+		analysis.PromptType = remote.PromptType
+		analysis.ContainsPII = analysis.ContainsPII || remote.ContainsPII
+		analysis.IsSuspicious = analysis.IsSuspicious || remote.IsSuspicious
+		analysis.RiskScore = max(analysis.RiskScore, remote.RiskScore)
+	}
+
+	decision := s.policy.Evaluate(&analysis)
+	var issues []Issue
+	for _, v := range decision.Violations {
+		// Report each local finding behind the violation at its own line
+		detector := ""
+		switch v.Rule {
+		case policy.RulePII:
+			detector = "pii"
+		case policy.RuleSuspicious:
+			detector = "jailbreak"
+		}
+		located := false
+		for _, f := range report.Findings {
+			if f.Detector != detector {
+				continue
+			}
+			issues = append(issues, Issue{
+				File:    p.File,
+				Line:    p.Line + strings.Count(p.Text[:f.Offset], "\n"),
+				Rule:    v.Rule,
+				Message: fmt.Sprintf("%s (%s)", v.Message, f.Kind),
+				Source:  p.Source,
+			})
+			located = true
+		}
+
+		// Otherwise report the violation at the start of the prompt
+		if !located {
+			issues = append(issues, Issue{File: p.File, Line: p.Line, Rule: v.Rule, Message: v.Message, Source: p.Source})
+		}
+	}
+	return issues, nil
+}
@@ -0,0 +1,233 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// minCompact is the number of logged changes below which the log is never
+// compacted, however few records there are
+const minCompact = 1000
+
+// FileStore keeps records in memory and on disk as a JSON snapshot plus a
+// log of the changes made since it was written. Each save appends one line
+// to the log; the snapshot is rewritten, and the log emptied, once the log
+// holds more changes than there are records. Deletes rewrite it at once, so
+// deleted prompts do not linger on disk.
+type FileStore struct {
+	*MemoryStore
+	path    string
+	logPath string
+
+	writeMu sync.Mutex // Orders changes with their log lines; held while compacting
+	log     *os.File   // Opened on the first logged change
+	logged  int        // Changes in the log
+}
+
+// logEntry is one line of the change log: a saved record
+type logEntry struct {
+	Record *Record `json:"record"`
+}
+
+// NewFileStore opens the snapshot at path and replays its log, creating both
+// on first write
+func NewFileStore(path string) (*FileStore, error) {
+	if path == "" {
+		return nil, fmt.Errorf("storage path not set")
+	}
+
+	s := &FileStore{
+		MemoryStore: NewMemoryStore(),
+		path:        path,
+		logPath:     path + ".log",
+	}
+
+	// Load existing records if the snapshot exists
+	data, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read store: %w", err)
+	default:
+		var records []*Record
+		if err := json.Unmarshal(data, &records); err != nil {
+			return nil, fmt.Errorf("failed to parse store: %w", err)
+		}
+		for _, rec := range records {
+			s.records[rec.ID] = rec
+		}
+	}
+
+	// Apply the changes made since, then fold them into a new snapshot
+	replayed, err := s.replay()
+	if err != nil {
+		return nil, err
+	}
+	if replayed > 0 {
+		if err := s.compact(); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// Save inserts or replaces a record
+func (s *FileStore) Save(rec *Record) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if err := s.MemoryStore.Save(rec); err != nil {
+		return err
+	}
+	return s.append(logEntry{Record: rec})
+}
+
+// Delete removes the record with the given ID from memory and disk
+func (s *FileStore) Delete(id string) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if err := s.MemoryStore.Delete(id); err != nil {
+		return err
+	}
+	return s.compact()
+}
+
+// DeleteByUser removes every record belonging to a user that owned matches
+func (s *FileStore) DeleteByUser(user string, owned func(*Record) bool) (int, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	count, _ := s.MemoryStore.DeleteByUser(user, owned)
+	if count == 0 {
+		return 0, nil
+	}
+	return count, s.compact()
+}
+
+// Purge removes every expired record
+func (s *FileStore) Purge(expired func(*Record) bool) (int, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	count, _ := s.MemoryStore.Purge(expired)
+	if count == 0 {
+		return 0, nil
+	}
+	return count, s.compact()
+}
+
+// append writes one change to the log, compacting once the log has grown
+// past the records it describes; the caller holds writeMu
+func (s *FileStore) append(entry logEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode store change: %w", err)
+	}
+
+	if s.log == nil {
+		if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+			return fmt.Errorf("failed to create store directory: %w", err)
+		}
+		if s.log, err = os.OpenFile(s.logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600); err != nil {
+			return fmt.Errorf("failed to open store log: %w", err)
+		}
+	}
+	if _, err := s.log.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write store log: %w", err)
+	}
+	s.logged++
+
+	s.mu.RLock()
+	records := len(s.records)
+	s.mu.RUnlock()
+	if s.logged > max(minCompact, records) {
+		return s.compact()
+	}
+	return nil
+}
+
+// replay applies the log to the loaded snapshot and returns the number of
+// changes read. A partial line left by an interrupted write ends the log.
+func (s *FileStore) replay() (int, error) {
+	file, err := os.Open(s.logPath)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read store log: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	count := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				slog.Warn("ignoring partial store log entry", "path", s.logPath)
+			}
+			return count, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read store log: %w", err)
+		}
+
+		var entry logEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return 0, fmt.Errorf("failed to parse store log %s: %w", s.logPath, err)
+		}
+		if entry.Record != nil {
+			s.records[entry.Record.ID] = entry.Record
+		}
+		count++
+	}
+}
+
+// compact atomically replaces the snapshot with the current records, then
+// empties the log. A crash in between replays changes the snapshot already
+// holds, which is harmless. The caller holds writeMu.
+func (s *FileStore) compact() error {
+	// Snapshot the records under the read lock
+	s.mu.RLock()
+	records := make([]*Record, 0, len(s.records))
+	for _, rec := range s.records {
+		records = append(records, rec)
+	}
+	data, err := json.Marshal(records)
+	s.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode store: %w", err)
+	}
+
+	// Write to a temporary file and rename it into place
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return fmt.Errorf("failed to create store directory: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write store: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write store: %w", err)
+	}
+
+	// Start a new log
+	if s.log != nil {
+		s.log.Close()
+		s.log = nil
+	}
+	if err := os.Remove(s.logPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to clear store log: %w", err)
+	}
+	s.logged = 0
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileStoreReplaysLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "records.json")
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		if err := s.Save(&Record{ID: id, User: "u1"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Saves are only logged until the log grows large
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("snapshot written before compaction: %v", err)
+	}
+
+	// Simulate a crash partway through writing a change
+	log, err := os.OpenFile(path+".log", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.WriteString(`{"record":{"id":"d"`)
+	log.Close()
+
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	for id, want := range map[string]bool{"a": true, "b": true, "c": true, "d": false} {
+		_, err := reopened.Get(id)
+		if got := err == nil; got != want {
+			t.Errorf("record %s present = %v, want %v", id, got, want)
+		}
+	}
+
+	// Opening folds the log into the snapshot
+	if _, err := os.Stat(path + ".log"); !os.IsNotExist(err) {
+		t.Errorf("log not removed after replay: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("snapshot not written after replay: %v", err)
+	}
+}
+
+func TestFileStoreDeleteRemovesFromDisk(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "records.json")
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range []*Record{
+		{ID: "a", PromptRedacted: "first secret prompt"},
+		{ID: "b", PromptRedacted: "second prompt"},
+	} {
+		if err := s.Save(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Neither the snapshot nor the log still holds the deleted record
+	for _, p := range []string{path, path + ".log"} {
+		data, err := os.ReadFile(p)
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(data), "first secret prompt") {
+			t.Errorf("%s still holds the deleted record", filepath.Base(p))
+		}
+	}
+	if _, err := s.Get("b"); err != nil {
+		t.Errorf("record b: %v", err)
+	}
+}
+
+func TestFileStoreCompacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "records.json")
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rewriting one record grows the log until it is compacted
+	for i := 0; i <= minCompact; i++ {
+		if err := s.Save(&Record{ID: "a", Latency: int64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.logged != 0 {
+		t.Errorf("logged = %d after %d changes, want a compacted log", s.logged, minCompact+1)
+	}
+
+	// Bulk deletes compact at once
+	for i := 0; i < 3; i++ {
+		if err := s.Save(&Record{ID: fmt.Sprintf("u%d", i), User: "bob"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	count, err := s.DeleteByUser("bob", nil)
+	if err != nil || count != 3 {
+		t.Fatalf("DeleteByUser = %d, %v", count, err)
+	}
+	if _, err := os.Stat(path + ".log"); !os.IsNotExist(err) {
+		t.Errorf("log not removed after bulk delete: %v", err)
+	}
+
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := reopened.Get("a")
+	if err != nil || rec.Latency != minCompact {
+		t.Errorf("record a = %+v, %v", rec, err)
+	}
+	if _, err := reopened.Get("u0"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleted record: err = %v, want ErrNotFound", err)
+	}
+}
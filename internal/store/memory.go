@@ -0,0 +1,83 @@
+package store
+
+import (
+	"sync"
+)
+
+// MemoryStore keeps records in memory; they are lost on restart
+type MemoryStore struct {
+	mu      sync.RWMutex
+	records map[string]*Record
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		records: make(map[string]*Record),
+	}
+}
+
+// Save inserts or replaces a record
+func (s *MemoryStore) Save(rec *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *rec
+	s.records[rec.ID] = &copied
+	return nil
+}
+
+// Get returns the record with the given ID
+func (s *MemoryStore) Get(id string) (*Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rec, ok := s.records[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *rec
+	return &copied, nil
+}
+
+// Delete removes the record with the given ID
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.records[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.records, id)
+	return nil
+}
+
+// DeleteByUser removes every record belonging to a user that owned matches
+func (s *MemoryStore) DeleteByUser(user string, owned func(*Record) bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.deleteWhere(func(rec *Record) bool {
+		return rec.User == user && (owned == nil || owned(rec))
+	}), nil
+}
+
+// Purge removes every expired record
+func (s *MemoryStore) Purge(expired func(*Record) bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.deleteWhere(expired), nil
+}
+
+// deleteWhere removes matching records; the caller must hold the write lock
+func (s *MemoryStore) deleteWhere(match func(*Record) bool) int {
+	count := 0
+	for id, rec := range s.records {
+		if match(rec) {
+			delete(s.records, id)
+			count++
+		}
+	}
+	return count
+}
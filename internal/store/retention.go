@@ -0,0 +1,203 @@
+package store
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/prompt"
+)
+
+// Retention modes
+const (
+	ModeNone      = "none"
+	ModeHash      = "hash"
+	ModeRedacted  = "redacted"
+	ModeEncrypted = "encrypted"
+)
+
+// Retention errors
+var (
+	ErrUnknownMode   = errors.New("unknown retention mode")
+	ErrKeyNotSet     = errors.New("STORAGE_ENCRYPTION_KEY not set")
+	ErrInvalidKey    = errors.New("STORAGE_ENCRYPTION_KEY must be a base64-encoded 32-byte key")
+	ErrNotEncrypted  = errors.New("record does not hold an encrypted prompt")
+	ErrDecryptFailed = errors.New("failed to decrypt prompt")
+)
+
+// Retention decides which form of the prompt is kept on a record
+type Retention struct {
+	Mode string
+	TTL  time.Duration
+	aead cipher.AEAD
+}
+
+// NewRetention builds the retention policy from configuration. Encrypted mode
+// reads its key from the STORAGE_ENCRYPTION_KEY environment variable.
+func NewRetention(cfg *config.Config) (*Retention, error) {
+	r := &Retention{
+		Mode: cfg.Retention.Mode,
+		TTL:  cfg.Retention.TTL,
+	}
+	if r.Mode == "" {
+		r.Mode = ModeNone
+	}
+
+	switch r.Mode {
+	case ModeNone, ModeHash, ModeRedacted:
+		return r, nil
+	case ModeEncrypted:
+		aead, err := loadKey(os.Getenv("STORAGE_ENCRYPTION_KEY"))
+		if err != nil {
+			return nil, err
+		}
+		r.aead = aead
+		return r, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMode, r.Mode)
+	}
+}
+
+// Apply stores the prompt on the record in the form allowed by the mode
+func (r *Retention) Apply(rec *Record, promptText string) error {
+	switch r.Mode {
+	case ModeHash:
+		rec.PromptHash = HashPrompt(promptText)
+	case ModeRedacted:
+		rec.PromptHash = HashPrompt(promptText)
+		rec.PromptRedacted = prompt.Redact(promptText)
+	case ModeEncrypted:
+		rec.PromptHash = HashPrompt(promptText)
+		sealed, err := r.encrypt(rec.ID, []byte(promptText))
+		if err != nil {
+			return err
+		}
+		rec.PromptEncrypted = sealed
+	}
+	return nil
+}
+
+// Decrypt returns the original prompt of a record saved in encrypted mode
+func (r *Retention) Decrypt(rec *Record) (string, error) {
+	plain, err := r.Open(rec.ID, rec.PromptEncrypted)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// Seal encrypts data that holds prompts, such as queued batch items, so it
+// can be kept on disk. The ciphertext is bound to id. It reports false in
+// every mode but encrypted, where prompts must not be written to disk.
+func (r *Retention) Seal(id string, data []byte) ([]byte, bool, error) {
+	if r.Mode != ModeEncrypted {
+		return nil, false, nil
+	}
+	sealed, err := r.encrypt(id, data)
+	if err != nil {
+		return nil, false, err
+	}
+	return sealed, true, nil
+}
+
+// Open decrypts data sealed for id by Seal or by encrypted mode
+func (r *Retention) Open(id string, data []byte) ([]byte, error) {
+	if r.aead == nil || len(data) == 0 {
+		return nil, ErrNotEncrypted
+	}
+
+	nonceSize := r.aead.NonceSize()
+	if len(data) < nonceSize {
+		return nil, ErrDecryptFailed
+	}
+	nonce, sealed := data[:nonceSize], data[nonceSize:]
+	plain, err := r.aead.Open(nil, nonce, sealed, []byte(id))
+	if err != nil {
+		return nil, ErrDecryptFailed
+	}
+	return plain, nil
+}
+
+// encrypt seals data with AES-GCM, prefixing the random nonce and binding
+// the ciphertext to the ID
+func (r *Retention) encrypt(id string, data []byte) ([]byte, error) {
+	nonce := make([]byte, r.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("error generating nonce: %w", err)
+	}
+	return r.aead.Seal(nonce, nonce, data, []byte(id)), nil
+}
+
+// HashPrompt returns the hex SHA-256 digest of a prompt
+func HashPrompt(promptText string) string {
+	sum := sha256.Sum256([]byte(promptText))
+	return hex.EncodeToString(sum[:])
+}
+
+// loadKey decodes a base64 AES-256 key and builds the GCM cipher
+func loadKey(encoded string) (cipher.AEAD, error) {
+	if encoded == "" {
+		return nil, ErrKeyNotSet
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		return nil, ErrInvalidKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// RunPurger deletes records older than their tenant's TTL every interval
+// until the context is cancelled. ttl returns the TTL for a tenant; zero
+// keeps its records forever. removed, if set, is called with each record
+// deleted.
+func RunPurger(ctx context.Context, s Store, ttl func(tenant string) time.Duration, interval time.Duration, removed func(*Record)) {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		var expired []*Record
+		count, err := s.Purge(func(rec *Record) bool {
+			limit := ttl(rec.Tenant)
+			if limit > 0 && rec.CreatedAt.Before(now.Add(-limit)) {
+				expired = append(expired, rec)
+				return true
+			}
+			return false
+		})
+		if removed != nil {
+			for _, rec := range expired {
+				removed(rec)
+			}
+		}
+		if err != nil {
+			slog.Error("retention purge failed", "error", err.Error())
+		} else if count > 0 {
+			slog.Info("retention purge complete", "removed", count)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
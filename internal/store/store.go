@@ -0,0 +1,81 @@
+package store
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/llm"
+)
+
+// Common errors
+var (
+	ErrNotFound       = errors.New("record not found")
+	ErrUnknownBackend = errors.New("unknown storage backend")
+)
+
+// Record is a single stored analysis. Which prompt fields are populated
+// depends on the configured retention mode.
+type Record struct {
+	ID              string             `json:"id"`
+	User            string             `json:"user,omitempty"`
+	Client          string             `json:"client,omitempty"` // Authenticated API client that requested the analysis
+	Tenant          string             `json:"tenant,omitempty"`
+	Provider        string             `json:"provider"`
+	CreatedAt       time.Time          `json:"createdAt"`
+	PromptHash      string             `json:"promptHash,omitempty"`
+	PromptRedacted  string             `json:"promptRedacted,omitempty"`
+	PromptEncrypted []byte             `json:"promptEncrypted,omitempty"`
+	Analysis        llm.PromptAnalysis `json:"analysis"`
+	Latency         int64              `json:"latency"`
+	Usage           *llm.Usage         `json:"usage,omitempty"`
+	CostUSD         *float64           `json:"costUsd,omitempty"`
+	CacheKey        string             `json:"cacheKey,omitempty"` // Cache entry holding the analysis, removed with the record
+}
+
+// Store defines the interface for analysis record persistence
+type Store interface {
+	// Save inserts or replaces a record
+	Save(rec *Record) error
+
+	// Get returns the record with the given ID
+	Get(id string) (*Record, error)
+
+	// Delete removes the record with the given ID
+	Delete(id string) error
+
+	// DeleteByUser removes every record belonging to a user that the owned
+	// function matches, or all of them when it is nil, and returns the count
+	DeleteByUser(user string, owned func(*Record) bool) (int, error)
+
+	// Purge removes every record the expired function matches and returns
+	// the count
+	Purge(expired func(*Record) bool) (int, error)
+}
+
+// Open creates the store selected in the configuration. It returns nil when
+// persistence is disabled.
+func Open(cfg *config.Config) (Store, error) {
+	switch cfg.Storage.Backend {
+	case "":
+		return nil, nil
+	case "memory":
+		return NewMemoryStore(), nil
+	case "file":
+		return NewFileStore(cfg.Storage.Path)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownBackend, cfg.Storage.Backend)
+	}
+}
+
+// NewID returns a random hex identifier for a record
+func NewID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("failed to generate ID: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
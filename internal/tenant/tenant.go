@@ -0,0 +1,126 @@
+package tenant
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/auth"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/detect"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/llm"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/policy"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/store"
+)
+
+// Settings are the effective settings for one tenant's requests
+type Settings struct {
+	Name      string // Empty for the global settings
+	Providers []string
+	Overrides *llm.Overrides    // Nil for the global settings
+	Detectors []detect.Detector // Run over every prompt alongside the provider
+	Policy    *policy.Policy
+	Retention *store.Retention
+}
+
+// Allows reports whether the tenant may use the provider
+func (s *Settings) Allows(provider string) bool {
+	return len(s.Providers) == 0 || slices.Contains(s.Providers, provider)
+}
+
+// Registry resolves the settings of each configured tenant. Clients without
+// a tenant, or whose tenant has no overrides, get the global settings.
+type Registry struct {
+	defaults *Settings
+	tenants  map[string]*Settings
+}
+
+// New builds the global settings and those of every configured tenant
+func New(cfg *config.Config) (*Registry, error) {
+	retention, err := store.NewRetention(cfg)
+	if err != nil {
+		return nil, err
+	}
+	detectors, err := detect.Load(cfg.Detectors)
+	if err != nil {
+		return nil, err
+	}
+	r := &Registry{
+		defaults: &Settings{Detectors: detectors, Policy: policy.New(cfg), Retention: retention},
+		tenants:  make(map[string]*Settings),
+	}
+
+	for _, t := range cfg.Tenants {
+		merged := cfg.ForTenant(t)
+		s := &Settings{
+			Name:      t.Name,
+			Providers: t.Providers,
+			Detectors: detectors,
+			Policy:    policy.New(merged),
+			Retention: retention,
+		}
+		if t.Retention != nil {
+			if s.Retention, err = store.NewRetention(merged); err != nil {
+				return nil, fmt.Errorf("tenant %q: %w", t.Name, err)
+			}
+		}
+		s.Overrides = &llm.Overrides{Tenant: t.Name, Models: t.Models, SystemPrompt: t.SystemPrompt}
+		if len(t.Detectors) > 0 {
+			if s.Detectors, err = detect.Load(t.Detectors); err != nil {
+				return nil, fmt.Errorf("tenant %q: %w", t.Name, err)
+			}
+			s.Overrides.Detectors = s.Detectors
+		}
+		r.tenants[t.Name] = s
+	}
+	return r, nil
+}
+
+// For returns the settings of the named tenant
+func (r *Registry) For(tenant string) *Settings {
+	if s, ok := r.tenants[tenant]; ok {
+		return s
+	}
+	return r.defaults
+}
+
+// FromContext returns the settings of the authenticated client's tenant
+func (r *Registry) FromContext(ctx context.Context) *Settings {
+	if id := auth.FromContext(ctx); id != nil {
+		return r.For(id.Tenant)
+	}
+	return r.defaults
+}
+
+// Overrides returns the provider overrides for a tenant's calls. A tenant
+// without configured settings still gets overrides naming it, so its calls
+// never share a cached or coalesced result with another tenant's.
+func (r *Registry) Overrides(tenant string) *llm.Overrides {
+	if s, ok := r.tenants[tenant]; ok {
+		return s.Overrides
+	}
+	if tenant == "" {
+		return nil
+	}
+	return &llm.Overrides{Tenant: tenant}
+}
+
+// TTL returns how long the tenant's records are kept; zero keeps them
+// forever
+func (r *Registry) TTL(tenant string) time.Duration {
+	return r.For(tenant).Retention.TTL
+}
+
+// Expires reports whether any tenant's records expire
+func (r *Registry) Expires() bool {
+	if r.defaults.Retention.TTL > 0 {
+		return true
+	}
+	for _, s := range r.tenants {
+		if s.Retention.TTL > 0 {
+			return true
+		}
+	}
+	return false
+}
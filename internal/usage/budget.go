@@ -0,0 +1,121 @@
+package usage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
+)
+
+// Budget periods
+const (
+	PeriodDay   = "day"
+	PeriodMonth = "month"
+)
+
+// monthFormat is the layout of a month period
+const monthFormat = "2006-01"
+
+// spendKey identifies the spending of a client or tenant in one period. The
+// period is a day or a month in dayFormat or monthFormat.
+type spendKey struct {
+	period string
+	kind   string // client or tenant
+	name   string
+}
+
+// Breach is a budget threshold that a client or tenant has reached
+type Breach struct {
+	Kind     string    // client or tenant
+	Name     string    // Client or tenant name
+	Period   string    // PeriodDay or PeriodMonth
+	SpentUSD float64   // Spending so far in the period
+	LimitUSD float64   // The threshold reached
+	Hard     bool      // Requests are rejected rather than warned
+	Reset    time.Time // When the period ends and spending starts again at zero
+}
+
+// String describes the breach for response headers and errors
+func (b Breach) String() string {
+	period := "daily"
+	if b.Period == PeriodMonth {
+		period = "monthly"
+	}
+	threshold := "soft"
+	if b.Hard {
+		threshold = "hard"
+	}
+	return fmt.Sprintf("%s %s has spent $%.2f of its $%.2f %s %s budget",
+		b.Kind, b.Name, b.SpentUSD, b.LimitUSD, period, threshold)
+}
+
+// addSpend adds a cost to the day's and month's totals for the client and
+// tenant. The caller holds l.mu.
+func (l *Ledger) addSpend(day, client, tenant string, cost float64) {
+	month := day[:len(monthFormat)]
+	for _, period := range []string{day, month} {
+		if client != "" {
+			l.spend[spendKey{period, "client", client}] += cost
+		}
+		if tenant != "" {
+			l.spend[spendKey{period, "tenant", tenant}] += cost
+		}
+	}
+}
+
+// CheckBudgets returns the budget thresholds the client or its tenant has
+// reached in the current day and month. A request is rejected when any of
+// them is hard.
+func (l *Ledger) CheckBudgets(client, tenant string) []Breach {
+	now := time.Now().UTC()
+	day, month := now.Format(dayFormat), now.Format(monthFormat)
+	tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	nextMonth := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var breaches []Breach
+	for _, b := range l.cfg.Budgets {
+		kind, name := "client", b.Client
+		if b.Tenant != "" {
+			kind, name = "tenant", b.Tenant
+		}
+		if (kind == "client" && name != client) || (kind == "tenant" && name != tenant) {
+			continue
+		}
+
+		for _, p := range []struct {
+			period, key string
+			limit       config.BudgetLimit
+			reset       time.Time
+		}{
+			{PeriodDay, day, b.Daily, tomorrow},
+			{PeriodMonth, month, b.Monthly, nextMonth},
+		} {
+			spent := l.spend[spendKey{p.key, kind, name}]
+			breach := Breach{Kind: kind, Name: name, Period: p.period, SpentUSD: spent, Reset: p.reset}
+			switch {
+			case p.limit.Hard > 0 && spent >= p.limit.Hard:
+				breach.LimitUSD, breach.Hard = p.limit.Hard, true
+			case p.limit.Soft > 0 && spent >= p.limit.Soft:
+				breach.LimitUSD = p.limit.Soft
+			default:
+				continue
+			}
+			breaches = append(breaches, breach)
+		}
+	}
+	return breaches
+}
+
+// HardBreach returns the first hard budget limit the client or its tenant
+// has reached, if any
+func (l *Ledger) HardBreach(client, tenant string) (Breach, bool) {
+	for _, breach := range l.CheckBudgets(client, tenant) {
+		if breach.Hard {
+			return breach, true
+		}
+	}
+	return Breach{}, false
+}
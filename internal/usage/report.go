@@ -0,0 +1,138 @@
+package usage
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Row is the usage of one tenant, or one client of a tenant, in one period
+type Row struct {
+	Period       string  `json:"period"` // A day (2006-01-02) or month (2006-01)
+	Tenant       string  `json:"tenant"`
+	Client       string  `json:"client,omitempty"`
+	Requests     int     `json:"requests"`
+	InputTokens  int     `json:"inputTokens"`
+	OutputTokens int     `json:"outputTokens"`
+	CostUSD      float64 `json:"costUsd"`
+}
+
+// Report is the usage between two days, inclusive, totaled by period
+type Report struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Period   string `json:"period"` // PeriodDay or PeriodMonth
+	ByClient bool   `json:"byClient"`
+	Rows     []Row  `json:"rows"`
+}
+
+// ParseRange parses the report range, given as days in 2006-01-02 form.
+// From defaults to the first of the current month and to defaults to today.
+func ParseRange(from, to string) (time.Time, time.Time, error) {
+	now := time.Now().UTC()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := now
+	var err error
+	if from != "" {
+		if start, err = time.Parse(dayFormat, from); err != nil {
+			return start, end, fmt.Errorf("invalid from date %q: use YYYY-MM-DD", from)
+		}
+	}
+	if to != "" {
+		if end, err = time.Parse(dayFormat, to); err != nil {
+			return start, end, fmt.Errorf("invalid to date %q: use YYYY-MM-DD", to)
+		}
+	}
+	if end.Before(start) {
+		return start, end, fmt.Errorf("to date %s is before from date %s", end.Format(dayFormat), start.Format(dayFormat))
+	}
+	return start, end, nil
+}
+
+// NewReport totals the ledger's usage from one day to another by tenant and
+// period, and by client within each tenant when byClient is set
+func (l *Ledger) NewReport(from, to time.Time, period string, byClient bool) (*Report, error) {
+	if period != PeriodDay && period != PeriodMonth {
+		return nil, fmt.Errorf("invalid period %q: use %s or %s", period, PeriodDay, PeriodMonth)
+	}
+
+	type rowKey struct{ period, tenant, client string }
+	totals := make(map[rowKey]*Row)
+	for _, e := range l.Entries(from, to) {
+		k := rowKey{period: e.Day, tenant: e.Tenant}
+		if period == PeriodMonth {
+			k.period = e.Day[:len(monthFormat)]
+		}
+		if byClient {
+			k.client = e.Client
+		}
+		row, ok := totals[k]
+		if !ok {
+			row = &Row{Period: k.period, Tenant: k.tenant, Client: k.client}
+			totals[k] = row
+		}
+		row.Requests += e.Requests
+		row.InputTokens += e.InputTokens
+		row.OutputTokens += e.OutputTokens
+		row.CostUSD += e.CostUSD
+	}
+
+	report := &Report{
+		From:     from.UTC().Format(dayFormat),
+		To:       to.UTC().Format(dayFormat),
+		Period:   period,
+		ByClient: byClient,
+		Rows:     make([]Row, 0, len(totals)),
+	}
+	for _, row := range totals {
+		report.Rows = append(report.Rows, *row)
+	}
+	sort.Slice(report.Rows, func(i, j int) bool {
+		a, b := report.Rows[i], report.Rows[j]
+		if a.Period != b.Period {
+			return a.Period < b.Period
+		}
+		if a.Tenant != b.Tenant {
+			return a.Tenant < b.Tenant
+		}
+		return a.Client < b.Client
+	})
+	return report, nil
+}
+
+// WriteJSON writes the report as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteCSV writes the report rows as CSV with a header line. The client
+// column is included only when the report is by client.
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	header := []string{"period", "tenant", "requests", "input_tokens", "output_tokens", "cost_usd"}
+	if r.ByClient {
+		header = []string{"period", "tenant", "client", "requests", "input_tokens", "output_tokens", "cost_usd"}
+	}
+	cw.Write(header)
+	for _, row := range r.Rows {
+		record := []string{row.Period, row.Tenant}
+		if r.ByClient {
+			record = append(record, row.Client)
+		}
+		record = append(record,
+			strconv.Itoa(row.Requests),
+			strconv.Itoa(row.InputTokens),
+			strconv.Itoa(row.OutputTokens),
+			strconv.FormatFloat(row.CostUSD, 'f', 6, 64),
+		)
+		cw.Write(record)
+	}
+	cw.Flush()
+	return cw.Error()
+}
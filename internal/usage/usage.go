@@ -0,0 +1,272 @@
+package usage
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/llm"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/metrics"
+)
+
+// dayFormat is the layout of Entry.Day
+const dayFormat = time.DateOnly
+
+// flushInterval is how often changed totals are written to usage.json
+const flushInterval = 5 * time.Second
+
+// Entry is the usage of one client, tenant and model on one day (UTC)
+type Entry struct {
+	Day          string  `json:"day"`
+	Client       string  `json:"client,omitempty"`
+	Tenant       string  `json:"tenant,omitempty"`
+	Provider     string  `json:"provider"`
+	Model        string  `json:"model"`
+	Requests     int     `json:"requests"`
+	InputTokens  int     `json:"inputTokens"`
+	OutputTokens int     `json:"outputTokens"`
+	CostUSD      float64 `json:"costUsd"`
+}
+
+// key identifies the row an entry is aggregated into
+type key struct {
+	day, client, tenant, provider, model string
+}
+
+// Ledger aggregates token usage and cost by client, tenant, model and day.
+// With the file storage backend the totals are kept in usage.json beside the
+// record store and survive restarts; otherwise they are held in memory. The
+// file is rewritten every flushInterval while the totals change, and once
+// more by Close, so a crash loses at most the last interval's usage.
+type Ledger struct {
+	cfg  *config.Config
+	path string // Empty when not persisted
+
+	mu      sync.Mutex
+	entries map[key]*Entry
+	spend   map[spendKey]float64 // Cost by budget subject and period
+	dirty   bool                 // Totals changed since the last flush
+	writeMu sync.Mutex
+
+	stop      chan struct{} // Closed to stop the flusher; nil when not persisted
+	stopped   chan struct{} // Closed when the flusher has returned
+	closeOnce sync.Once
+}
+
+// NewLedger creates a ledger, loading persisted totals if there are any
+func NewLedger(cfg *config.Config) (*Ledger, error) {
+	l := &Ledger{
+		cfg:     cfg,
+		entries: make(map[key]*Entry),
+		spend:   make(map[spendKey]float64),
+	}
+	if cfg.Storage.Backend != "file" {
+		return l, nil
+	}
+
+	l.path = filepath.Join(filepath.Dir(cfg.Storage.Path), "usage.json")
+	data, err := os.ReadFile(l.path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read usage: %w", err)
+	default:
+		var entries []*Entry
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, fmt.Errorf("failed to parse usage: %w", err)
+		}
+		for _, e := range entries {
+			l.entries[e.key()] = e
+			l.addSpend(e.Day, e.Client, e.Tenant, e.CostUSD)
+		}
+	}
+
+	l.stop = make(chan struct{})
+	l.stopped = make(chan struct{})
+	go l.flusher()
+	return l, nil
+}
+
+// Close stops the background flusher and writes any totals recorded since
+// the last flush
+func (l *Ledger) Close() error {
+	if l.stop == nil {
+		return nil
+	}
+	l.closeOnce.Do(func() {
+		close(l.stop)
+		<-l.stopped
+	})
+	return l.flush()
+}
+
+// flusher writes changed totals every flushInterval until the ledger is
+// closed
+func (l *Ledger) flusher() {
+	defer close(l.stopped)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			if err := l.flush(); err != nil {
+				slog.Error("failed to persist usage", "error", err.Error())
+			}
+		}
+	}
+}
+
+// Cost prices the usage with the model's entry in the pricing table. It
+// reports false when the model has no price.
+func Cost(cfg *config.Config, model string, u llm.Usage) (float64, bool) {
+	price, ok := cfg.Price(model)
+	if !ok {
+		return 0, false
+	}
+	return (float64(u.InputTokens)*price.Input + float64(u.OutputTokens)*price.Output) / 1e6, true
+}
+
+// BatchCost prices usage from a vendor batch API, taking the model's
+// batch_discount off its realtime price
+func BatchCost(cfg *config.Config, model string, u llm.Usage) (float64, bool) {
+	cost, ok := Cost(cfg, model, u)
+	if !ok {
+		return 0, false
+	}
+	price, _ := cfg.Price(model)
+	return cost * (1 - price.BatchDiscount), true
+}
+
+// Record adds one provider call to today's totals and the usage metrics. It
+// returns the call's cost, and false when the model has no price.
+func (l *Ledger) Record(client, tenant, provider, model string, u llm.Usage) (float64, bool) {
+	cost, priced := Cost(l.cfg, model, u)
+	l.add(client, tenant, provider, model, u, cost)
+	return cost, priced
+}
+
+// RecordBatch is Record for a result of a vendor batch API, priced with
+// BatchCost
+func (l *Ledger) RecordBatch(client, tenant, provider, model string, u llm.Usage) (float64, bool) {
+	cost, priced := BatchCost(l.cfg, model, u)
+	l.add(client, tenant, provider, model, u, cost)
+	return cost, priced
+}
+
+// add adds one priced call to today's totals and the usage metrics
+func (l *Ledger) add(client, tenant, provider, model string, u llm.Usage, cost float64) {
+	metrics.ClientTokens.WithLabelValues(client, tenant, "input").Add(float64(u.InputTokens))
+	metrics.ClientTokens.WithLabelValues(client, tenant, "output").Add(float64(u.OutputTokens))
+	metrics.CostUSD.WithLabelValues(client, tenant, provider, model).Add(cost)
+
+	l.mu.Lock()
+	k := key{time.Now().UTC().Format(dayFormat), client, tenant, provider, model}
+	e, ok := l.entries[k]
+	if !ok {
+		e = &Entry{Day: k.day, Client: client, Tenant: tenant, Provider: provider, Model: model}
+		l.entries[k] = e
+	}
+	e.Requests++
+	e.InputTokens += u.InputTokens
+	e.OutputTokens += u.OutputTokens
+	e.CostUSD += cost
+	l.addSpend(k.day, client, tenant, cost)
+	l.dirty = true
+	l.mu.Unlock()
+}
+
+// Entries returns the daily totals from one day to another, inclusive,
+// ordered by day, tenant, client, provider and model
+func (l *Ledger) Entries(from, to time.Time) []Entry {
+	first, last := from.UTC().Format(dayFormat), to.UTC().Format(dayFormat)
+
+	l.mu.Lock()
+	var entries []Entry
+	for k, e := range l.entries {
+		if k.day >= first && k.day <= last {
+			entries = append(entries, *e)
+		}
+	}
+	l.mu.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Day != b.Day {
+			return a.Day < b.Day
+		}
+		if a.Tenant != b.Tenant {
+			return a.Tenant < b.Tenant
+		}
+		if a.Client != b.Client {
+			return a.Client < b.Client
+		}
+		if a.Provider != b.Provider {
+			return a.Provider < b.Provider
+		}
+		return a.Model < b.Model
+	})
+	return entries
+}
+
+// flush atomically replaces the usage file with the current totals if they
+// have changed since the last flush
+func (l *Ledger) flush() error {
+	if l.path == "" {
+		return nil
+	}
+	l.writeMu.Lock()
+	defer l.writeMu.Unlock()
+
+	l.mu.Lock()
+	if !l.dirty {
+		l.mu.Unlock()
+		return nil
+	}
+	entries := make([]*Entry, 0, len(l.entries))
+	for _, e := range l.entries {
+		entries = append(entries, e)
+	}
+	data, err := json.Marshal(entries)
+	l.dirty = false
+	l.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode usage: %w", err)
+	}
+
+	if err := l.write(data); err != nil {
+		// Retry on the next flush
+		l.mu.Lock()
+		l.dirty = true
+		l.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// write atomically replaces the usage file
+func (l *Ledger) write(data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o700); err != nil {
+		return fmt.Errorf("failed to create usage directory: %w", err)
+	}
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write usage: %w", err)
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		return fmt.Errorf("failed to write usage: %w", err)
+	}
+	return nil
+}
+
+// key returns the aggregation key of an entry
+func (e *Entry) key() key {
+	return key{e.Day, e.Client, e.Tenant, e.Provider, e.Model}
+}
@@ -0,0 +1,71 @@
+package usage
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/llm"
+)
+
+func TestBatchCost(t *testing.T) {
+	cfg := &config.Config{Pricing: []config.ModelPrice{
+		{Model: "discounted", Input: 2, Output: 8, BatchDiscount: 0.5},
+		{Model: "full", Input: 2, Output: 8},
+	}}
+	u := llm.Usage{InputTokens: 1_000_000, OutputTokens: 500_000}
+
+	tests := []struct {
+		model  string
+		want   float64
+		priced bool
+	}{
+		{"discounted", 3, true},
+		{"full", 6, true},
+		{"unpriced", 0, false},
+	}
+	for _, tt := range tests {
+		got, priced := BatchCost(cfg, tt.model, u)
+		if priced != tt.priced || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("BatchCost(%q) = %v, %v, want %v, %v", tt.model, got, priced, tt.want, tt.priced)
+		}
+	}
+}
+
+func TestLedgerFlushesOnClose(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{Pricing: []config.ModelPrice{{Model: "m", Input: 1, Output: 1}}}
+	cfg.Storage.Backend = "file"
+	cfg.Storage.Path = filepath.Join(dir, "records.json")
+	path := filepath.Join(dir, "usage.json")
+
+	l, err := NewLedger(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		l.Record("alice", "acme", "mock", "m", llm.Usage{InputTokens: 10, OutputTokens: 5})
+	}
+
+	// Recording does not rewrite the file; the flusher or Close does
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("usage.json written on Record: %v", err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	reloaded, err := NewLedger(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+	now := time.Now()
+	entries := reloaded.Entries(now, now)
+	if len(entries) != 1 || entries[0].Requests != 3 || entries[0].InputTokens != 30 || entries[0].OutputTokens != 15 {
+		t.Errorf("reloaded entries = %+v", entries)
+	}
+}
@@ -2,10 +2,10 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"github.com/joho/godotenv"
-	"github.com/rlnorthcutt/ai-prompt-analysis/internal/config"
-	"github.com/rlnorthcutt/ai-prompt-analysis/internal/handler"
+	"github.com/rlnorthcutt/ai-prompt-analysis/internal/cli"
 )
 
 func main() {
@@ -14,20 +14,8 @@ func main() {
 		log.Println("Warning: Error loading .env file:", err)
 	}
 
-	// Load configuration
-	cfg, err := config.Load()
-	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+	// Run the requested command (serve by default)
+	if err := cli.Run(os.Args[1:]); err != nil {
+		log.Fatal(err)
 	}
-
-	// Create handler with LLM providers
-	h := handler.NewHandler(cfg)
-
-	// Register routes
-	h.RegisterRoutes()
-
-	// Start the server
-	if err := h.StartServer(); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
-	}
-}
\ No newline at end of file
+}